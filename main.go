@@ -40,24 +40,45 @@ Server Options:
     -u, --headauth <method>          Resource method for header authentication
     -t, --wsheadauth <method>        Resource method for WebSocket header authentication
     -m, --metricsport <port>         HTTP port for OpenMetrics connections (default: disabled)
-        --apiencoding <type>         Encoding for web resources: json, jsonflat (default: json)
+        --apiencoding <type>         Encoding for web resources: json, jsonflat, jsonapi, hal (default: json)
         --putmethod <methodName>     Call method name mapped to HTTP PUT requests
         --deletemethod <methodName>  Call method name mapped to HTTP DELETE requests
         --patchmethod <methodName>   Call method name mapped to HTTP PATCH requests
+        --graphqlpath <path>         GraphQL endpoint path for clients (default: disabled)
+        --openapipath <path>         OpenAPI document path for clients (default: disabled)
+        --openapiresource <rid>      Resource name to describe in the OpenAPI document
         --wscompression              Enable WebSocket per message compression
+        --wspinginterval <ms>        Interval between WebSocket pings (default: disabled)
+        --wspongtimeout <ms>         Time to await a WebSocket pong (default: ping interval)
+        --wsidletimeout <ms>         Time without client requests before disconnecting (default: disabled)
+        --wsmaxmessage <bytes>       Maximum size of WebSocket messages (default: no limit)
+        --httpmaxbody <bytes>        Maximum size of HTTP request bodies (default: no limit)
+        --maxcallparams <bytes>      Maximum size of call request params (default: no limit)
+        --connevents                 Publish connection connected and disconnected events
+        --subjectprefix <prefix>     Prefix for all NATS subjects sent to or subscribed on
         --resetthrottle <limit>      Limit on parallel requests sent in response to a system reset
+        --resetpriority              Prioritize throttled reset requests by subscriber count
         --referencethrottle <limit>  Limit on parallel requests sent when following resource references
+        --cacheaudit <milliseconds>  Interval between cache audits against services (default: disabled)
+        --cacheauditcorrect          Correct cached resources found diverging by an audit
+        --cachesnapshot <file>       Cache snapshot file for warm restarts (default: disabled)
+        --cachesnapshotmaxage <ms>   Max age in milliseconds of a cache snapshot (default: 300000)
+        --cachewarmup <rid>          Resource ID or pattern of resources to fetch and keep in cache
     -c, --config <file>              Configuration file
 
 Security Options:
         --tls                        Enable TLS for HTTP (default: false)
         --tlscert <file>             HTTP server certificate file
         --tlskey <file>              Private key for HTTP server certificate
+        --tlsclientauth <mode>       Client certificate authentication: none, request, require (default: none)
+        --tlsclientca <file>         CA file for verifying client certificates
         --creds <file>               NATS User Credentials file
         --natscert <file>            NATS Client certificate file
         --natskey <file>             NATS Client certificate key file
         --natsrootca <file>          NATS Root CA file(s)
         --alloworigin <origin>       Allowed origin(s): *, or <scheme>://<hostname>[:<port>] (default: *)
+        --trustedproxy <cidr>        Trusted proxy IP address or CIDR range for forwarded headers
+        --proxyprotocol              Require PROXY protocol header on connections from trusted proxies
 
 Logging Options:
     -D, --debug                      Enable debugging output
@@ -133,9 +154,14 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 		natsRootCAs  StringSlice
 		debugTrace   bool
 		allowOrigin  StringSlice
+		cacheWarmUp  StringSlice
 		putMethod    string
 		deleteMethod string
 		patchMethod  string
+		graphqlPath  string
+		openAPIPath  string
+		openAPIRes   StringSlice
+		trustedProxy StringSlice
 	)
 
 	fs.BoolVar(&showHelp, "h", false, "Show this message.")
@@ -161,6 +187,8 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 	fs.BoolVar(&c.TLS, "tls", false, "Enable TLS for HTTP.")
 	fs.StringVar(&c.TLSCert, "tlscert", "", "HTTP server certificate file.")
 	fs.StringVar(&c.TLSKey, "tlskey", "", "Private key for HTTP server certificate.")
+	fs.StringVar(&c.TLSClientAuth, "tlsclientauth", "", "Client certificate authentication: none, request, require.")
+	fs.StringVar(&c.TLSClientCA, "tlsclientca", "", "CA file for verifying client certificates.")
 	fs.StringVar(&c.APIEncoding, "apiencoding", "", "Encoding for web resources.")
 	fs.IntVar(&c.RequestTimeout, "r", 0, "Timeout in milliseconds for NATS requests.")
 	fs.IntVar(&c.RequestTimeout, "reqtimeout", 0, "Timeout in milliseconds for NATS requests.")
@@ -169,12 +197,31 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 	fs.StringVar(&c.NatsTLSKey, "natskey", "", "NATS Client certificate key file.")
 	fs.Var(&natsRootCAs, "natsrootca", "NATS Root CA file(s).")
 	fs.Var(&allowOrigin, "alloworigin", "Allowed origin(s) for CORS.")
+	fs.Var(&trustedProxy, "trustedproxy", "Trusted proxy IP address or CIDR range for forwarded headers.")
+	fs.BoolVar(&c.ProxyProtocol, "proxyprotocol", false, "Require PROXY protocol header on connections from trusted proxies.")
 	fs.StringVar(&putMethod, "putmethod", "", "Call method name mapped to HTTP PUT requests.")
 	fs.StringVar(&deleteMethod, "deletemethod", "", "Call method name mapped to HTTP DELETE requests.")
 	fs.StringVar(&patchMethod, "patchmethod", "", "Call method name mapped to HTTP PATCH requests.")
+	fs.StringVar(&graphqlPath, "graphqlpath", "", "GraphQL endpoint path for clients.")
+	fs.StringVar(&openAPIPath, "openapipath", "", "OpenAPI document path for clients.")
+	fs.Var(&openAPIRes, "openapiresource", "Resource name to describe in the OpenAPI document.")
 	fs.BoolVar(&c.WSCompression, "wscompression", false, "Enable WebSocket per message compression.")
+	fs.IntVar(&c.WSPingInterval, "wspinginterval", 0, "Interval in milliseconds between WebSocket pings.")
+	fs.IntVar(&c.WSPongTimeout, "wspongtimeout", 0, "Time in milliseconds to await a WebSocket pong.")
+	fs.IntVar(&c.WSIdleTimeout, "wsidletimeout", 0, "Time in milliseconds without client requests before disconnecting.")
+	fs.IntVar(&c.WSMaxMessageSize, "wsmaxmessage", 0, "Maximum size in bytes of WebSocket messages.")
+	fs.IntVar(&c.HTTPMaxBodySize, "httpmaxbody", 0, "Maximum size in bytes of HTTP request bodies.")
+	fs.IntVar(&c.MaxCallParamsSize, "maxcallparams", 0, "Maximum size in bytes of call request params.")
+	fs.BoolVar(&c.ConnEvents, "connevents", false, "Publish connection connected and disconnected events.")
+	fs.StringVar(&c.SubjectPrefix, "subjectprefix", "", "Prefix for all NATS subjects sent to or subscribed on.")
 	fs.IntVar(&c.ResetThrottle, "resetthrottle", 0, "Limit on parallel requests sent in response to a system reset.")
+	fs.BoolVar(&c.ResetPriority, "resetpriority", false, "Prioritize throttled reset requests by subscriber count.")
 	fs.IntVar(&c.ReferenceThrottle, "referencethrottle", 0, "Limit on parallel requests sent when following resource references.")
+	fs.IntVar(&c.CacheAuditInterval, "cacheaudit", 0, "Interval in milliseconds between cache audits against services.")
+	fs.BoolVar(&c.CacheAuditCorrect, "cacheauditcorrect", false, "Correct cached resources found diverging by an audit.")
+	fs.StringVar(&c.CacheSnapshot, "cachesnapshot", "", "Cache snapshot file for warm restarts.")
+	fs.IntVar(&c.CacheSnapshotMaxAge, "cachesnapshotmaxage", 0, "Max age in milliseconds of a cache snapshot.")
+	fs.Var(&cacheWarmUp, "cachewarmup", "Resource ID or pattern of resources to fetch and keep in cache.")
 	fs.BoolVar(&c.Debug, "D", false, "Enable debugging output.")
 	fs.BoolVar(&c.Debug, "debug", false, "Enable debugging output.")
 	fs.BoolVar(&c.Trace, "V", false, "Enable trace logging.")
@@ -251,6 +298,10 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 			setString(wsheadauth, &c.WSHeaderAuth)
 		case "natsrootca":
 			c.NatsRootCAs = natsRootCAs
+		case "cachewarmup":
+			c.CacheWarmUp = cacheWarmUp
+		case "trustedproxy":
+			c.TrustedProxies = trustedProxy
 		case "alloworigin":
 			str := allowOrigin.String()
 			c.AllowOrigin = &str
@@ -260,6 +311,12 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 			setString(deleteMethod, &c.DELETEMethod)
 		case "patchmethod":
 			setString(patchMethod, &c.PATCHMethod)
+		case "graphqlpath":
+			setString(graphqlPath, &c.GraphQLPath)
+		case "openapipath":
+			setString(openAPIPath, &c.OpenAPIPath)
+		case "openapiresource":
+			c.OpenAPIResources = openAPIRes
 		case "i":
 			fallthrough
 		case "addr":
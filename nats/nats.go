@@ -212,6 +212,18 @@ func (c *Client) SendRequest(subj string, payload []byte, cb mq.Response) {
 	c.mqReqs[sub] = &responseCont{isReq: true, f: cb}
 }
 
+// Publish publishes a message to the MQ.
+func (c *Client) Publish(subj string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mq == nil {
+		return nats.ErrConnectionClosed
+	}
+	c.Tracef("<=P %s: %s", subj, payload)
+	return c.mq.Publish(subj, payload)
+}
+
 // Subscribe to all events on a resource namespace.
 // The namespace has the format "event."+resource
 func (c *Client) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
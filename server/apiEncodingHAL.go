@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func init() {
+	RegisterAPIEncoderFactory("hal", func(cfg Config) APIEncoder {
+		e := &encoderHAL{apiPath: cfg.APIPath}
+		e.notFoundBytes = e.EncodeError(reserr.ErrNotFound)
+		return e
+	})
+}
+
+// encoderHAL encodes resources as HAL documents.
+//
+// Models are encoded with their primitive and data values as properties, and
+// resource references as links, with referenced resources embedded. Since
+// HAL documents are objects, collections are encoded with all values in a
+// values property, using links for references, and the referenced resources
+// embedded in order as items. Model properties that would overwrite the
+// reserved _links and _embedded members, or the self link, are omitted.
+// Errors are encoded using vnd.error.
+type encoderHAL struct {
+	apiPath       string
+	notFoundBytes []byte
+}
+
+type halLink struct {
+	Href string `json:"href"`
+}
+
+type halError struct {
+	Links   map[string]interface{} `json:"_links,omitempty"`
+	Message string                 `json:"message"`
+	Logref  string                 `json:"logref"`
+	Data    interface{}            `json:"data,omitempty"`
+}
+
+// halEncoding holds the state while encoding a single document.
+type halEncoding struct {
+	apiPath string
+	path    []string
+}
+
+func (e *encoderHAL) ContentType() string {
+	return "application/hal+json"
+}
+
+func (e *encoderHAL) EncodeGET(s *Subscription) ([]byte, error) {
+	enc := halEncoding{apiPath: e.apiPath}
+	return json.Marshal(enc.resource(s))
+}
+
+func (e *encoderHAL) EncodePOST(r json.RawMessage) ([]byte, error) {
+	if bytes.Equal(r, nullBytes) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (e *encoderHAL) EncodeError(rerr *reserr.Error) []byte {
+	out, err := json.Marshal(halError{
+		Message: rerr.Message,
+		Logref:  rerr.Code,
+		Data:    rerr.Data,
+	})
+	if err != nil {
+		return e.EncodeError(reserr.RESError(err))
+	}
+	return out
+}
+
+func (e *encoderHAL) NotFoundError() []byte {
+	return e.notFoundBytes
+}
+
+func (enc *halEncoding) link(rid string) *halLink {
+	return &halLink{Href: RIDToPath(rid, enc.apiPath)}
+}
+
+// resource returns the HAL resource object of a subscription, embedding any
+// referenced resources that are not cyclic.
+func (enc *halEncoding) resource(s *Subscription) map[string]interface{} {
+	rid := s.RID()
+	links := map[string]interface{}{"self": enc.link(rid)}
+	r := map[string]interface{}{"_links": links}
+
+	enc.path = append(enc.path, rid)
+	defer func() { enc.path = enc.path[:len(enc.path)-1] }()
+
+	switch s.ResourceType() {
+	case rescache.TypeCollection:
+		vals := s.CollectionValues()
+		values := make([]interface{}, len(vals))
+		var items []*halLink
+		var embedded []interface{}
+		for i, v := range vals {
+			switch v.Type {
+			case codec.ValueTypeReference:
+				values[i] = enc.link(v.RID)
+				items = append(items, enc.link(v.RID))
+				if containsString(enc.path, v.RID) {
+					embedded = append(embedded, map[string]interface{}{"_links": map[string]interface{}{"self": enc.link(v.RID)}})
+				} else {
+					embedded = append(embedded, enc.embed(s.Ref(v.RID)))
+				}
+			case codec.ValueTypeSoftReference:
+				values[i] = enc.link(v.RID)
+			case codec.ValueTypeData:
+				values[i] = v.Inner
+			default:
+				values[i] = v.RawMessage
+			}
+		}
+		r["values"] = values
+		if items != nil {
+			links["items"] = items
+			r["_embedded"] = map[string]interface{}{"items": embedded}
+		}
+
+	case rescache.TypeModel:
+		var embedded map[string]interface{}
+		for k, v := range s.ModelValues() {
+			if isHALReserved(k, v) {
+				continue
+			}
+			switch v.Type {
+			case codec.ValueTypeReference:
+				links[k] = enc.link(v.RID)
+				if !containsString(enc.path, v.RID) {
+					if embedded == nil {
+						embedded = make(map[string]interface{})
+					}
+					embedded[k] = enc.embed(s.Ref(v.RID))
+				}
+			case codec.ValueTypeSoftReference:
+				links[k] = enc.link(v.RID)
+			case codec.ValueTypeData:
+				r[k] = v.Inner
+			default:
+				r[k] = v.RawMessage
+			}
+		}
+		if embedded != nil {
+			r["_embedded"] = embedded
+		}
+	}
+	return r
+}
+
+// isHALReserved reports whether a model property would overwrite a reserved
+// member of the HAL resource object, or its self link.
+func isHALReserved(k string, v codec.Value) bool {
+	if v.Type == codec.ValueTypeReference || v.Type == codec.ValueTypeSoftReference {
+		return k == "self"
+	}
+	return k == "_links" || k == "_embedded"
+}
+
+// embed returns the embedded resource object of a referenced resource, or a
+// vnd.error object if the resource has an error.
+func (enc *halEncoding) embed(s *Subscription) interface{} {
+	if err := s.Error(); err != nil {
+		rerr := reserr.RESError(err)
+		return halError{
+			Links:   map[string]interface{}{"self": enc.link(s.RID())},
+			Message: rerr.Message,
+			Logref:  rerr.Code,
+			Data:    rerr.Data,
+		}
+	}
+	return enc.resource(s)
+}
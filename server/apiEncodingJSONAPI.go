@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// JSON:API resource object types.
+const (
+	jsonAPITypeModel      = "model"
+	jsonAPITypeCollection = "collection"
+)
+
+func init() {
+	RegisterAPIEncoderFactory("jsonapi", func(cfg Config) APIEncoder {
+		e := &encoderJSONAPI{apiPath: cfg.APIPath}
+		e.notFoundBytes = e.EncodeError(reserr.ErrNotFound)
+		return e
+	})
+}
+
+// encoderJSONAPI encodes resources as JSON:API documents.
+//
+// Models are encoded as resource objects with the primitive and data values
+// as attributes, and resource references as relationships. Collections are
+// encoded as resource objects with a values attribute holding all values,
+// using RES value notation for references, and an items relationship to the
+// referenced resources. Referenced resources are added to included. Model
+// properties named id or type, which JSON:API forbids as field names, are
+// added to the resource object meta instead, with references in RES value
+// notation.
+type encoderJSONAPI struct {
+	apiPath       string
+	notFoundBytes []byte
+}
+
+type jsonAPIDocument struct {
+	Data     *jsonAPIResource   `json:"data"`
+	Included []*jsonAPIResource `json:"included,omitempty"`
+	Links    *jsonAPILinks      `json:"links,omitempty"`
+}
+
+type jsonAPIResource struct {
+	Type          string                          `json:"type"`
+	ID            string                          `json:"id"`
+	Attributes    map[string]json.RawMessage      `json:"attributes,omitempty"`
+	Relationships map[string]*jsonAPIRelationship `json:"relationships,omitempty"`
+	Links         *jsonAPILinks                   `json:"links,omitempty"`
+	Meta          map[string]json.RawMessage      `json:"meta,omitempty"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonAPIRelationship struct {
+	Data  interface{}            `json:"data,omitempty"`
+	Links *jsonAPILinks          `json:"links,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+}
+
+type jsonAPILinks struct {
+	Self    string `json:"self,omitempty"`
+	Related string `json:"related,omitempty"`
+}
+
+type jsonAPIError struct {
+	Status string      `json:"status"`
+	Code   string      `json:"code"`
+	Title  string      `json:"title"`
+	Meta   interface{} `json:"meta,omitempty"`
+}
+
+// jsonAPIEncoding holds the state while encoding a single document.
+type jsonAPIEncoding struct {
+	apiPath string
+	seen    map[string]bool
+	queue   []*Subscription
+}
+
+func (e *encoderJSONAPI) ContentType() string {
+	return "application/vnd.api+json"
+}
+
+func (e *encoderJSONAPI) EncodeGET(s *Subscription) ([]byte, error) {
+	enc := jsonAPIEncoding{
+		apiPath: e.apiPath,
+		seen:    map[string]bool{s.RID(): true},
+	}
+	doc := jsonAPIDocument{
+		Data:  enc.resourceObject(s),
+		Links: &jsonAPILinks{Self: RIDToPath(s.RID(), e.apiPath)},
+	}
+	for len(enc.queue) > 0 {
+		sc := enc.queue[0]
+		enc.queue = enc.queue[1:]
+		doc.Included = append(doc.Included, enc.resourceObject(sc))
+	}
+	return json.Marshal(doc)
+}
+
+func (e *encoderJSONAPI) EncodePOST(r json.RawMessage) ([]byte, error) {
+	if bytes.Equal(r, nullBytes) {
+		return nil, nil
+	}
+	return json.Marshal(map[string]map[string]json.RawMessage{
+		"meta": {"result": r},
+	})
+}
+
+func (e *encoderJSONAPI) EncodeError(rerr *reserr.Error) []byte {
+	_, status := errorStatus(rerr)
+	jerr := jsonAPIError{
+		Status: strconv.Itoa(status),
+		Code:   rerr.Code,
+		Title:  rerr.Message,
+	}
+	if rerr.Data != nil {
+		jerr.Meta = map[string]interface{}{"data": rerr.Data}
+	}
+	out, err := json.Marshal(struct {
+		Errors []jsonAPIError `json:"errors"`
+	}{[]jsonAPIError{jerr}})
+	if err != nil {
+		return e.EncodeError(reserr.RESError(err))
+	}
+	return out
+}
+
+func (e *encoderJSONAPI) NotFoundError() []byte {
+	return e.notFoundBytes
+}
+
+// resourceObject returns the resource object of a subscription, and queues
+// any referenced resources not yet seen to be included.
+func (enc *jsonAPIEncoding) resourceObject(s *Subscription) *jsonAPIResource {
+	rid := s.RID()
+	r := &jsonAPIResource{
+		ID:    rid,
+		Links: &jsonAPILinks{Self: RIDToPath(rid, enc.apiPath)},
+	}
+
+	switch s.ResourceType() {
+	case rescache.TypeCollection:
+		r.Type = jsonAPITypeCollection
+		vals := s.CollectionValues()
+		var b bytes.Buffer
+		var items []*jsonAPIIdentifier
+		b.WriteByte('[')
+		for i, v := range vals {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			switch v.Type {
+			case codec.ValueTypeData:
+				b.Write(v.Inner)
+			default:
+				b.Write(v.RawMessage)
+			}
+			if v.Type == codec.ValueTypeReference {
+				if id := enc.reference(s, v.RID); id != nil && !containsIdentifier(items, id) {
+					items = append(items, id)
+				}
+			}
+		}
+		b.WriteByte(']')
+		r.Attributes = map[string]json.RawMessage{"values": b.Bytes()}
+		if items != nil {
+			r.Relationships = map[string]*jsonAPIRelationship{"items": {Data: items}}
+		}
+
+	case rescache.TypeModel:
+		r.Type = jsonAPITypeModel
+		vals := s.ModelValues()
+		keys := make([]string, 0, len(vals))
+		for k := range vals {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := vals[k]
+			if k == "id" || k == "type" {
+				if v.Type == codec.ValueTypeData {
+					r.addMeta(k, v.Inner)
+				} else {
+					r.addMeta(k, v.RawMessage)
+				}
+				continue
+			}
+			switch v.Type {
+			case codec.ValueTypeReference:
+				rel := &jsonAPIRelationship{Links: &jsonAPILinks{Related: RIDToPath(v.RID, enc.apiPath)}}
+				if id := enc.reference(s, v.RID); id != nil {
+					rel.Data = id
+				} else {
+					rel.Meta = map[string]interface{}{"error": reserr.RESError(s.Ref(v.RID).Error())}
+				}
+				r.addRelationship(k, rel)
+			case codec.ValueTypeSoftReference:
+				r.addRelationship(k, &jsonAPIRelationship{Links: &jsonAPILinks{Related: RIDToPath(v.RID, enc.apiPath)}})
+			case codec.ValueTypeData:
+				r.addAttribute(k, v.Inner)
+			default:
+				r.addAttribute(k, v.RawMessage)
+			}
+		}
+	}
+	return r
+}
+
+// reference returns the resource identifier of a referenced resource, and
+// queues it to be included. If the referenced resource has an error, nil is
+// returned.
+func (enc *jsonAPIEncoding) reference(s *Subscription, rid string) *jsonAPIIdentifier {
+	sc := s.Ref(rid)
+	if sc.Error() != nil {
+		return nil
+	}
+	typ := jsonAPITypeModel
+	if sc.ResourceType() == rescache.TypeCollection {
+		typ = jsonAPITypeCollection
+	}
+	if !enc.seen[rid] {
+		enc.seen[rid] = true
+		enc.queue = append(enc.queue, sc)
+	}
+	return &jsonAPIIdentifier{Type: typ, ID: rid}
+}
+
+func (r *jsonAPIResource) addMeta(k string, v json.RawMessage) {
+	if r.Meta == nil {
+		r.Meta = make(map[string]json.RawMessage)
+	}
+	r.Meta[k] = v
+}
+
+func (r *jsonAPIResource) addAttribute(k string, v json.RawMessage) {
+	if r.Attributes == nil {
+		r.Attributes = make(map[string]json.RawMessage)
+	}
+	r.Attributes[k] = v
+}
+
+func (r *jsonAPIResource) addRelationship(k string, rel *jsonAPIRelationship) {
+	if r.Relationships == nil {
+		r.Relationships = make(map[string]*jsonAPIRelationship)
+	}
+	r.Relationships[k] = rel
+}
+
+func containsIdentifier(ids []*jsonAPIIdentifier, id *jsonAPIIdentifier) bool {
+	for _, v := range ids {
+		if v.ID == id.ID {
+			return true
+		}
+	}
+	return false
+}
@@ -56,7 +56,7 @@ func (s *Service) setCommonHeaders(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
-func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request, t *tenant) {
 	err := s.setCommonHeaders(w, r)
 	if r.Method == "OPTIONS" {
 		w.Header().Set("Access-Control-Allow-Methods", s.cfg.allowMethods)
@@ -76,7 +76,7 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 		path = r.URL.Path
 	}
 
-	apiPath := s.cfg.APIPath
+	apiPath := t.apiPath
 
 	// NotFound on paths with trailing slash (unless it is only the APIPath)
 	if len(path) > len(apiPath) && path[len(path)-1] == '/' {
@@ -100,11 +100,11 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		s.temporaryConn(w, r, func(c *wsConn, cb func([]byte, string, error, *codec.Meta)) {
+		s.temporaryConn(w, r, t, func(c *wsConn, cb func([]byte, string, error, *codec.Meta)) {
 			c.GetHTTPSubscription(rid, func(sub *Subscription, meta *codec.Meta, err error) {
 				var b []byte
 				if err == nil && !meta.IsDirectResponseStatus() {
-					b, err = s.enc.EncodeGET(sub)
+					b, err = t.enc.EncodeGET(sub)
 				}
 				cb(b, "", err, meta)
 			})
@@ -149,7 +149,7 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 		action = *m
 	}
 
-	s.handleCall(w, r, rid, action)
+	s.handleCall(w, r, t, rid, action)
 }
 
 func notFoundHandler(w http.ResponseWriter, enc APIEncoder) {
@@ -158,15 +158,20 @@ func notFoundHandler(w http.ResponseWriter, enc APIEncoder) {
 	w.Write(enc.NotFoundError())
 }
 
-func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, rid string, action string) {
+func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, t *tenant, rid string, action string) {
 	if !codec.IsValidRID(rid, true) || !codec.IsValidRIDPart(action) {
 		notFoundHandler(w, s.enc)
 		return
 	}
 
 	// Try to parse the body
+	s.limitBody(w, r)
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
+		if s.isBodyTooLargeError(err) {
+			httpStatusResponse(w, s.enc, http.StatusRequestEntityTooLarge, nil, "", errBodyTooLarge)
+			return
+		}
 		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}, s.enc)
 		return
 	}
@@ -180,13 +185,23 @@ func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, rid string,
 		}
 	}
 
-	s.temporaryConn(w, r, func(c *wsConn, cb func([]byte, string, error, *codec.Meta)) {
+	if err := s.checkParamsSize(params); err != nil {
+		httpStatusResponse(w, s.enc, http.StatusRequestEntityTooLarge, nil, "", err)
+		return
+	}
+
+	if err := s.validateCallParams(rid, action, params); err != nil {
+		httpError(w, err, s.enc)
+		return
+	}
+
+	s.temporaryConn(w, r, t, func(c *wsConn, cb func([]byte, string, error, *codec.Meta)) {
 		c.CallHTTPResource(rid, action, params, func(r json.RawMessage, refRID string, err error, meta *codec.Meta) {
 			var b []byte
 			if err == nil && refRID == "" && !meta.IsDirectResponseStatus() {
-				b, err = s.enc.EncodePOST(r)
+				b, err = t.enc.EncodePOST(r)
 			}
-			cb(b, RIDToPath(refRID, s.cfg.APIPath), err, meta)
+			cb(b, RIDToPath(refRID, t.apiPath), err, meta)
 		})
 	})
 }
@@ -199,8 +214,8 @@ func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, rid string,
 // * href - If not empty, it will be used as Location for a Found response
 // * err  - If not empty, it will be encoded into an error for an error response based on the error code
 // * meta - If not empty, may change the behavior of all the others.
-func (s *Service) temporaryConn(w http.ResponseWriter, r *http.Request, cb func(*wsConn, func(out []byte, href string, err error, meta *codec.Meta))) {
-	c := s.newWSConn(r, versionLatest)
+func (s *Service) temporaryConn(w http.ResponseWriter, r *http.Request, t *tenant, cb func(*wsConn, func(out []byte, href string, err error, meta *codec.Meta))) {
+	c := s.newWSConn(r, t, versionLatest)
 	if c == nil {
 		httpError(w, reserr.ErrServiceUnavailable, s.enc)
 		return
@@ -263,7 +278,7 @@ func (s *Service) temporaryConn(w http.ResponseWriter, r *http.Request, cb func(
 		if s.cfg.HeaderAuth != nil {
 			c.AuthResourceNoResult(s.cfg.headerAuthRID, s.cfg.headerAuthAction, nil, func(refRID string, err error, m *codec.Meta) {
 				if m.IsDirectResponseStatus() {
-					httpStatusResponse(w, s.enc, *m.Status, m.Header, RIDToPath(refRID, s.cfg.APIPath), err)
+					httpStatusResponse(w, s.enc, *m.Status, m.Header, RIDToPath(refRID, t.apiPath), err)
 					c.dispose()
 					close(done)
 					return
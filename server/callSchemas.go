@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/resgateio/resgate/server/jsonschema"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// callSchema is a compiled CallSchemaRule.
+type callSchema struct {
+	pattern rescache.ResourcePattern
+	method  string
+	schema  *jsonschema.Schema
+}
+
+// validateCallParams validates the params of a call request against the
+// schema of the first rule matching the resource and method. It returns a
+// system.invalidParams error, with the validation errors as data, if the
+// params are invalid.
+func (s *Service) validateCallParams(rid, action string, params interface{}) error {
+	if len(s.cfg.callSchemas) == 0 {
+		return nil
+	}
+	rname, _ := parseRID(rid)
+	for _, cs := range s.cfg.callSchemas {
+		if cs.method == action && cs.pattern.Match(rname) {
+			return validateParams(cs.schema, params)
+		}
+	}
+	return nil
+}
+
+func validateParams(schema *jsonschema.Schema, params interface{}) error {
+	var data []byte
+	switch p := params.(type) {
+	case nil:
+	case json.RawMessage:
+		data = p
+	default:
+		var err error
+		if data, err = json.Marshal(p); err != nil {
+			return reserr.RESError(err)
+		}
+	}
+	// Missing params are validated as null
+	if len(data) == 0 {
+		data = nullBytes
+	}
+
+	errs, err := schema.ValidateJSON(data)
+	if err != nil {
+		return reserr.ErrInvalidParams
+	}
+	if errs != nil {
+		return &reserr.Error{Code: reserr.CodeInvalidParams, Message: reserr.ErrInvalidParams.Message, Data: errs}
+	}
+	return nil
+}
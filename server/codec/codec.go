@@ -2,6 +2,8 @@ package codec
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -10,6 +12,11 @@ import (
 	"github.com/resgateio/resgate/server/reserr"
 )
 
+// ConnEventRID is the resource name used for connection events sent to
+// clients, such as conn.message. It is reserved, and not a valid resource
+// name.
+const ConnEventRID = "conn"
+
 var (
 	noQueryGetRequest               = []byte(`{}`)
 	errMissingResult                = reserr.InternalError(errors.New("response missing result"))
@@ -82,6 +89,7 @@ type GetResult struct {
 	Model      map[string]Value `json:"model"`
 	Collection []Value          `json:"collection"`
 	Query      string           `json:"query"`
+	Seq        uint64           `json:"seq"`
 }
 
 // AuthRequest represents a RES-service auth request
@@ -92,6 +100,19 @@ type AuthRequest struct {
 	Host       string      `json:"host,omitempty"`
 	RemoteAddr string      `json:"remoteAddr,omitempty"`
 	URI        string      `json:"uri,omitempty"`
+	Scheme     string      `json:"scheme,omitempty"`
+	Cert       *ClientCert `json:"cert,omitempty"`
+}
+
+// ClientCert represents a verified TLS client certificate in an auth request
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#auth-request
+type ClientCert struct {
+	Subject        string   `json:"subject"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	Fingerprint    string   `json:"fingerprint"`
 }
 
 // NewResponse represents the response of a RES-service new call request
@@ -124,6 +145,31 @@ type EventQueryResponse struct {
 	Error  *reserr.Error     `json:"error"`
 }
 
+// SchemaResponse represents the response of a RES-service schema request
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#schema-request
+type SchemaResponse struct {
+	Result *SchemaResult `json:"result"`
+	Error  *reserr.Error `json:"error"`
+}
+
+// SchemaResult represents the response's result part of a RES-service schema
+// request
+type SchemaResult struct {
+	Type        string                   `json:"type"`
+	Title       string                   `json:"title"`
+	Description string                   `json:"description"`
+	Schema      json.RawMessage          `json:"schema"`
+	Methods     map[string]*SchemaMethod `json:"methods"`
+}
+
+// SchemaMethod represents a call method described in the result of a
+// RES-service schema request
+type SchemaMethod struct {
+	Description string          `json:"description"`
+	Params      json.RawMessage `json:"params"`
+	Result      json.RawMessage `json:"result"`
+}
+
 // EventQueryResult represent the response's result part of a RES-service
 // query request
 type EventQueryResult struct {
@@ -145,6 +191,31 @@ type ConnTokenEvent struct {
 	TID   string          `json:"tid"`
 }
 
+// ConnDisconnectEvent represents a RES-server connection disconnect event
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#connection-disconnect-event
+type ConnDisconnectEvent struct {
+	Reason string `json:"reason"`
+}
+
+// ConnConnectedEvent represents a connection connected event published by
+// Resgate
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#connection-connected-event
+type ConnConnectedEvent struct {
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Protocol   string `json:"protocol"`
+	TID        string `json:"tid,omitempty"`
+}
+
+// ConnDisconnectedEvent represents a connection disconnected event published
+// by Resgate
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#connection-disconnected-event
+type ConnDisconnectedEvent struct {
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Protocol   string `json:"protocol"`
+	TID        string `json:"tid,omitempty"`
+	Duration   int64  `json:"duration"`
+}
+
 // ChangeEvent represent a RES-server model change event
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#model-change-event
 type ChangeEvent struct {
@@ -158,12 +229,26 @@ type AddEvent struct {
 	Value Value `json:"value"`
 }
 
+// EventSequence represents the optional sequence number of a RES-service
+// resource event.
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#event-sequence
+type EventSequence struct {
+	Seq uint64 `json:"seq"`
+}
+
 // RemoveEvent represent a RES-server collection remove event
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#collection-remove-event
 type RemoveEvent struct {
 	Idx int `json:"idx"`
 }
 
+// MoveEvent represent a RES-server collection move event
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#collection-move-event
+type MoveEvent struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
 // SystemReset represents a RES-server system reset event
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-reset-event
 type SystemReset struct {
@@ -199,6 +284,7 @@ type ValueType byte
 const (
 	ValueTypeNone ValueType = iota
 	ValueTypeDelete
+	ValueTypePatch
 	ValueTypePrimitive
 	ValueTypeReference
 	ValueTypeSoftReference
@@ -214,12 +300,14 @@ type Value struct {
 	Inner json.RawMessage
 }
 
-// ValueObject represents a resource reference or an action
+// ValueObject represents a resource reference, an action, a data value, or a
+// patch.
 type ValueObject struct {
 	RID    *string         `json:"rid"`
 	Soft   bool            `json:"soft"`
 	Action *string         `json:"action"`
 	Data   json.RawMessage `json:"data"`
+	Patch  json.RawMessage `json:"patch"`
 }
 
 // IsProper returns true if the value's type is either a primitive, a
@@ -265,8 +353,8 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 			if *mvo.RID == "" {
 				return errInvalidValueEmptyRID
 			}
-			// Invalid to have both RID and Action or Data set
-			if mvo.Action != nil || mvo.Data != nil {
+			// Invalid to have both RID and Action, Data, or Patch set
+			if mvo.Action != nil || mvo.Data != nil || mvo.Patch != nil {
 				return errInvalidValueAmbiguous
 			}
 			v.RID = *mvo.RID
@@ -279,8 +367,8 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 				v.Type = ValueTypeReference
 			}
 		case mvo.Action != nil:
-			// Invalid to have both Action and Data set, or if action is not actionDelete
-			if mvo.Data != nil {
+			// Invalid to have both Action and Data or Patch set, or if action is not actionDelete
+			if mvo.Data != nil || mvo.Patch != nil {
 				return errInvalidValueAmbiguous
 			}
 			if *mvo.Action != actionDelete {
@@ -288,6 +376,10 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 			}
 			v.Type = ValueTypeDelete
 		case mvo.Data != nil:
+			// Invalid to have both Data and Patch set
+			if mvo.Patch != nil {
+				return errInvalidValueAmbiguous
+			}
 			v.Inner = mvo.Data
 			dc := mvo.Data[0]
 			// Is data containing a primitive?
@@ -297,6 +389,9 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 				v.RawMessage = mvo.Data
 				v.Type = ValueTypePrimitive
 			}
+		case mvo.Patch != nil:
+			v.Inner = mvo.Patch
+			v.Type = ValueTypePatch
 		default:
 			return errInvalidValueObjectNotAllowed
 		}
@@ -316,6 +411,8 @@ func (v Value) Equal(w Value) bool {
 	}
 
 	switch v.Type {
+	case ValueTypePatch:
+		fallthrough
 	case ValueTypeData:
 		fallthrough
 	case ValueTypePrimitive:
@@ -442,6 +539,11 @@ func CreateGetRequest(query string) []byte {
 	return out
 }
 
+// CreateSchemaRequest creates a JSON encoded RES-service schema request
+func CreateSchemaRequest() []byte {
+	return []byte(`{}`)
+}
+
 // CreateAuthRequest creates a JSON encoded RES-service auth request
 func CreateAuthRequest(params interface{}, r AuthRequester, query string, token interface{}, isHTTP bool) []byte {
 	hr := r.HTTPRequest()
@@ -451,10 +553,46 @@ func CreateAuthRequest(params interface{}, r AuthRequester, query string, token
 		Host:       hr.Host,
 		RemoteAddr: hr.RemoteAddr,
 		URI:        hr.RequestURI,
+		Scheme:     requestScheme(hr),
+		Cert:       clientCert(hr),
 	})
 	return out
 }
 
+// clientCert returns the verified TLS client certificate of the HTTP request,
+// or nil if the client has no verified certificate.
+func clientCert(hr *http.Request) *ClientCert {
+	if hr.TLS == nil || len(hr.TLS.VerifiedChains) == 0 || len(hr.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := hr.TLS.PeerCertificates[0]
+	fp := sha256.Sum256(cert.Raw)
+	cc := &ClientCert{
+		Subject:        cert.Subject.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Fingerprint:    hex.EncodeToString(fp[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		cc.IPAddresses = append(cc.IPAddresses, ip.String())
+	}
+	for _, u := range cert.URIs {
+		cc.URIs = append(cc.URIs, u.String())
+	}
+	return cc
+}
+
+// requestScheme returns the scheme used by the client for the HTTP request.
+func requestScheme(hr *http.Request) string {
+	if hr.URL != nil && hr.URL.Scheme != "" {
+		return hr.URL.Scheme
+	}
+	if hr.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
 // DecodeGetResponse decodes a JSON encoded RES-service get response
 func DecodeGetResponse(payload []byte) (*GetResult, error) {
 	var r GetResponse
@@ -572,6 +710,35 @@ func DecodeEventQueryResponse(payload []byte) (*EventQueryResult, error) {
 	return res, nil
 }
 
+// DecodeSchemaResponse decodes a JSON encoded RES-service schema response
+func DecodeSchemaResponse(payload []byte) (*SchemaResult, error) {
+	var r SchemaResponse
+	err := json.Unmarshal(payload, &r)
+	if err != nil {
+		return nil, reserr.RESError(err)
+	}
+
+	if r.Error != nil {
+		return nil, r.Error
+	}
+
+	if r.Result == nil {
+		return nil, errMissingResult
+	}
+
+	res := r.Result
+	if res.Type != "model" && res.Type != "collection" {
+		return nil, errInvalidResponse
+	}
+	for m := range res.Methods {
+		if !IsValidRIDPart(m) {
+			return nil, errInvalidResponse
+		}
+	}
+
+	return res, nil
+}
+
 // IsLegacyChangeEvent returns true if the model change event is detected as v1.0 legacy
 // [DEPRECATED:deprecatedModelChangeEvent]
 func IsLegacyChangeEvent(data json.RawMessage) bool {
@@ -581,7 +748,12 @@ func IsLegacyChangeEvent(data json.RawMessage) bool {
 		return false
 	}
 
-	if len(r) != 1 {
+	// The optional sequence number is not part of the legacy format.
+	l := len(r)
+	if _, ok := r["seq"]; ok {
+		l--
+	}
+	if l != 1 {
 		return true
 	}
 
@@ -617,16 +789,30 @@ func DecodeChangeEvent(data json.RawMessage) (map[string]Value, error) {
 }
 
 // DecodeLegacyChangeEvent decodes a JSON encoded RES-service v1.0 model change event
+// The optional sequence number is removed from the changed values.
 func DecodeLegacyChangeEvent(data json.RawMessage) (map[string]Value, error) {
 	var r map[string]Value
 	err := json.Unmarshal(data, &r)
 	if err != nil {
 		return nil, err
 	}
+	delete(r, "seq")
 
 	return r, nil
 }
 
+// DecodeEventSequence decodes the optional sequence number of a JSON encoded
+// RES-service resource event. It returns 0 if the event has no sequence number.
+func DecodeEventSequence(data json.RawMessage) (uint64, error) {
+	var r EventSequence
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Seq, nil
+}
+
 // EncodeAddEvent creates a JSON encoded RES-service collection add event
 func EncodeAddEvent(d *AddEvent) json.RawMessage {
 	data, _ := json.Marshal(d)
@@ -666,6 +852,23 @@ func DecodeRemoveEvent(data json.RawMessage) (*RemoveEvent, error) {
 	return &d, nil
 }
 
+// EncodeMoveEvent creates a JSON encoded RES-service collection move event
+func EncodeMoveEvent(d *MoveEvent) json.RawMessage {
+	data, _ := json.Marshal(d)
+	return json.RawMessage(data)
+}
+
+// DecodeMoveEvent decodes a JSON encoded RES-service collection move event
+func DecodeMoveEvent(data json.RawMessage) (*MoveEvent, error) {
+	var d MoveEvent
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
 // DecodeAccessResponse decodes a JSON encoded RES-service access response
 func DecodeAccessResponse(payload []byte) (*AccessResult, *Meta, *reserr.Error) {
 	var r AccessResponse
@@ -752,6 +955,33 @@ func DecodeConnTokenEvent(payload []byte) (*ConnTokenEvent, error) {
 	return &e, nil
 }
 
+// DecodeConnDisconnectEvent decodes a JSON encoded RES-service connection
+// disconnect event. An empty payload is decoded as an event without reason.
+func DecodeConnDisconnectEvent(payload []byte) (*ConnDisconnectEvent, error) {
+	var e ConnDisconnectEvent
+	if len(payload) == 0 {
+		return &e, nil
+	}
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, reserr.RESError(err)
+	}
+	return &e, nil
+}
+
+// EncodeConnConnectedEvent creates a JSON encoded connection connected event
+func EncodeConnConnectedEvent(e *ConnConnectedEvent) []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// EncodeConnDisconnectedEvent creates a JSON encoded connection disconnected
+// event
+func EncodeConnDisconnectedEvent(e *ConnDisconnectedEvent) []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
 // DecodeSystemReset decodes a JSON encoded RES-service system reset event
 func DecodeSystemReset(data json.RawMessage) (SystemReset, error) {
 	var r SystemReset
@@ -785,12 +1015,13 @@ func DecodeSystemTokenReset(data json.RawMessage) (SystemTokenReset, error) {
 
 // IsValidRID returns true if the RID is valid, otherwise false.
 // If allowQuery flag is false, encountering a question mark (?) will
-// cause IsValidRID to return false.
+// cause IsValidRID to return false. The reserved resource name ConnEventRID
+// is not valid.
 func IsValidRID(rid string, allowQuery bool) bool {
 	start := true
-	for _, r := range rid {
+	for i, r := range rid {
 		if r == '?' {
-			return allowQuery && !start
+			return allowQuery && !start && rid[:i] != ConnEventRID
 		}
 		if r < 33 || r > 126 || r == '*' || r == '>' {
 			return false
@@ -805,7 +1036,7 @@ func IsValidRID(rid string, allowQuery bool) bool {
 		}
 	}
 
-	return !start
+	return !start && rid != ConnEventRID
 }
 
 // IsValidRIDPart returns true if the RID part is valid, otherwise false.
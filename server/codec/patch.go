@@ -0,0 +1,88 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+var errPatchOnNonDataValue = reserr.InternalError(errors.New("patch applied to a value that is not a data value"))
+
+// ApplyPatch applies the JSON Merge Patch (RFC 7386) of the patch value p to
+// the data value v, and returns the resulting value. If the patch causes no
+// change, v is returned together with false.
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#patch-value
+func (v Value) ApplyPatch(p Value) (Value, bool, error) {
+	if v.Type != ValueTypeData {
+		return v, false, errPatchOnNonDataValue
+	}
+	if p.Type != ValueTypePatch {
+		return v, false, errInvalidValue
+	}
+
+	target, err := decodeNumber(v.Inner)
+	if err != nil {
+		return v, false, err
+	}
+	patch, err := decodeNumber(p.Inner)
+	if err != nil {
+		return v, false, err
+	}
+
+	// Encode the target prior to merging, as merging modifies it, to allow a
+	// comparison independent of the original formatting.
+	before, err := json.Marshal(target)
+	if err != nil {
+		return v, false, err
+	}
+	after, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return v, false, err
+	}
+	if bytes.Equal(before, after) {
+		return v, false, nil
+	}
+
+	var nv Value
+	data := make([]byte, 0, len(after)+9)
+	data = append(append(append(data, `{"data":`...), after...), '}')
+	if err := json.Unmarshal(data, &nv); err != nil {
+		return v, false, err
+	}
+	return nv, true, nil
+}
+
+// mergePatch merges patch into target as described by RFC 7386, and returns
+// the result. The target may be modified.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// decodeNumber decodes JSON data, keeping numbers as json.Number to preserve
+// their precision.
+func decodeNumber(data json.RawMessage) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -1,15 +1,22 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"os"
 	"sort"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/jsonschema"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/webhook"
 )
 
 // Config holds server configuration
@@ -26,15 +33,53 @@ type Config struct {
 	PUTMethod    *string `json:"putMethod"`
 	DELETEMethod *string `json:"deleteMethod"`
 	PATCHMethod  *string `json:"patchMethod"`
+	GraphQLPath  *string `json:"graphqlPath"`
+	OpenAPIPath  *string `json:"openApiPath"`
+
+	OpenAPIResources []string `json:"openApiResources"`
 
 	TLS     bool   `json:"tls"`
 	TLSCert string `json:"certFile"`
 	TLSKey  string `json:"keyFile"`
 
+	TLSClientAuth string `json:"clientAuth"`
+	TLSClientCA   string `json:"clientCAFile"`
+
+	TrustedProxies []string `json:"trustedProxies"`
+	ProxyProtocol  bool     `json:"proxyProtocol"`
+
 	WSCompression bool `json:"wsCompression"`
 
-	ResetThrottle     int `json:"resetThrottle"`
-	ReferenceThrottle int `json:"referenceThrottle"`
+	WSPingInterval int `json:"wsPingInterval"`
+	WSPongTimeout  int `json:"wsPongTimeout"`
+	WSIdleTimeout  int `json:"wsIdleTimeout"`
+
+	WSMaxMessageSize  int `json:"wsMaxMessageSize"`
+	HTTPMaxBodySize   int `json:"httpMaxBodySize"`
+	MaxCallParamsSize int `json:"maxCallParamsSize"`
+
+	ConnEvents bool `json:"connEvents"`
+
+	SubjectPrefix string         `json:"subjectPrefix"`
+	Tenants       []TenantConfig `json:"tenants"`
+
+	ResetThrottle     int  `json:"resetThrottle"`
+	ResetPriority     bool `json:"resetPriority"`
+	ReferenceThrottle int  `json:"referenceThrottle"`
+
+	CacheAuditInterval int  `json:"cacheAuditInterval"`
+	CacheAuditCorrect  bool `json:"cacheAuditCorrect"`
+
+	CacheSnapshot       string               `json:"cacheSnapshot"`
+	CacheSnapshotMaxAge int                  `json:"cacheSnapshotMaxAge"`
+	CacheWarmUp         []string             `json:"cacheWarmUp"`
+	CacheRetention      []CacheRetentionRule `json:"cacheRetention"`
+
+	ResourceSchemas []ResourceSchemaRule `json:"resourceSchemas"`
+	CallSchemas     []CallSchemaRule     `json:"callSchemas"`
+
+	Webhooks          []WebhookConfig `json:"webhooks"`
+	WebhookDeadLetter string          `json:"webhookDeadLetter"`
 
 	NoHTTP             bool `json:"-"` // Disable start of the HTTP server. Used for testing
 	NoUnsubscribeDelay bool `json:"-"` // Set remove and unsubscribe from cache delay to 0. Used for testing.
@@ -48,6 +93,57 @@ type Config struct {
 	wsHeaderAuthAction string
 	allowOrigin        []string
 	allowMethods       string
+	graphqlPath        string
+	openAPIPath        string
+	resourceSchemas    []*jsonschema.Schema
+	callSchemas        []callSchema
+	trustedProxies     []*net.IPNet
+	tlsClientAuth      tls.ClientAuthType
+	tlsClientCAs       *x509.CertPool
+}
+
+// CacheRetentionRule sets how long resources matching a pattern are kept in
+// the cache after the last subscription is removed.
+type CacheRetentionRule struct {
+	Pattern string `json:"pattern"`
+	Delay   int    `json:"delay"` // Unsubscribe delay in milliseconds
+	Pin     bool   `json:"pin"`   // Never remove matching resources
+}
+
+// ResourceSchemaRule sets a JSON Schema that models and collections matching
+// the pattern are validated against when received from a service.
+type ResourceSchemaRule struct {
+	Pattern string          `json:"pattern"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// CallSchemaRule sets a JSON Schema that the params of call requests for the
+// method on resources matching the pattern are validated against before being
+// sent to the service.
+type CallSchemaRule struct {
+	Pattern string          `json:"pattern"`
+	Method  string          `json:"method"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// TenantConfig maps clients connecting on a host, or under a path, to a
+// subject prefix used instead of the SubjectPrefix setting.
+type TenantConfig struct {
+	Host          string `json:"host"`          // Host name to match. Empty matches any host.
+	Path          string `json:"path"`          // Path that the tenant's endpoints are served under. Empty means no path.
+	SubjectPrefix string `json:"subjectPrefix"` // Prefix for all NATS subjects of the tenant
+}
+
+// WebhookConfig sets an HTTP endpoint to which events on resources matching
+// any of the patterns are forwarded.
+type WebhookConfig struct {
+	URL        string   `json:"url"`
+	Resources  []string `json:"resources"`  // Resource IDs or resource patterns
+	Events     []string `json:"events"`     // Events to forward. Empty means all events.
+	Secret     string   `json:"secret"`     // Key used to sign requests with HMAC-SHA256
+	MaxRetries *int     `json:"maxRetries"` // Retries after a failed delivery. Nil means default.
+	RetryDelay int      `json:"retryDelay"` // Initial retry delay in milliseconds
+	Timeout    int      `json:"timeout"`    // Request timeout in milliseconds
 }
 
 // SetDefault sets the default values
@@ -88,6 +184,148 @@ func (c *Config) prepare() error {
 		}
 	}
 
+	switch c.TLSClientAuth {
+	case "", "none":
+		c.tlsClientAuth = tls.NoClientCert
+	case "request":
+		c.tlsClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		c.tlsClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("invalid clientAuth setting (%s)\n\tmust be none, request, or require", c.TLSClientAuth)
+	}
+	if c.tlsClientAuth != tls.NoClientCert {
+		if !c.TLS {
+			return fmt.Errorf("invalid clientAuth setting (%s)\n\trequires tls to be enabled", c.TLSClientAuth)
+		}
+		if c.TLSClientCA == "" {
+			return fmt.Errorf("invalid clientAuth setting (%s)\n\trequires clientCAFile to be set", c.TLSClientAuth)
+		}
+		pool, err := loadCertPool(c.TLSClientCA)
+		if err != nil {
+			return fmt.Errorf("invalid clientCAFile setting (%s)\n\t%s", c.TLSClientCA, err)
+		}
+		c.tlsClientCAs = pool
+	} else {
+		c.tlsClientCAs = nil
+	}
+
+	if c.WSPingInterval < 0 {
+		return fmt.Errorf("invalid wsPingInterval setting (%d)\n\tmust be zero or a positive number of milliseconds", c.WSPingInterval)
+	}
+	if c.WSPongTimeout < 0 {
+		return fmt.Errorf("invalid wsPongTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.WSPongTimeout)
+	}
+	if c.WSPongTimeout > 0 && c.WSPingInterval == 0 {
+		return fmt.Errorf("invalid wsPongTimeout setting (%d)\n\trequires wsPingInterval to be set", c.WSPongTimeout)
+	}
+	if c.WSIdleTimeout < 0 {
+		return fmt.Errorf("invalid wsIdleTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.WSIdleTimeout)
+	}
+
+	if c.WSMaxMessageSize < 0 {
+		return fmt.Errorf("invalid wsMaxMessageSize setting (%d)\n\tmust be zero or a positive number of bytes", c.WSMaxMessageSize)
+	}
+	if c.HTTPMaxBodySize < 0 {
+		return fmt.Errorf("invalid httpMaxBodySize setting (%d)\n\tmust be zero or a positive number of bytes", c.HTTPMaxBodySize)
+	}
+	if c.MaxCallParamsSize < 0 {
+		return fmt.Errorf("invalid maxCallParamsSize setting (%d)\n\tmust be zero or a positive number of bytes", c.MaxCallParamsSize)
+	}
+
+	c.trustedProxies = nil
+	for _, p := range c.TrustedProxies {
+		ipnet, err := parseTrustedProxy(p)
+		if err != nil {
+			return fmt.Errorf("invalid trustedProxies setting (%s)\n\tmust be an IP address or a CIDR notation IP address and prefix length", p)
+		}
+		c.trustedProxies = append(c.trustedProxies, ipnet)
+	}
+	if c.ProxyProtocol && len(c.trustedProxies) == 0 {
+		return fmt.Errorf("invalid proxyProtocol setting (%t)\n\trequires trustedProxies to be set", c.ProxyProtocol)
+	}
+
+	if c.SubjectPrefix != "" && !isValidSubjectPrefix(c.SubjectPrefix) {
+		return fmt.Errorf("invalid subjectPrefix setting (%s)\n\tmust be dot-separated tokens without wildcards", c.SubjectPrefix)
+	}
+
+	for i, t := range c.Tenants {
+		if err := t.validate(); err != nil {
+			return err
+		}
+		if t.SubjectPrefix == c.SubjectPrefix {
+			return fmt.Errorf("invalid tenant subjectPrefix (%s)\n\tmust differ from the subjectPrefix setting", t.SubjectPrefix)
+		}
+		for _, o := range c.Tenants[:i] {
+			if o.SubjectPrefix == t.SubjectPrefix {
+				return fmt.Errorf("invalid tenant subjectPrefix (%s)\n\tmust not be used by more than one tenant", t.SubjectPrefix)
+			}
+			if strings.EqualFold(o.Host, t.Host) && o.Path == t.Path {
+				return fmt.Errorf("invalid tenant setting for subjectPrefix %s\n\thost and path must differ from those of tenant %s", t.SubjectPrefix, o.SubjectPrefix)
+			}
+		}
+	}
+
+	if c.CacheAuditInterval < 0 {
+		return fmt.Errorf("invalid cacheAuditInterval setting (%d)\n\tmust be zero or a positive number of milliseconds", c.CacheAuditInterval)
+	}
+
+	if c.CacheSnapshotMaxAge < 0 {
+		return fmt.Errorf("invalid cacheSnapshotMaxAge setting (%d)\n\tmust be zero or a positive number of milliseconds", c.CacheSnapshotMaxAge)
+	}
+
+	for _, p := range c.CacheWarmUp {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid cacheWarmUp setting (%s)\n\tmust be a valid resource ID or resource pattern", p)
+		}
+	}
+
+	for _, r := range c.CacheRetention {
+		if !rescache.ParseResourcePattern(r.Pattern).IsValid() {
+			return fmt.Errorf("invalid cacheRetention pattern (%s)\n\tmust be a valid resource ID or resource pattern", r.Pattern)
+		}
+		if r.Delay < 0 {
+			return fmt.Errorf("invalid cacheRetention delay (%d) for pattern %s\n\tmust be zero or a positive number of milliseconds", r.Delay, r.Pattern)
+		}
+		if r.Pin && r.Delay != 0 {
+			return fmt.Errorf("invalid cacheRetention rule for pattern %s\n\tpin must not be used together with delay", r.Pattern)
+		}
+	}
+
+	c.resourceSchemas = make([]*jsonschema.Schema, len(c.ResourceSchemas))
+	for i, r := range c.ResourceSchemas {
+		if !rescache.ParseResourcePattern(r.Pattern).IsValid() {
+			return fmt.Errorf("invalid resourceSchemas pattern (%s)\n\tmust be a valid resource ID or resource pattern", r.Pattern)
+		}
+		schema, err := jsonschema.Compile(r.Schema)
+		if err != nil {
+			return fmt.Errorf("invalid resourceSchemas schema for pattern %s\n\t%s", r.Pattern, err)
+		}
+		c.resourceSchemas[i] = schema
+	}
+
+	c.callSchemas = make([]callSchema, len(c.CallSchemas))
+	for i, r := range c.CallSchemas {
+		pattern := rescache.ParseResourcePattern(r.Pattern)
+		if !pattern.IsValid() {
+			return fmt.Errorf("invalid callSchemas pattern (%s)\n\tmust be a valid resource ID or resource pattern", r.Pattern)
+		}
+		if !codec.IsValidRIDPart(r.Method) {
+			return fmt.Errorf("invalid callSchemas method (%s) for pattern %s\n\tmust be a valid call method name", r.Method, r.Pattern)
+		}
+		schema, err := jsonschema.Compile(r.Schema)
+		if err != nil {
+			return fmt.Errorf("invalid callSchemas schema for pattern %s and method %s\n\t%s", r.Pattern, r.Method, err)
+		}
+		c.callSchemas[i] = callSchema{pattern: pattern, method: r.Method, schema: schema}
+	}
+
+	for _, w := range c.Webhooks {
+		if err := w.validate(); err != nil {
+			return err
+		}
+	}
+
 	if c.Port == c.MetricsPort {
 		return fmt.Errorf(`invalid metrics port "%d": must be different from API port ("%d")`, c.MetricsPort, c.Port)
 	}
@@ -176,6 +414,35 @@ func (c *Config) prepare() error {
 		c.APIPath = c.APIPath + "/"
 	}
 
+	c.graphqlPath = ""
+	if c.GraphQLPath != nil {
+		p := *c.GraphQLPath
+		if p == "" || p[0] != '/' || p == c.WSPath {
+			return fmt.Errorf("invalid graphqlPath setting (%s)\n\tmust be a path starting with / and differ from wsPath", p)
+		}
+		c.graphqlPath = p
+	}
+
+	c.openAPIPath = ""
+	if c.OpenAPIPath != nil {
+		p := *c.OpenAPIPath
+		if p == "" || p[0] != '/' || p == c.WSPath || p == c.graphqlPath {
+			return fmt.Errorf("invalid openApiPath setting (%s)\n\tmust be a path starting with / and differ from wsPath and graphqlPath", p)
+		}
+		c.openAPIPath = p
+	}
+
+	for i, rname := range c.OpenAPIResources {
+		if !isValidOpenAPIResource(rname) {
+			return fmt.Errorf("invalid openApiResources setting (%s)\n\tmust be a valid resource name, where $ prefixed parts are path parameters", rname)
+		}
+		for _, r := range c.OpenAPIResources[:i] {
+			if r == rname {
+				return fmt.Errorf("invalid openApiResources setting (%s)\n\tmust not contain duplicates", rname)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -240,3 +507,82 @@ origin:
 	}
 	return false
 }
+
+func (w WebhookConfig) validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url (%s)\n\tmust be an absolute http or https URL", w.URL)
+	}
+	if len(w.Resources) == 0 {
+		return fmt.Errorf("invalid webhook setting for %s\n\tresources must not be empty", w.URL)
+	}
+	for _, p := range w.Resources {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid webhook resource (%s) for %s\n\tmust be a valid resource ID or resource pattern", p, w.URL)
+		}
+	}
+	for _, ev := range w.Events {
+		if !isWebhookEvent(ev) {
+			return fmt.Errorf("invalid webhook event (%s) for %s\n\tvalid events are %s", ev, w.URL, strings.Join(webhook.Events, ", "))
+		}
+	}
+	if w.MaxRetries != nil && *w.MaxRetries < 0 {
+		return fmt.Errorf("invalid webhook maxRetries (%d) for %s\n\tmust be zero or a positive number", *w.MaxRetries, w.URL)
+	}
+	if w.RetryDelay < 0 {
+		return fmt.Errorf("invalid webhook retryDelay (%d) for %s\n\tmust be zero or a positive number of milliseconds", w.RetryDelay, w.URL)
+	}
+	if w.Timeout < 0 {
+		return fmt.Errorf("invalid webhook timeout (%d) for %s\n\tmust be zero or a positive number of milliseconds", w.Timeout, w.URL)
+	}
+	return nil
+}
+
+func (t TenantConfig) validate() error {
+	if !isValidSubjectPrefix(t.SubjectPrefix) {
+		return fmt.Errorf("invalid tenant subjectPrefix (%s)\n\tmust be dot-separated tokens without wildcards", t.SubjectPrefix)
+	}
+	if t.Host == "" && t.Path == "" {
+		return fmt.Errorf("invalid tenant setting for subjectPrefix %s\n\tmust have a host or a path", t.SubjectPrefix)
+	}
+	if strings.ContainsAny(t.Host, ":/ ") {
+		return fmt.Errorf("invalid tenant host (%s) for subjectPrefix %s\n\tmust be a host name without port", t.Host, t.SubjectPrefix)
+	}
+	if t.Path != "" && (t.Path[0] != '/' || t.Path[len(t.Path)-1] == '/' || strings.ContainsAny(t.Path, "?#% ")) {
+		return fmt.Errorf("invalid tenant path (%s) for subjectPrefix %s\n\tmust be a path starting with /, and not ending with /", t.Path, t.SubjectPrefix)
+	}
+	return nil
+}
+
+// isValidSubjectPrefix reports whether p is a valid prefix of NATS subjects.
+func isValidSubjectPrefix(p string) bool {
+	for _, part := range strings.Split(p, ".") {
+		if !codec.IsValidRIDPart(part) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWebhookEvent(ev string) bool {
+	for _, e := range webhook.Events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCertPool loads a certificate pool from a file with PEM encoded
+// certificates.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return pool, nil
+}
@@ -1,9 +1,20 @@
 package server
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func compareString(t *testing.T, name string, str, exp string, i int) {
@@ -33,6 +44,7 @@ func TestConfigPrepare(t *testing.T) {
 	ipv6Addr := "::1"
 	invalidAddr := "127.0.0"
 	invalidHeaderAuth := "test"
+	negativeInt := -1
 	allowOriginAll := "*"
 	allowOriginSingle := "http://resgate.io"
 	allowOriginMultiple := "http://localhost;http://resgate.io"
@@ -46,6 +58,11 @@ func TestConfigPrepare(t *testing.T) {
 	headerAuthAction := "foo"
 	method := "foo"
 	invalidMethod := "foo.bar"
+	graphqlPath := "/graphql"
+	invalidGraphQLPath := "graphql"
+	wsGraphQLPath := "/"
+	openAPIPath := "/openapi.json"
+	invalidOpenAPIPath := "openapi.json"
 	defaultCfg := Config{}
 	defaultCfg.SetDefault()
 
@@ -76,6 +93,17 @@ func TestConfigPrepare(t *testing.T) {
 		{Config{Addr: &emptyAddr, WSPath: "/", MetricsPort: 8090}, Config{Addr: &emptyAddr, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: ":80", metricsNetAddr: ":8090", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
 		{Config{Addr: &localAddr, WSPath: "/", MetricsPort: 8090}, Config{Addr: &localAddr, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "127.0.0.1:80", metricsNetAddr: "127.0.0.1:8090", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
 		{Config{Addr: &ipv6Addr, WSPath: "/", MetricsPort: 8090}, Config{Addr: &ipv6Addr, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "[::1]:80", metricsNetAddr: "[::1]:8090", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
+		{Config{WSPath: "/", GraphQLPath: &graphqlPath}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", GraphQLPath: &graphqlPath, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", graphqlPath: graphqlPath}, false},
+		{Config{WSPath: "/", OpenAPIPath: &openAPIPath, OpenAPIResources: []string{"test.model", "test.model.$id"}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", OpenAPIPath: &openAPIPath, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", openAPIPath: openAPIPath}, false},
+		// Subject prefix
+		{Config{WSPath: "/", SubjectPrefix: "env.tenant1"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", SubjectPrefix: "env.tenant1", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
+		{Config{WSPath: "/", Tenants: []TenantConfig{{Host: "acme.example.org", SubjectPrefix: "acme"}, {Path: "/globex", SubjectPrefix: "globex"}}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", Tenants: []TenantConfig{{Host: "acme.example.org", SubjectPrefix: "acme"}, {Path: "/globex", SubjectPrefix: "globex"}}, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
+		// Trusted proxies
+		{Config{WSPath: "/", TrustedProxies: []string{"10.0.0.0/8", "192.168.1.12", "::1"}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", trustedProxies: []*net.IPNet{
+			{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+			{IP: net.IP{192, 168, 1, 12}, Mask: net.CIDRMask(32, 32)},
+			{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+		}}, false},
 		// Invalid config
 		{Config{Addr: &invalidAddr, WSPath: "/"}, Config{}, true},
 		{Config{HeaderAuth: &invalidHeaderAuth, WSPath: "/"}, Config{}, true},
@@ -89,6 +117,59 @@ func TestConfigPrepare(t *testing.T) {
 		{Config{DELETEMethod: &invalidMethod, WSPath: "/"}, Config{}, true},
 		{Config{PATCHMethod: &invalidMethod, WSPath: "/"}, Config{}, true},
 		{Config{Addr: &defaultAddr, Port: 8080, MetricsPort: 8080, WSPath: "/"}, Config{}, true},
+		{Config{GraphQLPath: &invalidGraphQLPath, WSPath: "/"}, Config{}, true},
+		{Config{GraphQLPath: &wsGraphQLPath, WSPath: "/"}, Config{}, true},
+		{Config{OpenAPIPath: &invalidOpenAPIPath, WSPath: "/"}, Config{}, true},
+		{Config{OpenAPIPath: &graphqlPath, GraphQLPath: &graphqlPath, WSPath: "/"}, Config{}, true},
+		{Config{OpenAPIResources: []string{"test.>"}, WSPath: "/"}, Config{}, true},
+		{Config{OpenAPIResources: []string{"test.model.$"}, WSPath: "/"}, Config{}, true},
+		{Config{OpenAPIResources: []string{"test.model", "test.model"}, WSPath: "/"}, Config{}, true},
+		{Config{CacheAuditInterval: -1, WSPath: "/"}, Config{}, true},
+		{Config{CacheSnapshotMaxAge: -1, WSPath: "/"}, Config{}, true},
+		{Config{CacheWarmUp: []string{"test.model", "test.>", "test..model"}, WSPath: "/"}, Config{}, true},
+		{Config{CacheRetention: []CacheRetentionRule{{Pattern: "test.>.model"}}, WSPath: "/"}, Config{}, true},
+		{Config{CacheRetention: []CacheRetentionRule{{Pattern: "test.>", Delay: -1}}, WSPath: "/"}, Config{}, true},
+		{Config{CacheRetention: []CacheRetentionRule{{Pattern: "test.>", Delay: 1000, Pin: true}}, WSPath: "/"}, Config{}, true},
+		{Config{ResourceSchemas: []ResourceSchemaRule{{Pattern: "test.>.model", Schema: json.RawMessage(`{}`)}}, WSPath: "/"}, Config{}, true},
+		{Config{ResourceSchemas: []ResourceSchemaRule{{Pattern: "test.>"}}, WSPath: "/"}, Config{}, true},
+		{Config{ResourceSchemas: []ResourceSchemaRule{{Pattern: "test.>", Schema: json.RawMessage(`{"type":"unknown"}`)}}, WSPath: "/"}, Config{}, true},
+		{Config{CallSchemas: []CallSchemaRule{{Pattern: "test.>.model", Method: "set", Schema: json.RawMessage(`{}`)}}, WSPath: "/"}, Config{}, true},
+		{Config{WSPingInterval: -1, WSPath: "/"}, Config{}, true},
+		{Config{WSPingInterval: 1000, WSPongTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{WSPongTimeout: 1000, WSPath: "/"}, Config{}, true},
+		{Config{WSIdleTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{WSMaxMessageSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{HTTPMaxBodySize: -1, WSPath: "/"}, Config{}, true},
+		{Config{MaxCallParamsSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{TLSClientAuth: "optional", TLS: true, TLSClientCA: "ca.pem", WSPath: "/"}, Config{}, true},
+		{Config{TLSClientAuth: "require", TLSClientCA: "ca.pem", WSPath: "/"}, Config{}, true},
+		{Config{TLSClientAuth: "request", TLS: true, WSPath: "/"}, Config{}, true},
+		{Config{TLSClientAuth: "require", TLS: true, TLSClientCA: "missing.pem", WSPath: "/"}, Config{}, true},
+		{Config{TrustedProxies: []string{"10.0.0.0/33"}, WSPath: "/"}, Config{}, true},
+		{Config{TrustedProxies: []string{"10.0.0"}, WSPath: "/"}, Config{}, true},
+		{Config{ProxyProtocol: true, WSPath: "/"}, Config{}, true},
+		{Config{SubjectPrefix: "tenant.*", WSPath: "/"}, Config{}, true},
+		{Config{SubjectPrefix: "tenant.", WSPath: "/"}, Config{}, true},
+		{Config{SubjectPrefix: "ten ant", WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Host: "acme.example.org"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Host: "acme.example.org", SubjectPrefix: "acme.*"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Host: "acme.example.org:8080", SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Path: "acme", SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Path: "/acme/", SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{SubjectPrefix: "acme", Tenants: []TenantConfig{{Path: "/acme", SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Path: "/acme", SubjectPrefix: "acme"}, {Path: "/globex", SubjectPrefix: "acme"}}, WSPath: "/"}, Config{}, true},
+		{Config{Tenants: []TenantConfig{{Host: "acme.example.org", SubjectPrefix: "acme"}, {Host: "ACME.example.org", SubjectPrefix: "globex"}}, WSPath: "/"}, Config{}, true},
+		{Config{CallSchemas: []CallSchemaRule{{Pattern: "test.>", Method: "foo.bar", Schema: json.RawMessage(`{}`)}}, WSPath: "/"}, Config{}, true},
+		{Config{CallSchemas: []CallSchemaRule{{Pattern: "test.>", Method: "set", Schema: json.RawMessage(`{"required":"foo"}`)}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "ftp://localhost", Resources: []string{"test.>"}}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "/events", Resources: []string{"test.>"}}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost"}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost", Resources: []string{"test.>.model"}}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost", Resources: []string{"test.>"}, Events: []string{"custom"}}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost", Resources: []string{"test.>"}, MaxRetries: &negativeInt}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost", Resources: []string{"test.>"}, RetryDelay: -1}}, WSPath: "/"}, Config{}, true},
+		{Config{Webhooks: []WebhookConfig{{URL: "http://localhost", Resources: []string{"test.>"}, Timeout: -1}}, WSPath: "/"}, Config{}, true},
 	}
 
 	for i, r := range tbl {
@@ -110,6 +191,10 @@ func TestConfigPrepare(t *testing.T) {
 		compareStringPtr(t, "PUTMethod", cfg.PUTMethod, r.Expected.PUTMethod, i)
 		compareStringPtr(t, "DELETEMethod", cfg.DELETEMethod, r.Expected.DELETEMethod, i)
 		compareStringPtr(t, "PATCHMethod", cfg.PATCHMethod, r.Expected.PATCHMethod, i)
+		compareStringPtr(t, "GraphQLPath", cfg.GraphQLPath, r.Expected.GraphQLPath, i)
+		compareString(t, "graphqlPath", cfg.graphqlPath, r.Expected.graphqlPath, i)
+		compareStringPtr(t, "OpenAPIPath", cfg.OpenAPIPath, r.Expected.OpenAPIPath, i)
+		compareString(t, "openAPIPath", cfg.openAPIPath, r.Expected.openAPIPath, i)
 
 		if cfg.Port != r.Expected.Port {
 			t.Fatalf("expected Port to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.Port, cfg.Port, i+1)
@@ -133,11 +218,84 @@ func TestConfigPrepare(t *testing.T) {
 			}
 		}
 
+		if len(cfg.trustedProxies) != len(r.Expected.trustedProxies) {
+			t.Fatalf("expected trustedProxies to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.trustedProxies, cfg.trustedProxies, i+1)
+		}
+		for j, ipnet := range cfg.trustedProxies {
+			if ipnet.String() != r.Expected.trustedProxies[j].String() {
+				t.Fatalf("expected trustedProxies to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.trustedProxies, cfg.trustedProxies, i+1)
+			}
+		}
+
 		compareStringPtr(t, "HeaderAuth", cfg.HeaderAuth, r.Expected.HeaderAuth, i)
 		compareStringPtr(t, "WSHeaderAuth", cfg.WSHeaderAuth, r.Expected.WSHeaderAuth, i)
 	}
 }
 
+// Test config prepare method loading the client CA file
+func TestConfigPrepareClientCAFile(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(caFile, createCACertPEM(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalidFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := []struct {
+		ClientAuth   string
+		ClientCA     string
+		ExpectedPool bool
+		PrepareError bool
+	}{
+		{"none", caFile, false, false},
+		{"request", caFile, true, false},
+		{"require", caFile, true, false},
+		{"require", invalidFile, false, true},
+		{"require", filepath.Join(dir, "missing.pem"), false, true},
+	}
+
+	for i, r := range tbl {
+		cfg := Config{WSPath: "/", TLS: true, TLSClientAuth: r.ClientAuth, TLSClientCA: r.ClientCA}
+		err := cfg.prepare()
+		if err != nil {
+			if !r.PrepareError {
+				t.Fatalf("expected no error, but got:\n%s\nin test #%d", err, i+1)
+			}
+			continue
+		} else if r.PrepareError {
+			t.Fatalf("expected an error, but got none, in test #%d", i+1)
+		}
+		if (cfg.tlsClientCAs != nil) != r.ExpectedPool {
+			t.Fatalf("expected client CA pool to be loaded: %t, but got %t in test #%d", r.ExpectedPool, cfg.tlsClientCAs != nil, i+1)
+		}
+	}
+}
+
+// createCACertPEM creates a PEM encoded self-signed CA certificate.
+func createCACertPEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
 // Test NewService configuration error
 func TestNewServiceConfigError(t *testing.T) {
 	tbl := []struct {
@@ -7,7 +7,7 @@ const (
 	Version = "1.8.0"
 
 	// ProtocolVersion is the implemented RES protocol version.
-	ProtocolVersion = "1.2.3"
+	ProtocolVersion = "1.2.4"
 
 	// DefaultAddr is the default host for client connections.
 	DefaultAddr = "0.0.0.0"
@@ -42,6 +42,22 @@ const (
 	// CacheWorkers is the number of goroutines handling cached resources.
 	CacheWorkers = 10
 
+	// OpenAPICacheTTL is the duration an OpenAPI document is served before
+	// the schemas are requested again.
+	OpenAPICacheTTL = time.Minute
+
+	// ProxyProtocolHeaderTimeout is the wait time for a connection from a
+	// trusted proxy to send its PROXY protocol header.
+	ProxyProtocolHeaderTimeout = 5 * time.Second
+
+	// GraphQLInitTimeout is the wait time for a GraphQL WebSocket connection
+	// to send its connection_init message.
+	GraphQLInitTimeout = 10 * time.Second
+
 	// UnsubscribeDelay is the delay for the cache to unsubscribe and evict resources no longer used.
 	UnsubscribeDelay = 5 * time.Second
+
+	// CacheSnapshotMaxAge is the default max age of a cache snapshot. Stale
+	// resources are no longer served once the snapshot is older.
+	CacheSnapshotMaxAge = 5 * time.Minute
 )
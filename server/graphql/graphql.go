@@ -0,0 +1,325 @@
+// Package graphql implements parsing and field collection of GraphQL
+// executable documents, as well as the GraphQL request and response formats.
+//
+// Execution is left to the caller, as resources have no static schema.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Request is a GraphQL request, as sent over HTTP or a WebSocket.
+type Request struct {
+	Query         string                     `json:"query"`
+	OperationName string                     `json:"operationName,omitempty"`
+	Variables     map[string]json.RawMessage `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response. Data is omitted for request errors that
+// occur before execution.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*Error        `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Location is a line and column in a GraphQL document.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Variables holds the coerced variable values of an operation.
+type Variables map[string]json.RawMessage
+
+var nullBytes = json.RawMessage("null")
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns a new error at the position of a field.
+func (d *Document) Errorf(f *Field, path []interface{}, format string, v ...interface{}) *Error {
+	err := &Error{Message: fmt.Sprintf(format, v...)}
+	if f != nil {
+		err.Locations = []Location{location(d.src, f.Pos)}
+	}
+	if len(path) > 0 {
+		err.Path = append([]interface{}(nil), path...)
+	}
+	return err
+}
+
+// ToError converts an error to a GraphQL error.
+func ToError(err error) *Error {
+	var gerr *Error
+	if errors.As(err, &gerr) {
+		return gerr
+	}
+	return &Error{Message: err.Error()}
+}
+
+// Operation returns the operation to execute. If name is empty, the document
+// must contain a single operation.
+func (d *Document) Operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations"}
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q", name)}
+}
+
+// CoerceVariables returns the variable values of an operation, using default
+// values for variables not provided. Values are not validated against their
+// declared types, except that non-null variables must not be null.
+func (d *Document) CoerceVariables(op *Operation, vals map[string]json.RawMessage) (Variables, error) {
+	vars := make(Variables, len(op.Variables))
+	for _, def := range op.Variables {
+		v, ok := vals[def.Name]
+		if !ok && def.Default != nil {
+			b, err := d.valueJSON(def.Default, nil)
+			if err != nil {
+				return nil, err
+			}
+			v, ok = b, true
+		}
+		if def.NonNull && (!ok || bytes.Equal(bytes.TrimSpace(v), nullBytes)) {
+			return nil, &Error{
+				Message:   fmt.Sprintf("Variable \"$%s\" of required type \"%s\" was not provided", def.Name, def.Type),
+				Locations: []Location{location(d.src, def.pos)},
+			}
+		}
+		if ok {
+			vars[def.Name] = v
+		}
+	}
+	return vars, nil
+}
+
+// ArgumentValues returns the argument values of a field as JSON. Arguments
+// with an unset variable value are omitted.
+func (d *Document) ArgumentValues(f *Field, vars Variables) (map[string]json.RawMessage, error) {
+	return d.argumentValues(f.Arguments, vars)
+}
+
+func (d *Document) argumentValues(args []*Argument, vars Variables) (map[string]json.RawMessage, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]json.RawMessage, len(args))
+	for _, arg := range args {
+		if _, ok := m[arg.Name]; ok {
+			return nil, &Error{
+				Message:   fmt.Sprintf("There can be only one argument named %q", arg.Name),
+				Locations: []Location{location(d.src, arg.Value.pos)},
+			}
+		}
+		if arg.Value.Kind == ValueVariable {
+			if _, ok := vars[arg.Value.Raw]; !ok {
+				continue
+			}
+		}
+		b, err := d.valueJSON(arg.Value, vars)
+		if err != nil {
+			return nil, err
+		}
+		m[arg.Name] = b
+	}
+	return m, nil
+}
+
+// valueJSON encodes a literal value as JSON, replacing any variables with
+// their values. Enum values are encoded as strings.
+func (d *Document) valueJSON(v *Value, vars Variables) (json.RawMessage, error) {
+	switch v.Kind {
+	case ValueVariable:
+		b, ok := vars[v.Raw]
+		if !ok {
+			return nullBytes, nil
+		}
+		return b, nil
+	case ValueInt, ValueFloat:
+		// GraphQL number literals are valid JSON numbers
+		return json.RawMessage(v.Raw), nil
+	case ValueString, ValueEnum:
+		return json.Marshal(v.Raw)
+	case ValueBoolean:
+		return json.RawMessage(v.Raw), nil
+	case ValueNull:
+		return nullBytes, nil
+	case ValueList:
+		var b bytes.Buffer
+		b.WriteByte('[')
+		for i, item := range v.List {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			ib, err := d.valueJSON(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			b.Write(ib)
+		}
+		b.WriteByte(']')
+		return b.Bytes(), nil
+	case ValueObject:
+		var b bytes.Buffer
+		b.WriteByte('{')
+		seen := make(map[string]bool, len(v.Fields))
+		for i, f := range v.Fields {
+			if seen[f.Name] {
+				return nil, &Error{
+					Message:   fmt.Sprintf("There can be only one input field named %q", f.Name),
+					Locations: []Location{location(d.src, f.Value.pos)},
+				}
+			}
+			seen[f.Name] = true
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(f.Name))
+			b.WriteByte(':')
+			fb, err := d.valueJSON(f.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+			b.Write(fb)
+		}
+		b.WriteByte('}')
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown value kind %d", v.Kind)
+}
+
+// CollectedField is a set of fields with the same response key, merged into
+// a single field.
+type CollectedField struct {
+	*Field
+	// SelectionSet is the merged selection set of all fields with the
+	// response key.
+	SelectionSet []Selection
+}
+
+// CollectFields returns the fields of a selection set, in order, for an
+// object of the given type. Fields with the same response key are merged,
+// fragments with non-matching type conditions are skipped, and the @skip and
+// @include directives are applied.
+func (d *Document) CollectFields(ss []Selection, typeName string, vars Variables) ([]*CollectedField, error) {
+	var fields []*CollectedField
+	idx := make(map[string]int)
+	if err := d.collectFields(ss, typeName, vars, &fields, idx, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (d *Document) collectFields(ss []Selection, typeName string, vars Variables, fields *[]*CollectedField, idx map[string]int, visited map[string]bool) error {
+	for _, sel := range ss {
+		switch s := sel.(type) {
+		case *Field:
+			include, err := d.include(s.Directives, vars)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			key := s.ResponseKey()
+			if i, ok := idx[key]; ok {
+				cf := (*fields)[i]
+				if cf.Name != s.Name {
+					return &Error{
+						Message:   fmt.Sprintf("Fields %q conflict because %s and %s are different fields", key, cf.Name, s.Name),
+						Locations: []Location{location(d.src, cf.Pos), location(d.src, s.Pos)},
+					}
+				}
+				cf.SelectionSet = append(cf.SelectionSet, s.SelectionSet...)
+				continue
+			}
+			idx[key] = len(*fields)
+			*fields = append(*fields, &CollectedField{
+				Field:        s,
+				SelectionSet: append([]Selection(nil), s.SelectionSet...),
+			})
+
+		case *FragmentSpread:
+			include, err := d.include(s.Directives, vars)
+			if err != nil {
+				return err
+			}
+			if !include || visited[s.Name] {
+				continue
+			}
+			f, ok := d.Fragments[s.Name]
+			if !ok {
+				return &Error{
+					Message:   fmt.Sprintf("Unknown fragment %q", s.Name),
+					Locations: []Location{location(d.src, s.pos)},
+				}
+			}
+			visited[s.Name] = true
+			if f.TypeCondition != typeName {
+				continue
+			}
+			if err := d.collectFields(f.SelectionSet, typeName, vars, fields, idx, visited); err != nil {
+				return err
+			}
+
+		case *InlineFragment:
+			include, err := d.include(s.Directives, vars)
+			if err != nil {
+				return err
+			}
+			if !include || (s.TypeCondition != "" && s.TypeCondition != typeName) {
+				continue
+			}
+			if err := d.collectFields(s.SelectionSet, typeName, vars, fields, idx, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// include applies any @skip or @include directive.
+func (d *Document) include(ds []*Directive, vars Variables) (bool, error) {
+	for _, dir := range ds {
+		if dir.Name != "skip" && dir.Name != "include" {
+			continue
+		}
+		args, err := d.argumentValues(dir.Arguments, vars)
+		if err != nil {
+			return false, err
+		}
+		var b bool
+		if err := json.Unmarshal(args["if"], &b); err != nil {
+			return false, &Error{
+				Message:   fmt.Sprintf("Directive \"@%s\" argument \"if\" must be a Boolean", dir.Name),
+				Locations: []Location{location(d.src, dir.pos)},
+			}
+		}
+		if b == (dir.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,612 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Document is a parsed GraphQL executable document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+	src        string
+}
+
+// Operation is a query, mutation, or subscription operation.
+type Operation struct {
+	Type         string // "query", "mutation", or "subscription"
+	Name         string
+	Variables    []*VariableDefinition
+	Directives   []*Directive
+	SelectionSet []Selection
+}
+
+// VariableDefinition is a variable declared by an operation.
+type VariableDefinition struct {
+	Name    string
+	Type    string // Type as written, eg. "[String!]!"
+	NonNull bool
+	Default *Value
+	pos     int
+}
+
+// Fragment is a named fragment definition.
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+}
+
+// Selection is a *Field, a *FragmentSpread, or an *InlineFragment.
+type Selection interface {
+	selection()
+}
+
+// Field is a field selection.
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    []*Argument
+	Directives   []*Directive
+	SelectionSet []Selection
+	Pos          int
+}
+
+// FragmentSpread is a spread of a named fragment.
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	pos        int
+}
+
+// InlineFragment is a fragment defined inline within a selection set.
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+}
+
+func (*Field) selection()          {}
+func (*FragmentSpread) selection() {}
+func (*InlineFragment) selection() {}
+
+// Directive is a directive, such as @skip or @include.
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	pos       int
+}
+
+// Argument is a named argument of a field or directive.
+type Argument struct {
+	Name  string
+	Value *Value
+}
+
+// ValueKind is the kind of a literal value.
+type ValueKind byte
+
+// Value kinds
+const (
+	ValueVariable ValueKind = iota
+	ValueInt
+	ValueFloat
+	ValueString
+	ValueBoolean
+	ValueNull
+	ValueEnum
+	ValueList
+	ValueObject
+)
+
+// Value is a literal value, or a variable, in a GraphQL document.
+type Value struct {
+	Kind   ValueKind
+	Raw    string // Variable name, number literal, string value, boolean, or enum value
+	List   []*Value
+	Fields []*ObjectField
+	pos    int
+}
+
+// ObjectField is a field of an object value.
+type ObjectField struct {
+	Name  string
+	Value *Value
+}
+
+// ResponseKey returns the key of the field in the response.
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+// Parse parses a GraphQL executable document. Type system definitions are
+// not supported.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: make(map[string]*Fragment), src: src}
+	for {
+		switch {
+		case p.tok.kind == tokenEOF:
+			if len(doc.Operations) == 0 {
+				return nil, &Error{Message: "Document contains no operations"}
+			}
+			if err := doc.validateFragmentCycles(); err != nil {
+				return nil, err
+			}
+			return doc, nil
+		case p.peek("{"):
+			ss, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", SelectionSet: ss})
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peekName("fragment"):
+			pos := p.tok.pos
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[f.Name]; ok {
+				return nil, &Error{
+					Message:   fmt.Sprintf("There can be only one fragment named %q", f.Name),
+					Locations: []Location{location(p.lex.src, pos)},
+				}
+			}
+			doc.Fragments[f.Name] = f
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.tok.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if op.Variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*VariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*VariableDefinition
+	for {
+		def := &VariableDefinition{pos: p.tok.pos}
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		def.Name = name
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if def.Type, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		def.NonNull = def.Type[len(def.Type)-1] == '!'
+		if p.peek("=") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			if def.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = p.directives(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+		if p.peek(")") {
+			return defs, p.advance()
+		}
+	}
+}
+
+// typeRef parses a type reference and returns it as written, without
+// whitespace.
+func (p *parser) typeRef() (string, error) {
+	var t string
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect("]"); err != nil {
+			return "", err
+		}
+		t = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		t = name
+	}
+	if p.peek("!") {
+		t += "!"
+		return t, p.advance()
+	}
+	return t, nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &Fragment{Name: name}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+	if f.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if f.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if f.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var ss []Selection
+	for {
+		var sel Selection
+		var err error
+		if p.peek("...") {
+			sel, err = p.fragmentSelection()
+		} else {
+			sel, err = p.field()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, sel)
+		if p.peek("}") {
+			return ss, p.advance()
+		}
+	}
+}
+
+func (p *parser) field() (*Field, error) {
+	f := &Field{Pos: p.tok.pos}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		f.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.Name = name
+	if f.Arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if f.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if f.SelectionSet, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) fragmentSelection() (Selection, error) {
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName && p.tok.value != "on" {
+		fs := &FragmentSpread{Name: p.tok.value, pos: pos}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		fs.Directives, err = p.directives()
+		return fs, err
+	}
+
+	f := &InlineFragment{}
+	var err error
+	if p.peekName("on") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		if f.TypeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if f.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *parser) arguments(isConst bool) ([]*Argument, error) {
+	if !p.peek("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var args []*Argument
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(isConst)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, &Argument{Name: name, Value: v})
+		if p.peek(")") {
+			return args, p.advance()
+		}
+	}
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var ds []*Directive
+	for p.peek("@") {
+		d := &Directive{pos: p.tok.pos}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d.Name = name
+		if d.Arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+func (p *parser) value(isConst bool) (*Value, error) {
+	v := &Value{Raw: p.tok.value, pos: p.tok.pos}
+	switch p.tok.kind {
+	case tokenInt:
+		v.Kind = ValueInt
+	case tokenFloat:
+		v.Kind = ValueFloat
+	case tokenString:
+		v.Kind = ValueString
+	case tokenName:
+		switch p.tok.value {
+		case "true", "false":
+			v.Kind = ValueBoolean
+		case "null":
+			v.Kind = ValueNull
+		default:
+			v.Kind = ValueEnum
+		}
+	case tokenPunctuator:
+		switch p.tok.value {
+		case "$":
+			if isConst {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return &Value{Kind: ValueVariable, Raw: name, pos: v.pos}, nil
+		case "[":
+			v.Kind = ValueList
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for !p.peek("]") {
+				item, err := p.value(isConst)
+				if err != nil {
+					return nil, err
+				}
+				v.List = append(v.List, item)
+			}
+			return v, p.advance()
+		case "{":
+			v.Kind = ValueObject
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for !p.peek("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(":"); err != nil {
+					return nil, err
+				}
+				fv, err := p.value(isConst)
+				if err != nil {
+					return nil, err
+				}
+				v.Fields = append(v.Fields, &ObjectField{Name: name, Value: fv})
+			}
+			return v, p.advance()
+		default:
+			return nil, p.unexpected()
+		}
+	default:
+		return nil, p.unexpected()
+	}
+	return v, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunctuator && p.tok.value == punct
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.tok.kind == tokenName && p.tok.value == name
+}
+
+func (p *parser) unexpected() error {
+	return p.lex.errorf(p.tok.pos, "unexpected %s", p.tok)
+}
+
+// validateFragmentCycles returns an error if any fragment spreads itself,
+// directly or through other fragments.
+func (d *Document) validateFragmentCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(d.Fragments))
+	var visit func(ss []Selection) *FragmentSpread
+	visit = func(ss []Selection) *FragmentSpread {
+		for _, sel := range ss {
+			switch s := sel.(type) {
+			case *Field:
+				if fs := visit(s.SelectionSet); fs != nil {
+					return fs
+				}
+			case *InlineFragment:
+				if fs := visit(s.SelectionSet); fs != nil {
+					return fs
+				}
+			case *FragmentSpread:
+				f, ok := d.Fragments[s.Name]
+				if !ok {
+					continue
+				}
+				switch state[s.Name] {
+				case visiting:
+					return s
+				case done:
+					continue
+				}
+				state[s.Name] = visiting
+				if fs := visit(f.SelectionSet); fs != nil {
+					return fs
+				}
+				state[s.Name] = done
+			}
+		}
+		return nil
+	}
+	// Visit fragments in name order for a deterministic error.
+	names := make([]string, 0, len(d.Fragments))
+	for name := range d.Fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if state[name] != 0 {
+			continue
+		}
+		f := d.Fragments[name]
+		state[name] = visiting
+		if fs := visit(f.SelectionSet); fs != nil {
+			return &Error{
+				Message:   fmt.Sprintf("Cannot spread fragment %q within itself", fs.Name),
+				Locations: []Location{location(d.src, fs.pos)},
+			}
+		}
+		state[name] = done
+	}
+	return nil
+}
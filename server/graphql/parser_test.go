@@ -0,0 +1,209 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Test parsing invalid documents
+func TestParseInvalidDocument(t *testing.T) {
+	tbl := []struct {
+		Src      string
+		Message  string
+		Location Location
+	}{
+		// Document
+		{"", "Document contains no operations", Location{}},
+		{"  # comment only\n", "Document contains no operations", Location{}},
+		{"fragment F on Model { a }", "Document contains no operations", Location{}},
+		{"foo { a }", "Syntax error: unexpected foo", Location{1, 1}},
+		{"{ a } }", "Syntax error: unexpected }", Location{1, 7}},
+		// Selection sets
+		{"{", "Syntax error: unexpected <EOF>", Location{1, 2}},
+		{"{}", "Syntax error: unexpected }", Location{1, 2}},
+		{"{ a", "Syntax error: unexpected <EOF>", Location{1, 4}},
+		{"{ a: }", "Syntax error: unexpected }", Location{1, 6}},
+		{"{ a { } }", "Syntax error: unexpected }", Location{1, 7}},
+		{"{ 1 }", "Syntax error: unexpected 1", Location{1, 3}},
+		// Operations
+		{"query", "Syntax error: unexpected <EOF>", Location{1, 6}},
+		{"query Q", "Syntax error: unexpected <EOF>", Location{1, 8}},
+		{"query Q ( ) { a }", "Syntax error: unexpected )", Location{1, 11}},
+		{"query Q($a) { a }", "Syntax error: unexpected )", Location{1, 11}},
+		{"query Q($a: ) { a }", "Syntax error: unexpected )", Location{1, 13}},
+		{"query Q($a: [String) { a }", "Syntax error: unexpected )", Location{1, 20}},
+		{"query Q($a: String = $b) { a }", "Syntax error: unexpected $", Location{1, 22}},
+		{"query Q($a: String) @ { a }", "Syntax error: unexpected {", Location{1, 23}},
+		// Arguments and values
+		{"{ a() }", "Syntax error: unexpected )", Location{1, 5}},
+		{"{ a(b) }", "Syntax error: unexpected )", Location{1, 6}},
+		{"{ a(b:) }", "Syntax error: unexpected )", Location{1, 7}},
+		{"{ a(b: [1, 2) }", "Syntax error: unexpected )", Location{1, 13}},
+		{"{ a(b: {c 1}) }", "Syntax error: unexpected 1", Location{1, 11}},
+		{"{ a(b: {c: 1) }", "Syntax error: unexpected )", Location{1, 13}},
+		{"{ a(b: [1", "Syntax error: unexpected <EOF>", Location{1, 10}},
+		{"{ a(b: $) }", "Syntax error: unexpected )", Location{1, 9}},
+		// Fragments
+		{"fragment on on Model { a } { a }", "Syntax error: unexpected on", Location{1, 10}},
+		{"fragment F Model { a } { a }", "Syntax error: unexpected Model", Location{1, 12}},
+		{"fragment F on { a } { a }", "Syntax error: unexpected {", Location{1, 15}},
+		{"{ ... }", "Syntax error: unexpected }", Location{1, 7}},
+		{"{ ... on { a } }", "Syntax error: unexpected {", Location{1, 10}},
+		{"{ a } fragment F on Model { a } fragment F on Model { b }", `There can be only one fragment named "F"`, Location{1, 33}},
+		{"{ ...F } fragment F on Model { ...F }", `Cannot spread fragment "F" within itself`, Location{1, 32}},
+		{"{ ...A } fragment A on Model { b { ...B } } fragment B on Model { ...A }", `Cannot spread fragment "A" within itself`, Location{1, 67}},
+		// Lexical errors
+		{"{ a ? }", `Syntax error: unexpected character '?'`, Location{1, 5}},
+		{"{ a .. }", `Syntax error: unexpected character '.'`, Location{1, 5}},
+		{"{ a(b: 01) }", "Syntax error: invalid number, unexpected digit after 0", Location{1, 8}},
+		{"{ a(b: -) }", "Syntax error: invalid number, expected digit", Location{1, 8}},
+		{"{ a(b: 1.) }", "Syntax error: invalid number, expected digit after .", Location{1, 8}},
+		{"{ a(b: 1e) }", "Syntax error: invalid number, expected digit in exponent", Location{1, 8}},
+		{"{ a(b: 1x) }", "Syntax error: invalid number, unexpected character 'x'", Location{1, 8}},
+		{"{ a(b: 1.5.2) }", "Syntax error: invalid number, unexpected character '.'", Location{1, 8}},
+		{`{ a(b: "foo) }`, "Syntax error: unterminated string", Location{1, 8}},
+		{"{ a(b: \"foo\n\") }", "Syntax error: unterminated string", Location{1, 8}},
+		{`{ a(b: "\x") }`, `Syntax error: invalid escape sequence \x`, Location{1, 9}},
+		{`{ a(b: "\u00g0") }`, "Syntax error: invalid unicode escape sequence", Location{1, 9}},
+		{`{ a(b: "\uD800") }`, "Syntax error: invalid unicode escape sequence", Location{1, 9}},
+		{"{ a(b: \"\xff\") }", "Syntax error: invalid UTF-8 character", Location{1, 9}},
+		{`{ a(b: """foo) }`, "Syntax error: unterminated block string", Location{1, 8}},
+		// Location on later line
+		{"{\n  a\n  b(c: ?)\n}", `Syntax error: unexpected character '?'`, Location{3, 8}},
+	}
+
+	for i, l := range tbl {
+		doc, err := Parse(l.Src)
+		if err == nil {
+			t.Fatalf("expected an error parsing %q, but got a document with %d operations in test #%d", l.Src, len(doc.Operations), i+1)
+		}
+		gerr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected a *Error parsing %q, but got %T in test #%d", l.Src, err, i+1)
+		}
+		if gerr.Message != l.Message {
+			t.Fatalf("expected error message parsing %q to be:\n%s\nbut got:\n%s\nin test #%d", l.Src, l.Message, gerr.Message, i+1)
+		}
+		var loc Location
+		if len(gerr.Locations) > 0 {
+			loc = gerr.Locations[0]
+		}
+		if loc != l.Location {
+			t.Fatalf("expected error location parsing %q to be %+v, but got %+v in test #%d", l.Src, l.Location, loc, i+1)
+		}
+	}
+}
+
+// Test parsing valid documents with edge cases
+func TestParseValidDocument(t *testing.T) {
+	tbl := []struct {
+		Src        string
+		Operations int
+		Fragments  int
+	}{
+		{"{a}", 1, 0},
+		{"\ufeff{ a }", 1, 0},
+		{"{ a }\r\n# comment\r\n", 1, 0},
+		{"{ a, b,, c }", 1, 0},
+		{"query { a }", 1, 0},
+		{"query Q { a }", 1, 0},
+		{"{ query: mutation { subscription } }", 1, 0},
+		{"{ fragment on }", 1, 0},
+		{"query A { a } mutation B { b } subscription C { c }", 3, 0},
+		{"query Q($a: [[String!]!]!, $b: Int = 1 @dir) @dir(x: 1) { a }", 1, 0},
+		{`{ a(b: [], c: {}, d: [1 2.5 -3e2 "s" """block""" true false null ENUM {e: [$v]}]) }`, 1, 0},
+		{"{ ...F ... on Model { a } ... @include(if: true) { b } } fragment F on Model { c }", 1, 1},
+		{"fragment F on Model { a } { ...F }", 1, 1},
+		{"{ ...A ...B } fragment A on Model { ...B } fragment B on Model { c }", 1, 2},
+	}
+
+	for i, l := range tbl {
+		doc, err := Parse(l.Src)
+		if err != nil {
+			t.Fatalf("expected no error parsing %q, but got:\n%s\nin test #%d", l.Src, err, i+1)
+		}
+		if len(doc.Operations) != l.Operations {
+			t.Fatalf("expected %d operations parsing %q, but got %d in test #%d", l.Operations, l.Src, len(doc.Operations), i+1)
+		}
+		if len(doc.Fragments) != l.Fragments {
+			t.Fatalf("expected %d fragments parsing %q, but got %d in test #%d", l.Fragments, l.Src, len(doc.Fragments), i+1)
+		}
+	}
+}
+
+// Test parsing field aliases, arguments, and directives
+func TestParseField(t *testing.T) {
+	doc, err := Parse(`query Q { alias: name(a: 1, b: "x") @skip(if: false) { child } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Q" {
+		t.Fatalf("expected query operation Q, but got %s operation %s", op.Type, op.Name)
+	}
+	f, ok := op.SelectionSet[0].(*Field)
+	if !ok {
+		t.Fatalf("expected a field, but got %T", op.SelectionSet[0])
+	}
+	if f.Alias != "alias" || f.Name != "name" || f.ResponseKey() != "alias" {
+		t.Fatalf("expected field name with alias alias, but got field %s with alias %s", f.Name, f.Alias)
+	}
+	if len(f.Arguments) != 2 || f.Arguments[0].Name != "a" || f.Arguments[1].Name != "b" {
+		t.Fatalf("expected arguments a and b, but got %d arguments", len(f.Arguments))
+	}
+	if len(f.Directives) != 1 || f.Directives[0].Name != "skip" {
+		t.Fatalf("expected directive skip, but got %d directives", len(f.Directives))
+	}
+	if len(f.SelectionSet) != 1 {
+		t.Fatalf("expected 1 selection, but got %d", len(f.SelectionSet))
+	}
+}
+
+// Test argument values encoded as JSON
+func TestArgumentValues(t *testing.T) {
+	tbl := []struct {
+		Arg      string
+		Vars     Variables
+		Expected string
+	}{
+		{`1`, nil, `1`},
+		{`-0`, nil, `-0`},
+		{`1.5e-3`, nil, `1.5e-3`},
+		{`true`, nil, `true`},
+		{`null`, nil, `null`},
+		{`ENUM`, nil, `"ENUM"`},
+		{`""`, nil, `""`},
+		{`"a\"b\\c\/d\nå"`, nil, `"a\"b\\c/d\nå"`},
+		{`"😀"`, nil, `"😀"`},
+		{`"""a "quoted" \""" block"""`, nil, `"a \"quoted\" \"\"\" block"`},
+		{"\"\"\"\n    line 1\n      line 2\n    \"\"\"", nil, `"line 1\n  line 2"`},
+		{`[]`, nil, `[]`},
+		{`[1, [2], {a: 3}]`, nil, `[1,[2],{"a":3}]`},
+		{`{a: $v, b: [$v]}`, Variables{"v": json.RawMessage(`"x"`)}, `{"a":"x","b":["x"]}`},
+	}
+
+	for i, l := range tbl {
+		src := "{ f(x: " + l.Arg + ") }"
+		doc, err := Parse(src)
+		if err != nil {
+			t.Fatalf("expected no error parsing %q, but got:\n%s\nin test #%d", src, err, i+1)
+		}
+		args, err := doc.ArgumentValues(doc.Operations[0].SelectionSet[0].(*Field), l.Vars)
+		if err != nil {
+			t.Fatalf("expected no error getting argument values of %q, but got:\n%s\nin test #%d", src, err, i+1)
+		}
+		var v, exp interface{}
+		if err := json.Unmarshal(args["x"], &v); err != nil {
+			t.Fatalf("expected valid JSON for argument of %q, but got %s in test #%d", src, args["x"], i+1)
+		}
+		_ = json.Unmarshal([]byte(l.Expected), &exp)
+		if got, _ := json.Marshal(v); string(got) != mustJSON(exp) {
+			t.Fatalf("expected argument value of %q to be:\n%s\nbut got:\n%s\nin test #%d", src, l.Expected, args["x"], i+1)
+		}
+	}
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
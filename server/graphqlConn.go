@@ -0,0 +1,400 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/graphql"
+	"github.com/resgateio/resgate/server/reserr"
+	"github.com/resgateio/resgate/server/rpc"
+)
+
+// graphqlWSProtocol is the WebSocket subprotocol used for GraphQL over
+// WebSocket connections.
+const graphqlWSProtocol = "graphql-transport-ws"
+
+// GraphQL over WebSocket message types.
+const (
+	graphqlMsgConnectionInit = "connection_init"
+	graphqlMsgConnectionAck  = "connection_ack"
+	graphqlMsgPing           = "ping"
+	graphqlMsgPong           = "pong"
+	graphqlMsgSubscribe      = "subscribe"
+	graphqlMsgNext           = "next"
+	graphqlMsgError          = "error"
+	graphqlMsgComplete       = "complete"
+)
+
+// GraphQL over WebSocket close codes.
+const (
+	graphqlCloseBadRequest        = 4400
+	graphqlCloseUnauthorized      = 4401
+	graphqlCloseSubprotocol       = 4406
+	graphqlCloseInitTimeout       = 4408
+	graphqlCloseSubscriberExists  = 4409
+	graphqlCloseTooManyInitialize = 4429
+)
+
+// Payloads sent if a response, or a list of errors, fails to be encoded.
+var (
+	graphqlInternalErrorResponse = json.RawMessage(`{"errors":[{"message":"Internal error"}]}`)
+	graphqlInternalErrors        = json.RawMessage(`[{"message":"Internal error"}]`)
+)
+
+type graphqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphqlConn is a GraphQL over WebSocket connection, using the
+// graphql-transport-ws protocol. All fields, except ws, are used on the
+// wsConn worker goroutine.
+type graphqlConn struct {
+	c         *wsConn
+	ws        *websocket.Conn
+	initTimer *time.Timer
+	initiated bool
+	ops       map[string]*graphqlWSOperation
+	changed   map[string]bool // Resources with events not yet resolved
+}
+
+// graphqlWSOperation is an operation started by a subscribe message.
+type graphqlWSOperation struct {
+	id   string
+	exec *graphqlExec
+	rid  string // Subscribed resource. Empty until subscribed.
+	last []byte // Last sent payload.
+}
+
+func (s *Service) graphqlWSHandler(w http.ResponseWriter, r *http.Request, t *tenant) {
+	conn := s.newWSConn(r, t, versionLatest)
+	if conn == nil {
+		return
+	}
+
+	var h http.Header
+	if s.cfg.WSHeaderAuth != nil && s.upgrader.CheckOrigin(r) {
+		refRID, meta, err := s.wsHeaderAuth(conn)
+		if meta != nil {
+			if meta.IsDirectResponseStatus() {
+				conn.Dispose()
+				graphqlStatusResponse(w, *meta.Status, RIDToPath(refRID, t.apiPath), err)
+				return
+			}
+			if meta.Header != nil {
+				h = make(http.Header, len(meta.Header))
+				codec.MergeHeader(h, meta.Header)
+			}
+		}
+	}
+
+	upgrader := s.upgrader
+	upgrader.Subprotocols = []string{graphqlWSProtocol}
+	ws, err := upgrader.Upgrade(w, r, h)
+	if err != nil {
+		conn.Dispose()
+		s.Debugf("Failed to upgrade connection from %s: %s", r.RemoteAddr, err.Error())
+		return
+	}
+
+	gc := &graphqlConn{
+		c:   conn,
+		ws:  ws,
+		ops: make(map[string]*graphqlWSOperation),
+	}
+	if ws.Subprotocol() != graphqlWSProtocol {
+		gc.close(graphqlCloseSubprotocol, "Subprotocol not acceptable")
+		conn.Dispose()
+		return
+	}
+
+	conn.Tracef("Connected (GraphQL): %s", r.RemoteAddr)
+	conn.setConnected()
+
+	// Metrics
+	if s.metrics != nil {
+		s.metrics.WSConnectionCount.Add(1)
+		s.metrics.WSConnections.Add(1)
+	}
+
+	gc.listen()
+
+	// Metrics
+	if s.metrics != nil {
+		s.metrics.WSConnections.Add(-1)
+	}
+
+	if s.onWSClose != nil {
+		s.onWSClose(ws)
+	}
+}
+
+// listen starts listening to the websocket, returning once the socket is
+// closed.
+func (gc *graphqlConn) listen() {
+	c := gc.c
+	c.ws = gc.ws
+	c.serv.setReadLimit(gc.ws)
+	ka := c.startKeepAlive(gc.ws)
+	c.Enqueue(func() {
+		c.onEvent = gc.handleEvent
+		gc.initTimer = time.AfterFunc(GraphQLInitTimeout, func() {
+			c.Enqueue(func() {
+				if !gc.initiated {
+					gc.close(graphqlCloseInitTimeout, "Connection initialisation timeout")
+				}
+			})
+		})
+	})
+
+	var in []byte
+	var err error
+	for {
+		if _, in, err = gc.ws.ReadMessage(); err != nil {
+			break
+		}
+		ka.received()
+
+		c.Tracef("--> %s", in)
+		in := in
+		c.Enqueue(func() {
+			gc.handleMessage(in)
+		})
+	}
+
+	c.Enqueue(func() {
+		if gc.initTimer != nil {
+			gc.initTimer.Stop()
+		}
+	})
+	ka.stop(err)
+	c.serv.handleReadLimitError(gc.ws, err)
+	c.Dispose()
+	c.Tracef("Disconnected: %s", err)
+}
+
+func (gc *graphqlConn) handleMessage(in []byte) {
+	var m graphqlMessage
+	if err := json.Unmarshal(in, &m); err != nil {
+		gc.close(graphqlCloseBadRequest, "Invalid message received")
+		return
+	}
+
+	switch m.Type {
+	case graphqlMsgConnectionInit:
+		if gc.initiated {
+			gc.close(graphqlCloseTooManyInitialize, "Too many initialisation requests")
+			return
+		}
+		gc.initiated = true
+		gc.initTimer.Stop()
+		gc.send(&graphqlMessage{Type: graphqlMsgConnectionAck})
+	case graphqlMsgPing:
+		gc.send(&graphqlMessage{Type: graphqlMsgPong})
+	case graphqlMsgPong:
+	case graphqlMsgSubscribe:
+		gc.subscribe(&m)
+	case graphqlMsgComplete:
+		op, ok := gc.ops[m.ID]
+		if !ok {
+			return
+		}
+		delete(gc.ops, m.ID)
+		if op.rid != "" {
+			gc.c.UnsubscribeByRID(op.rid, 1)
+		}
+	default:
+		gc.close(graphqlCloseBadRequest, "Invalid message received")
+	}
+}
+
+func (gc *graphqlConn) subscribe(m *graphqlMessage) {
+	if !gc.initiated {
+		gc.close(graphqlCloseUnauthorized, "Unauthorized")
+		return
+	}
+	var req graphql.Request
+	if m.ID == "" || json.Unmarshal(m.Payload, &req) != nil {
+		gc.close(graphqlCloseBadRequest, "Invalid message received")
+		return
+	}
+	if _, ok := gc.ops[m.ID]; ok {
+		gc.close(graphqlCloseSubscriberExists, "Subscriber for "+m.ID+" already exists")
+		return
+	}
+
+	o, err := prepareGraphQL(&req)
+	if err != nil {
+		gc.sendError(m.ID, err)
+		return
+	}
+	op := &graphqlWSOperation{id: m.ID, exec: newGraphQLExec(o, gc.c, false)}
+	gc.ops[op.id] = op
+
+	if o.op.Type != "subscription" {
+		op.exec.execute(func(resp *graphql.Response) {
+			if gc.ops[op.id] != op {
+				return
+			}
+			delete(gc.ops, op.id)
+			gc.sendPayload(op.id, resp)
+			gc.send(&graphqlMessage{ID: op.id, Type: graphqlMsgComplete})
+		})
+		return
+	}
+
+	args, err := o.rootArgs(o.fields[0], false)
+	if err != nil {
+		delete(gc.ops, op.id)
+		gc.sendError(op.id, err)
+		return
+	}
+	gc.c.SubscribeResource(args.RID, nil, nil, func(_ *rpc.Resources, err error) {
+		if gc.ops[op.id] != op {
+			// Completed by the client while subscribing
+			if err == nil {
+				gc.c.UnsubscribeByRID(args.RID, 1)
+			}
+			return
+		}
+		if err != nil {
+			delete(gc.ops, op.id)
+			gc.sendError(op.id, err)
+			return
+		}
+		op.rid = args.RID
+		gc.next(op)
+	})
+}
+
+// handleEvent is called with any event sent by subscribed resources. An
+// unsubscribe or delete event on a subscribed resource completes its
+// operations, while other events cause the subscription operations resolving
+// the resource to be resolved again.
+func (gc *graphqlConn) handleEvent(data []byte) {
+	var ev struct {
+		Event string `json:"event"`
+		Data  struct {
+			Reason *reserr.Error `json:"reason"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+
+	if rid := strings.TrimSuffix(ev.Event, ".unsubscribe"); rid != ev.Event {
+		// Avoid passing a nil *reserr.Error as a non-nil error.
+		var reason error = reserr.ErrNotFound
+		if ev.Data.Reason != nil {
+			reason = ev.Data.Reason
+		}
+		for id, op := range gc.ops {
+			if op.rid == rid {
+				delete(gc.ops, id)
+				gc.sendPayload(id, op.exec.resolveError(reason))
+				gc.send(&graphqlMessage{ID: id, Type: graphqlMsgComplete})
+			}
+		}
+		return
+	}
+
+	if rid := strings.TrimSuffix(ev.Event, ".delete"); rid != ev.Event {
+		for id, op := range gc.ops {
+			if op.rid == rid {
+				delete(gc.ops, id)
+				gc.c.UnsubscribeByRID(rid, 1)
+				gc.send(&graphqlMessage{ID: id, Type: graphqlMsgComplete})
+			}
+		}
+		return
+	}
+
+	idx := strings.LastIndexByte(ev.Event, '.')
+	if idx < 0 {
+		return
+	}
+	// Resolve affected subscriptions once the current events are handled.
+	if gc.changed == nil {
+		gc.changed = make(map[string]bool)
+		gc.c.Enqueue(gc.update)
+	}
+	gc.changed[ev.Event[:idx]] = true
+}
+
+// update resolves the subscription operations that resolved any of the
+// changed resources, sending the result for those that have changed.
+func (gc *graphqlConn) update() {
+	changed := gc.changed
+	gc.changed = nil
+	for _, op := range gc.ops {
+		if op.rid == "" {
+			continue
+		}
+		for rid := range changed {
+			if op.exec.rids[rid] {
+				gc.next(op)
+				break
+			}
+		}
+	}
+}
+
+// next resolves a subscription operation, and sends the result unless it is
+// unchanged since last sent.
+func (gc *graphqlConn) next(op *graphqlWSOperation) {
+	sub, ok := gc.c.subs[op.rid]
+	if !ok {
+		return
+	}
+	resp := op.exec.resolve(sub)
+	payload := gc.marshalPayload(resp, graphqlInternalErrorResponse)
+	if bytes.Equal(payload, op.last) {
+		return
+	}
+	op.last = payload
+	gc.send(&graphqlMessage{ID: op.id, Type: graphqlMsgNext, Payload: payload})
+}
+
+func (gc *graphqlConn) sendPayload(id string, resp *graphql.Response) {
+	gc.send(&graphqlMessage{ID: id, Type: graphqlMsgNext, Payload: gc.marshalPayload(resp, graphqlInternalErrorResponse)})
+}
+
+// sendError sends an error message for an operation that failed before
+// execution.
+func (gc *graphqlConn) sendError(id string, err error) {
+	gc.send(&graphqlMessage{ID: id, Type: graphqlMsgError, Payload: gc.marshalPayload([]*graphql.Error{toGraphQLError(err)}, graphqlInternalErrors)})
+}
+
+func (gc *graphqlConn) send(m *graphqlMessage) {
+	out, err := json.Marshal(m)
+	if err != nil {
+		gc.c.Errorf("Error encoding GraphQL message: %s", err)
+		return
+	}
+	gc.c.Tracef("<-- %s", out)
+	gc.ws.WriteMessage(websocket.TextMessage, out)
+}
+
+// close closes the websocket with a close code and reason.
+func (gc *graphqlConn) close(code int, reason string) {
+	gc.c.Tracef("Disconnecting - %s", reason)
+	_ = gc.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(WSTimeout))
+	gc.ws.Close()
+}
+
+// marshalPayload encodes a message payload. If encoding fails, the error is
+// logged and the fallback payload is returned.
+func (gc *graphqlConn) marshalPayload(v interface{}, fallback json.RawMessage) json.RawMessage {
+	out, err := json.Marshal(v)
+	if err != nil {
+		gc.c.Errorf("Error encoding GraphQL payload: %s", err)
+		return fallback
+	}
+	return out
+}
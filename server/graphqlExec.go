@@ -0,0 +1,459 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/graphql"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+	"github.com/resgateio/resgate/server/rpc"
+)
+
+// GraphQL root types and the object type of resolved models.
+const (
+	graphqlQuery        = "Query"
+	graphqlMutation     = "Mutation"
+	graphqlSubscription = "Subscription"
+	graphqlModel        = "Model"
+)
+
+// graphqlRIDField is a meta field resolving to the resource ID of a model.
+const graphqlRIDField = "_rid"
+
+var errGraphQLSubscriptionOverHTTP = &graphql.Error{Message: "Subscriptions require a WebSocket connection"}
+
+// graphqlOperation is a parsed GraphQL operation, ready to be executed.
+type graphqlOperation struct {
+	doc    *graphql.Document
+	op     *graphql.Operation
+	vars   graphql.Variables
+	fields []*graphql.CollectedField
+}
+
+// graphqlRootArgs are the arguments of a root field.
+type graphqlRootArgs struct {
+	RID    string          `json:"rid"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// graphqlExec resolves the fields of a GraphQL operation against the
+// resources of a connection. It is used on the connection's worker goroutine.
+type graphqlExec struct {
+	*graphqlOperation
+	c      *wsConn
+	isHTTP bool
+	b      bytes.Buffer
+	path   []interface{}
+	errs   []*graphql.Error
+	rids   map[string]bool // Resources resolved by the last call to resolve
+}
+
+// prepareGraphQL parses a GraphQL request and validates its root fields.
+func prepareGraphQL(req *graphql.Request) (*graphqlOperation, error) {
+	doc, err := graphql.Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := doc.Operation(req.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := doc.CoerceVariables(op, req.Variables)
+	if err != nil {
+		return nil, err
+	}
+	o := &graphqlOperation{doc: doc, op: op, vars: vars}
+	if o.fields, err = doc.CollectFields(op.SelectionSet, o.rootType(), vars); err != nil {
+		return nil, err
+	}
+
+	if op.Type == "subscription" && (len(o.fields) != 1 || o.fields[0].Name == "__typename") {
+		return nil, &graphql.Error{Message: "Subscription operations must have exactly one root field"}
+	}
+	for _, f := range o.fields {
+		if err := o.validateRootField(f); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func (o *graphqlOperation) rootType() string {
+	switch o.op.Type {
+	case "mutation":
+		return graphqlMutation
+	case "subscription":
+		return graphqlSubscription
+	}
+	return graphqlQuery
+}
+
+// validateRootField validates the name and arguments of a root field.
+func (o *graphqlOperation) validateRootField(f *graphql.CollectedField) error {
+	if f.Name == "__typename" {
+		return nil
+	}
+	var known bool
+	var allowed map[string]bool
+	switch o.op.Type {
+	case "query", "subscription":
+		known = f.Name == "resource"
+		allowed = map[string]bool{"rid": true}
+	case "mutation":
+		known = f.Name == "call" || f.Name == "auth"
+		allowed = map[string]bool{"rid": true, "method": true, "params": true}
+	}
+	if !known {
+		return o.doc.Errorf(f.Field, nil, "Cannot query field %q on type %q", f.Name, o.rootType())
+	}
+	for _, arg := range f.Arguments {
+		if !allowed[arg.Name] {
+			return o.doc.Errorf(f.Field, nil, "Unknown argument %q on field %q", arg.Name, f.Name)
+		}
+	}
+	return nil
+}
+
+// rootArgs returns the arguments of a root field, validating the resource ID
+// and method.
+func (o *graphqlOperation) rootArgs(f *graphql.CollectedField, withMethod bool) (*graphqlRootArgs, error) {
+	vals, err := o.doc.ArgumentValues(f.Field, o.vars)
+	if err != nil {
+		return nil, err
+	}
+	var args graphqlRootArgs
+	if json.Unmarshal(vals["rid"], &args.RID) != nil || !codec.IsValidRID(args.RID, true) {
+		return nil, reserr.ErrInvalidParams
+	}
+	if withMethod {
+		if json.Unmarshal(vals["method"], &args.Method) != nil || !codec.IsValidRIDPart(args.Method) {
+			return nil, reserr.ErrInvalidParams
+		}
+		args.Params = vals["params"]
+	}
+	return &args, nil
+}
+
+func newGraphQLExec(o *graphqlOperation, c *wsConn, isHTTP bool) *graphqlExec {
+	return &graphqlExec{graphqlOperation: o, c: c, isHTTP: isHTTP}
+}
+
+// execute executes a query or mutation operation. Root fields are resolved
+// one at a time, in order.
+func (e *graphqlExec) execute(cb func(*graphql.Response)) {
+	if e.op.Type == "subscription" {
+		cb(&graphql.Response{Errors: []*graphql.Error{errGraphQLSubscriptionOverHTTP}})
+		return
+	}
+	e.b.WriteByte('{')
+	e.executeField(0, func() {
+		e.b.WriteByte('}')
+		cb(e.response())
+	})
+}
+
+func (e *graphqlExec) executeField(i int, done func()) {
+	if i == len(e.fields) {
+		done()
+		return
+	}
+	f := e.fields[i]
+	if i > 0 {
+		e.b.WriteByte(',')
+	}
+	e.writeKey(f.ResponseKey())
+	e.path = append(e.path[:0], f.ResponseKey())
+	next := func() { e.executeField(i+1, done) }
+
+	switch f.Name {
+	case "__typename":
+		e.writeString(e.rootType())
+		next()
+	case "resource":
+		args, err := e.rootArgs(f, false)
+		if err != nil {
+			e.fieldError(f, err)
+			next()
+			return
+		}
+		e.get(args.RID, func(sub *Subscription, err error) {
+			if err != nil {
+				e.fieldError(f, err)
+			} else {
+				e.resource(f, sub)
+			}
+			next()
+		})
+	case "call", "auth":
+		args, err := e.rootArgs(f, true)
+		if err != nil {
+			e.fieldError(f, err)
+			next()
+			return
+		}
+		e.request(f.Name, args, func(result json.RawMessage, refRID string, err error) {
+			switch {
+			case err != nil:
+				e.fieldError(f, err)
+				next()
+			case refRID != "" && len(f.SelectionSet) == 0:
+				e.writeString(refRID)
+				next()
+			case refRID != "":
+				e.get(refRID, func(sub *Subscription, err error) {
+					if err != nil {
+						e.fieldError(f, err)
+					} else {
+						e.resource(f, sub)
+					}
+					next()
+				})
+			case len(f.SelectionSet) > 0:
+				e.fieldError(f, e.doc.Errorf(f.Field, e.path, "Result of %q is not a resource", f.Name))
+				next()
+			default:
+				e.writeJSON(result)
+				next()
+			}
+		})
+	}
+}
+
+// get loads a resource, calling the callback once the resource and all its
+// references are loaded. The subscription is only valid during the callback.
+func (e *graphqlExec) get(rid string, cb func(sub *Subscription, err error)) {
+	if e.isHTTP {
+		e.c.GetHTTPSubscription(rid, func(sub *Subscription, meta *codec.Meta, err error) {
+			if err == nil && sub == nil {
+				err = statusError(*meta.Status)
+			}
+			cb(sub, err)
+		})
+		return
+	}
+	e.c.SubscribeResource(rid, nil, nil, func(_ *rpc.Resources, err error) {
+		if err != nil {
+			cb(nil, err)
+			return
+		}
+		cb(e.c.subs[rid], nil)
+		e.c.UnsubscribeByRID(rid, 1)
+	})
+}
+
+// request sends a call or auth request.
+func (e *graphqlExec) request(typ string, args *graphqlRootArgs, cb func(result json.RawMessage, refRID string, err error)) {
+	var params interface{}
+	if args.Params != nil {
+		params = args.Params
+	}
+	if err := e.c.serv.checkParamsSize(params); err != nil {
+		cb(nil, "", err)
+		return
+	}
+	if typ == "auth" {
+		rname, query := parseRID(e.c.ExpandCID(args.RID))
+		e.c.tenant.cache.Auth(e.c, rname, query, args.Method, e.c.token, params, e.isHTTP, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
+			e.c.Enqueue(func() {
+				cb(result, refRID, err)
+			})
+		})
+		return
+	}
+	if e.isHTTP {
+		if err := e.c.serv.validateCallParams(args.RID, args.Method, params); err != nil {
+			cb(nil, "", err)
+			return
+		}
+		e.c.CallHTTPResource(args.RID, args.Method, params, func(result json.RawMessage, refRID string, err error, meta *codec.Meta) {
+			if err == nil && meta.IsDirectResponseStatus() {
+				err = statusError(*meta.Status)
+			}
+			cb(result, refRID, err)
+		})
+		return
+	}
+	e.c.call(args.RID, args.Method, params, cb)
+}
+
+// resolve resolves the single root field of a subscription operation using
+// a loaded subscription, and returns the response.
+func (e *graphqlExec) resolve(sub *Subscription) *graphql.Response {
+	f := e.fields[0]
+	e.b.Reset()
+	e.errs = nil
+	e.rids = make(map[string]bool)
+	e.path = append(e.path[:0], f.ResponseKey())
+	e.b.WriteByte('{')
+	e.writeKey(f.ResponseKey())
+	e.resource(f, sub)
+	e.b.WriteByte('}')
+	return e.response()
+}
+
+// resolveError returns a response for a subscription operation where the
+// root field failed with an error.
+func (e *graphqlExec) resolveError(err error) *graphql.Response {
+	f := e.fields[0]
+	e.b.Reset()
+	e.errs = nil
+	e.path = append(e.path[:0], f.ResponseKey())
+	e.b.WriteByte('{')
+	e.writeKey(f.ResponseKey())
+	e.fieldError(f, err)
+	e.b.WriteByte('}')
+	return e.response()
+}
+
+func (e *graphqlExec) response() *graphql.Response {
+	return &graphql.Response{
+		Data:   json.RawMessage(e.b.Bytes()),
+		Errors: e.errs,
+	}
+}
+
+// resource writes a model as an object, or a collection as a list, with the
+// selection set of the field.
+func (e *graphqlExec) resource(f *graphql.CollectedField, sub *Subscription) {
+	if sub == nil {
+		e.fieldError(f, reserr.ErrInternalError)
+		return
+	}
+	if e.rids != nil {
+		e.rids[sub.RID()] = true
+	}
+	if err := sub.Error(); err != nil {
+		e.fieldError(f, err)
+		return
+	}
+
+	switch sub.ResourceType() {
+	case rescache.TypeCollection:
+		e.b.WriteByte('[')
+		for i, v := range sub.CollectionValues() {
+			if i > 0 {
+				e.b.WriteByte(',')
+			}
+			e.path = append(e.path, i)
+			e.value(f, sub, v, true)
+			e.path = e.path[:len(e.path)-1]
+		}
+		e.b.WriteByte(']')
+	case rescache.TypeModel:
+		e.model(f, sub)
+	default:
+		e.fieldError(f, reserr.ErrInternalError)
+	}
+}
+
+func (e *graphqlExec) model(f *graphql.CollectedField, sub *Subscription) {
+	if len(f.SelectionSet) == 0 {
+		e.fieldError(f, e.doc.Errorf(f.Field, e.path, "Field %q of type %q must have a selection of subfields", f.Name, graphqlModel))
+		return
+	}
+	fields, err := e.doc.CollectFields(f.SelectionSet, graphqlModel, e.vars)
+	if err != nil {
+		e.fieldError(f, err)
+		return
+	}
+
+	vals := sub.ModelValues()
+	e.b.WriteByte('{')
+	for i, pf := range fields {
+		if i > 0 {
+			e.b.WriteByte(',')
+		}
+		e.writeKey(pf.ResponseKey())
+		e.path = append(e.path, pf.ResponseKey())
+
+		switch {
+		case len(pf.Arguments) > 0:
+			e.fieldError(pf, e.doc.Errorf(pf.Field, e.path, "Unknown argument %q on field %q", pf.Arguments[0].Name, pf.Name))
+		case pf.Name == "__typename":
+			e.writeString(graphqlModel)
+		case pf.Name == graphqlRIDField:
+			e.writeString(sub.RID())
+		default:
+			if v, ok := vals[pf.Name]; ok {
+				e.value(pf, sub, v, false)
+			} else {
+				e.b.Write(nullBytes)
+			}
+		}
+
+		e.path = e.path[:len(e.path)-1]
+	}
+	e.b.WriteByte('}')
+}
+
+// value writes a model property or collection item. Primitive collection
+// items are written as is, even if the field has a selection set.
+func (e *graphqlExec) value(f *graphql.CollectedField, sub *Subscription, v codec.Value, inCollection bool) {
+	switch v.Type {
+	case codec.ValueTypeReference:
+		if len(f.SelectionSet) == 0 {
+			e.fieldError(f, e.doc.Errorf(f.Field, e.path, "Field %q is a resource reference and must have a selection of subfields", f.Name))
+			return
+		}
+		e.resource(f, sub.Ref(v.RID))
+		return
+	case codec.ValueTypeSoftReference:
+		if len(f.SelectionSet) > 0 && !inCollection {
+			e.fieldError(f, e.doc.Errorf(f.Field, e.path, "Field %q is a soft resource reference and cannot have a selection of subfields", f.Name))
+			return
+		}
+		e.writeString(v.RID)
+		return
+	}
+
+	if len(f.SelectionSet) > 0 && !inCollection {
+		e.fieldError(f, e.doc.Errorf(f.Field, e.path, "Field %q is not a resource and cannot have a selection of subfields", f.Name))
+		return
+	}
+	if v.Type == codec.ValueTypeData {
+		e.b.Write(v.Inner)
+	} else {
+		e.b.Write(v.RawMessage)
+	}
+}
+
+// fieldError writes null as the field value and adds the error to the
+// response errors.
+func (e *graphqlExec) fieldError(f *graphql.CollectedField, err error) {
+	e.b.Write(nullBytes)
+
+	var gerr *graphql.Error
+	if !errors.As(err, &gerr) {
+		rerr := reserr.RESError(err)
+		gerr = e.doc.Errorf(f.Field, e.path, "%s", rerr.Message)
+		gerr.Extensions = map[string]interface{}{"code": rerr.Code}
+		if rerr.Data != nil {
+			gerr.Extensions["data"] = rerr.Data
+		}
+	} else if gerr.Path == nil {
+		gerr.Path = append([]interface{}(nil), e.path...)
+	}
+	e.errs = append(e.errs, gerr)
+}
+
+func (e *graphqlExec) writeKey(key string) {
+	e.writeString(key)
+	e.b.WriteByte(':')
+}
+
+func (e *graphqlExec) writeString(s string) {
+	dta, _ := json.Marshal(s)
+	e.b.Write(dta)
+}
+
+func (e *graphqlExec) writeJSON(v json.RawMessage) {
+	if len(v) == 0 {
+		e.b.Write(nullBytes)
+		return
+	}
+	e.b.Write(v)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/graphql"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const graphqlContentType = "application/json; charset=utf-8"
+
+var errGraphQLGETOperation = &graphql.Error{Message: "Can only perform a query operation from a GET request"}
+
+// graphqlHandler handles GraphQL requests over HTTP, or upgrades the
+// connection to a GraphQL WebSocket connection.
+func (s *Service) graphqlHandler(w http.ResponseWriter, r *http.Request, t *tenant) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.graphqlWSHandler(w, r, t)
+		return
+	}
+
+	err := s.setCommonHeaders(w, r)
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		reqHeaders := r.Header["Access-Control-Request-Headers"]
+		if len(reqHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+		}
+		return
+	}
+	if err != nil {
+		graphqlHTTPError(w, http.StatusForbidden, err)
+		return
+	}
+
+	var req graphql.Request
+	switch r.Method {
+	case "GET":
+		// Metrics
+		if s.metrics != nil {
+			s.metrics.HTTPRequestsGet.Add(1)
+		}
+
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				graphqlHTTPError(w, http.StatusBadRequest, &graphql.Error{Message: "Variables are invalid JSON"})
+				return
+			}
+		}
+	case "POST":
+		// Metrics
+		if s.metrics != nil {
+			s.metrics.HTTPRequestsPost.Add(1)
+		}
+
+		s.limitBody(w, r)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			if s.isBodyTooLargeError(err) {
+				graphqlHTTPError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+				return
+			}
+			graphqlHTTPError(w, http.StatusBadRequest, &graphql.Error{Message: "Request body is not a valid GraphQL request"})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		graphqlHTTPError(w, http.StatusMethodNotAllowed, reserr.ErrMethodNotAllowed)
+		return
+	}
+
+	o, err := prepareGraphQL(&req)
+	if err != nil {
+		graphqlHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case r.Method == "GET" && o.op.Type != "query":
+		w.Header().Set("Allow", "POST")
+		graphqlHTTPError(w, http.StatusMethodNotAllowed, errGraphQLGETOperation)
+		return
+	case o.op.Type == "subscription":
+		graphqlHTTPError(w, http.StatusBadRequest, errGraphQLSubscriptionOverHTTP)
+		return
+	}
+
+	c := s.newWSConn(r, t, versionLatest)
+	if c == nil {
+		graphqlHTTPError(w, http.StatusServiceUnavailable, reserr.ErrServiceUnavailable)
+		return
+	}
+
+	done := make(chan struct{})
+	execute := func() {
+		newGraphQLExec(o, c, true).execute(func(resp *graphql.Response) {
+			writeGraphQLResponse(w, http.StatusOK, resp)
+			c.dispose()
+			close(done)
+		})
+	}
+	c.Enqueue(func() {
+		if s.cfg.HeaderAuth == nil {
+			execute()
+			return
+		}
+		c.AuthResourceNoResult(s.cfg.headerAuthRID, s.cfg.headerAuthAction, nil, func(refRID string, err error, meta *codec.Meta) {
+			// Validate the status of the meta object.
+			if !meta.IsValidStatus() {
+				s.Errorf("Invalid meta status: %d", *meta.Status)
+				meta.Status = nil
+			}
+			codec.MergeHeader(w.Header(), meta.GetHeader())
+			if meta.IsDirectResponseStatus() {
+				graphqlStatusResponse(w, *meta.Status, RIDToPath(refRID, t.apiPath), err)
+				c.dispose()
+				close(done)
+				return
+			}
+			execute()
+		})
+	})
+	<-done
+}
+
+// graphqlStatusResponse writes a response with a status set by a meta
+// object, with any error encoded as a GraphQL error.
+func graphqlStatusResponse(w http.ResponseWriter, status int, href string, err error) {
+	if status >= 300 && status < 400 {
+		if href != "" && w.Header().Get("Location") == "" {
+			w.Header().Set("Location", href)
+		}
+		w.WriteHeader(status)
+		return
+	}
+	if err == nil {
+		err = statusError(status)
+	}
+	graphqlHTTPError(w, status, err)
+}
+
+// graphqlHTTPError writes a GraphQL response without data, containing a
+// single error.
+func graphqlHTTPError(w http.ResponseWriter, status int, err error) {
+	writeGraphQLResponse(w, status, &graphql.Response{Errors: []*graphql.Error{toGraphQLError(err)}})
+}
+
+// toGraphQLError converts an error to a GraphQL error, with the code of any
+// RES error set as an extension.
+func toGraphQLError(err error) *graphql.Error {
+	rerr, ok := err.(*reserr.Error)
+	if !ok {
+		return graphql.ToError(err)
+	}
+	gerr := &graphql.Error{
+		Message:    rerr.Message,
+		Extensions: map[string]interface{}{"code": rerr.Code},
+	}
+	if rerr.Data != nil {
+		gerr.Extensions["data"] = rerr.Data
+	}
+	return gerr
+}
+
+func writeGraphQLResponse(w http.ResponseWriter, status int, resp *graphql.Response) {
+	out, err := json.Marshal(resp)
+	if err != nil {
+		out = []byte(`{"errors":[{"message":"Internal error"}]}`)
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", graphqlContentType)
+	w.WriteHeader(status)
+	w.Write(out)
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -12,27 +14,43 @@ func (s *Service) initHTTPServer() {
 
 // startHTTPServer initializes the server and starts a goroutine with a http
 // server Service.mu is held when called.
-func (s *Service) startHTTPServer() {
+func (s *Service) startHTTPServer() error {
 	if s.cfg.NoHTTP {
-		return
+		return nil
 	}
 
-	s.Logf("Listening on %s://%s", s.cfg.scheme, s.cfg.netAddr)
 	h := &http.Server{Addr: s.cfg.netAddr, Handler: s}
+	if s.cfg.tlsClientAuth != tls.NoClientCert {
+		h.TLSConfig = &tls.Config{
+			ClientAuth: s.cfg.tlsClientAuth,
+			ClientCAs:  s.cfg.tlsClientCAs,
+		}
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.netAddr)
+	if err != nil {
+		return err
+	}
+	if s.cfg.ProxyProtocol {
+		ln = &proxyProtoListener{Listener: ln, s: s}
+	}
+
+	s.Logf("Listening on %s://%s", s.cfg.scheme, s.cfg.netAddr)
 	s.h = h
 
 	go func() {
 		var err error
 		if s.cfg.TLS {
-			err = h.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+			err = h.ServeTLS(ln, s.cfg.TLSCert, s.cfg.TLSKey)
 		} else {
-			err = h.ListenAndServe()
+			err = h.Serve(ln)
 		}
 
 		if err != nil {
 			s.Stop(err)
 		}
 	}()
+	return nil
 }
 
 // stopHTTPServer stops the http server
@@ -69,11 +87,18 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r = s.resolveForwarded(r)
+	t := s.tenantFor(r)
+
 	switch {
-	case r.URL.Path == s.cfg.WSPath:
-		s.wsHandler(w, r)
-	case strings.HasPrefix(r.URL.Path, s.cfg.APIPath):
-		s.apiHandler(w, r)
+	case r.URL.Path == t.wsPath:
+		s.wsHandler(w, r, t)
+	case t.graphqlPath != "" && r.URL.Path == t.graphqlPath:
+		s.graphqlHandler(w, r, t)
+	case t.openAPIPath != "" && r.URL.Path == t.openAPIPath:
+		s.openAPIHandler(w, r, t)
+	case strings.HasPrefix(r.URL.Path, t.apiPath):
+		s.apiHandler(w, r, t)
 	default:
 		notFoundHandler(w, s.enc)
 	}
@@ -0,0 +1,652 @@
+// Package jsonschema implements validation of JSON values against a subset of
+// JSON Schema (draft 7).
+//
+// Supported keywords are type, enum, const, properties, required,
+// additionalProperties, patternProperties, minProperties, maxProperties,
+// items, additionalItems, minItems, maxItems, uniqueItems, minLength,
+// maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf, not, and $ref to a JSON pointer within the
+// same schema, such as "#/definitions/name". Other keywords are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	// Boolean schema. Nil for object schemas.
+	always *bool
+
+	types    []string
+	enum     []interface{}
+	hasConst bool
+	cnst     interface{}
+
+	properties    map[string]*Schema
+	patternProps  []patternSchema
+	additional    *Schema
+	required      []string
+	minProperties int
+	maxProperties int
+
+	items           *Schema
+	itemsList       []*Schema
+	additionalItems *Schema
+	minItems        int
+	maxItems        int
+	uniqueItems     bool
+
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+
+	minimum    *float64
+	maximum    *float64
+	exclMin    *float64
+	exclMax    *float64
+	multipleOf *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+	ref   *Schema
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *Schema
+}
+
+// Error is a validation error of a value.
+type Error struct {
+	// Path is the JSON pointer to the invalid value. Empty for the root value.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of validation errors.
+type Errors []*Error
+
+// compiler holds the state while compiling a schema.
+type compiler struct {
+	root interface{}
+	refs map[string]*Schema
+}
+
+// Compile compiles a JSON encoded schema.
+func Compile(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	c := compiler{root: root, refs: make(map[string]*Schema)}
+	return c.compile(root, "#")
+}
+
+// MustCompile is like Compile but panics if the schema cannot be compiled.
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic("jsonschema: " + err.Error())
+	}
+	return s
+}
+
+// Error returns the error message prefixed by the path of the value.
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Error returns the error messages of all validation errors.
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateJSON validates a JSON encoded value. A non-nil error is returned if
+// the data is not valid JSON.
+func (s *Schema) ValidateJSON(data []byte) (Errors, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return s.Validate(v), nil
+}
+
+// Validate validates a value decoded by encoding/json into an interface{}.
+// It returns nil if the value is valid.
+func (s *Schema) Validate(v interface{}) Errors {
+	var errs Errors
+	s.validate(v, "", &errs)
+	return errs
+}
+
+func (c *compiler) compile(v interface{}, ptr string) (*Schema, error) {
+	if b, ok := v.(bool); ok {
+		return &Schema{always: &b}, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %s must be an object or a boolean", ptr)
+	}
+
+	s := &Schema{minProperties: -1, maxProperties: -1, minItems: -1, maxItems: -1, minLength: -1, maxLength: -1}
+	var err error
+
+	if r, ok := m["$ref"]; ok {
+		ref, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("$ref at %s must be a string", ptr)
+		}
+		if s.ref, err = c.resolve(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	if t, ok := m["type"]; ok {
+		switch tv := t.(type) {
+		case string:
+			s.types = []string{tv}
+		case []interface{}:
+			for _, it := range tv {
+				str, ok := it.(string)
+				if !ok {
+					return nil, fmt.Errorf("type at %s must be a string or an array of strings", ptr)
+				}
+				s.types = append(s.types, str)
+			}
+		default:
+			return nil, fmt.Errorf("type at %s must be a string or an array of strings", ptr)
+		}
+		for _, t := range s.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return nil, fmt.Errorf("unknown type %q at %s", t, ptr)
+			}
+		}
+	}
+
+	if e, ok := m["enum"]; ok {
+		if s.enum, ok = e.([]interface{}); !ok {
+			return nil, fmt.Errorf("enum at %s must be an array", ptr)
+		}
+	}
+	if cv, ok := m["const"]; ok {
+		s.hasConst = true
+		s.cnst = cv
+	}
+
+	// Object keywords
+	if p, ok := m["properties"]; ok {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("properties at %s must be an object", ptr)
+		}
+		s.properties = make(map[string]*Schema, len(pm))
+		for k, pv := range pm {
+			if s.properties[k], err = c.compile(pv, ptr+"/properties/"+escape(k)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p, ok := m["patternProperties"]; ok {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("patternProperties at %s must be an object", ptr)
+		}
+		keys := sortedKeys(pm)
+		for _, k := range keys {
+			re, err := regexp.Compile(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q at %s: %s", k, ptr, err)
+			}
+			ps, err := c.compile(pm[k], ptr+"/patternProperties/"+escape(k))
+			if err != nil {
+				return nil, err
+			}
+			s.patternProps = append(s.patternProps, patternSchema{re: re, schema: ps})
+		}
+	}
+	if a, ok := m["additionalProperties"]; ok {
+		if s.additional, err = c.compile(a, ptr+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if r, ok := m["required"]; ok {
+		rl, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("required at %s must be an array of strings", ptr)
+		}
+		for _, rv := range rl {
+			str, ok := rv.(string)
+			if !ok {
+				return nil, fmt.Errorf("required at %s must be an array of strings", ptr)
+			}
+			s.required = append(s.required, str)
+		}
+	}
+	if s.minProperties, err = nonNegative(m, "minProperties", ptr); err != nil {
+		return nil, err
+	}
+	if s.maxProperties, err = nonNegative(m, "maxProperties", ptr); err != nil {
+		return nil, err
+	}
+
+	// Array keywords
+	if it, ok := m["items"]; ok {
+		if il, ok := it.([]interface{}); ok {
+			s.itemsList = make([]*Schema, len(il))
+			for i, iv := range il {
+				if s.itemsList[i], err = c.compile(iv, ptr+"/items/"+strconv.Itoa(i)); err != nil {
+					return nil, err
+				}
+			}
+		} else if s.items, err = c.compile(it, ptr+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	if a, ok := m["additionalItems"]; ok {
+		if s.additionalItems, err = c.compile(a, ptr+"/additionalItems"); err != nil {
+			return nil, err
+		}
+	}
+	if s.minItems, err = nonNegative(m, "minItems", ptr); err != nil {
+		return nil, err
+	}
+	if s.maxItems, err = nonNegative(m, "maxItems", ptr); err != nil {
+		return nil, err
+	}
+	if u, ok := m["uniqueItems"]; ok {
+		if s.uniqueItems, ok = u.(bool); !ok {
+			return nil, fmt.Errorf("uniqueItems at %s must be a boolean", ptr)
+		}
+	}
+
+	// String keywords
+	if s.minLength, err = nonNegative(m, "minLength", ptr); err != nil {
+		return nil, err
+	}
+	if s.maxLength, err = nonNegative(m, "maxLength", ptr); err != nil {
+		return nil, err
+	}
+	if p, ok := m["pattern"]; ok {
+		str, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern at %s must be a string", ptr)
+		}
+		if s.pattern, err = regexp.Compile(str); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q at %s: %s", str, ptr, err)
+		}
+	}
+
+	// Number keywords
+	for _, kw := range []struct {
+		name string
+		dst  **float64
+	}{
+		{"minimum", &s.minimum},
+		{"maximum", &s.maximum},
+		{"exclusiveMinimum", &s.exclMin},
+		{"exclusiveMaximum", &s.exclMax},
+		{"multipleOf", &s.multipleOf},
+	} {
+		if n, ok := m[kw.name]; ok {
+			f, ok := n.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s at %s must be a number", kw.name, ptr)
+			}
+			*kw.dst = &f
+		}
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return nil, fmt.Errorf("multipleOf at %s must be greater than 0", ptr)
+	}
+
+	// Combining keywords
+	for _, kw := range []struct {
+		name string
+		dst  *[]*Schema
+	}{
+		{"allOf", &s.allOf},
+		{"anyOf", &s.anyOf},
+		{"oneOf", &s.oneOf},
+	} {
+		if l, ok := m[kw.name]; ok {
+			ll, ok := l.([]interface{})
+			if !ok || len(ll) == 0 {
+				return nil, fmt.Errorf("%s at %s must be a non-empty array", kw.name, ptr)
+			}
+			*kw.dst = make([]*Schema, len(ll))
+			for i, lv := range ll {
+				if (*kw.dst)[i], err = c.compile(lv, ptr+"/"+kw.name+"/"+strconv.Itoa(i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if n, ok := m["not"]; ok {
+		if s.not, err = c.compile(n, ptr+"/not"); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// resolve returns the schema referenced by a JSON pointer fragment. Schemas
+// are compiled once, allowing recursive references.
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	if s, ok := c.refs[ref]; ok {
+		return s, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q: must be a JSON pointer fragment within the schema", ref)
+	}
+	frag, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %s", ref, err)
+	}
+
+	v := c.root
+	if frag != "" {
+		for _, tok := range strings.Split(frag[1:], "/") {
+			var ok bool
+			if v, ok = step(v, unescape(tok)); !ok {
+				return nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+		}
+	}
+
+	// Register a placeholder before compiling, to which recursive
+	// references resolve.
+	s := &Schema{}
+	c.refs[ref] = s
+	cs, err := c.compile(v, ref)
+	if err != nil {
+		return nil, err
+	}
+	*s = *cs
+	return s, nil
+}
+
+// step returns the member or element of an object or array referenced by a
+// JSON pointer reference token.
+func step(v interface{}, tok string) (interface{}, bool) {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		mv, ok := tv[tok]
+		return mv, ok
+	case []interface{}:
+		i, err := strconv.Atoi(tok)
+		if err != nil || i < 0 || i >= len(tv) {
+			return nil, false
+		}
+		return tv[i], true
+	}
+	return nil, false
+}
+
+func (s *Schema) validate(v interface{}, path string, errs *Errors) {
+	if s.always != nil {
+		if !*s.always {
+			addError(errs, path, "value is not allowed")
+		}
+		return
+	}
+
+	if s.ref != nil {
+		s.ref.validate(v, path, errs)
+	}
+
+	if s.types != nil && !matchesType(v, s.types) {
+		addError(errs, path, "must be of type "+strings.Join(s.types, " or "))
+		// Other keywords are type specific, and will add no further
+		// information.
+		return
+	}
+	if s.enum != nil && !containsValue(s.enum, v) {
+		addError(errs, path, "must be one of the enum values")
+	}
+	if s.hasConst && !reflect.DeepEqual(s.cnst, v) {
+		addError(errs, path, "must be equal to the const value")
+	}
+
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(tv, path, errs)
+	case []interface{}:
+		s.validateArray(tv, path, errs)
+	case string:
+		s.validateString(tv, path, errs)
+	case float64:
+		s.validateNumber(tv, path, errs)
+	}
+
+	for _, ss := range s.allOf {
+		ss.validate(v, path, errs)
+	}
+	if s.anyOf != nil {
+		valid := false
+		for _, ss := range s.anyOf {
+			if ss.Validate(v) == nil {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			addError(errs, path, "must match at least one schema in anyOf")
+		}
+	}
+	if s.oneOf != nil {
+		n := 0
+		for _, ss := range s.oneOf {
+			if ss.Validate(v) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			addError(errs, path, "must match exactly one schema in oneOf")
+		}
+	}
+	if s.not != nil && s.not.Validate(v) == nil {
+		addError(errs, path, "must not match the schema in not")
+	}
+}
+
+func (s *Schema) validateObject(m map[string]interface{}, path string, errs *Errors) {
+	for _, k := range s.required {
+		if _, ok := m[k]; !ok {
+			addError(errs, path, fmt.Sprintf("missing required property %q", k))
+		}
+	}
+	if s.minProperties >= 0 && len(m) < s.minProperties {
+		addError(errs, path, fmt.Sprintf("must have at least %d properties", s.minProperties))
+	}
+	if s.maxProperties >= 0 && len(m) > s.maxProperties {
+		addError(errs, path, fmt.Sprintf("must have at most %d properties", s.maxProperties))
+	}
+	for _, k := range sortedKeys(m) {
+		pv := m[k]
+		ppath := path + "/" + escape(k)
+		matched := false
+		if ps, ok := s.properties[k]; ok {
+			matched = true
+			ps.validate(pv, ppath, errs)
+		}
+		for _, pp := range s.patternProps {
+			if pp.re.MatchString(k) {
+				matched = true
+				pp.schema.validate(pv, ppath, errs)
+			}
+		}
+		if !matched && s.additional != nil {
+			if s.additional.always != nil && !*s.additional.always {
+				addError(errs, path, fmt.Sprintf("property %q is not allowed", k))
+			} else {
+				s.additional.validate(pv, ppath, errs)
+			}
+		}
+	}
+}
+
+func (s *Schema) validateArray(l []interface{}, path string, errs *Errors) {
+	if s.minItems >= 0 && len(l) < s.minItems {
+		addError(errs, path, fmt.Sprintf("must have at least %d items", s.minItems))
+	}
+	if s.maxItems >= 0 && len(l) > s.maxItems {
+		addError(errs, path, fmt.Sprintf("must have at most %d items", s.maxItems))
+	}
+	for i, iv := range l {
+		ipath := path + "/" + strconv.Itoa(i)
+		switch {
+		case s.items != nil:
+			s.items.validate(iv, ipath, errs)
+		case i < len(s.itemsList):
+			s.itemsList[i].validate(iv, ipath, errs)
+		case s.itemsList != nil && s.additionalItems != nil:
+			s.additionalItems.validate(iv, ipath, errs)
+		}
+	}
+	if s.uniqueItems {
+		for i := 1; i < len(l); i++ {
+			if containsValue(l[:i], l[i]) {
+				addError(errs, path, "must have unique items")
+				break
+			}
+		}
+	}
+}
+
+func (s *Schema) validateString(str string, path string, errs *Errors) {
+	if s.minLength >= 0 || s.maxLength >= 0 {
+		n := utf8.RuneCountInString(str)
+		if s.minLength >= 0 && n < s.minLength {
+			addError(errs, path, fmt.Sprintf("must be at least %d characters long", s.minLength))
+		}
+		if s.maxLength >= 0 && n > s.maxLength {
+			addError(errs, path, fmt.Sprintf("must be at most %d characters long", s.maxLength))
+		}
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		addError(errs, path, fmt.Sprintf("must match pattern %q", s.pattern.String()))
+	}
+}
+
+func (s *Schema) validateNumber(f float64, path string, errs *Errors) {
+	if s.minimum != nil && f < *s.minimum {
+		addError(errs, path, "must be greater than or equal to "+formatNumber(*s.minimum))
+	}
+	if s.maximum != nil && f > *s.maximum {
+		addError(errs, path, "must be less than or equal to "+formatNumber(*s.maximum))
+	}
+	if s.exclMin != nil && f <= *s.exclMin {
+		addError(errs, path, "must be greater than "+formatNumber(*s.exclMin))
+	}
+	if s.exclMax != nil && f >= *s.exclMax {
+		addError(errs, path, "must be less than "+formatNumber(*s.exclMax))
+	}
+	if s.multipleOf != nil {
+		q := f / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			addError(errs, path, "must be a multiple of "+formatNumber(*s.multipleOf))
+		}
+	}
+}
+
+func matchesType(v interface{}, types []string) bool {
+	for _, t := range types {
+		switch tv := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && tv == math.Trunc(tv)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(l []interface{}, v interface{}) bool {
+	for _, lv := range l {
+		if reflect.DeepEqual(lv, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func nonNegative(m map[string]interface{}, name, ptr string) (int, error) {
+	n, ok := m[name]
+	if !ok {
+		return -1, nil
+	}
+	f, ok := n.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s at %s must be a non-negative integer", name, ptr)
+	}
+	return int(f), nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape escapes a JSON pointer reference token.
+func escape(tok string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(tok)
+}
+
+// unescape unescapes a JSON pointer reference token.
+func unescape(tok string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func addError(errs *Errors, path, msg string) {
+	*errs = append(*errs, &Error{Path: path, Message: msg})
+}
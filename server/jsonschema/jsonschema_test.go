@@ -0,0 +1,228 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test validating values against schema keywords
+func TestValidate(t *testing.T) {
+	tbl := []struct {
+		Schema   string
+		Value    string
+		Expected []string // Expected errors as "path: message", or only message for the root value
+	}{
+		// Boolean schemas
+		{`true`, `{"a":1}`, nil},
+		{`false`, `1`, []string{"value is not allowed"}},
+		{`{}`, `null`, nil},
+		// type
+		{`{"type":"null"}`, `null`, nil},
+		{`{"type":"null"}`, `false`, []string{"must be of type null"}},
+		{`{"type":"boolean"}`, `true`, nil},
+		{`{"type":"boolean"}`, `"true"`, []string{"must be of type boolean"}},
+		{`{"type":"object"}`, `{}`, nil},
+		{`{"type":"object"}`, `[]`, []string{"must be of type object"}},
+		{`{"type":"array"}`, `[]`, nil},
+		{`{"type":"array"}`, `{}`, []string{"must be of type array"}},
+		{`{"type":"string"}`, `""`, nil},
+		{`{"type":"string"}`, `1`, []string{"must be of type string"}},
+		{`{"type":"number"}`, `1.5`, nil},
+		{`{"type":"number"}`, `"1"`, []string{"must be of type number"}},
+		{`{"type":"integer"}`, `2`, nil},
+		{`{"type":"integer"}`, `2.0`, nil},
+		{`{"type":"integer"}`, `2.5`, []string{"must be of type integer"}},
+		{`{"type":["string","null"]}`, `null`, nil},
+		{`{"type":["string","null"]}`, `1`, []string{"must be of type string or null"}},
+		{`{"type":"string","minLength":5}`, `1`, []string{"must be of type string"}},
+		// enum and const
+		{`{"enum":["a",1,null,{"b":true}]}`, `"a"`, nil},
+		{`{"enum":["a",1,null,{"b":true}]}`, `1`, nil},
+		{`{"enum":["a",1,null,{"b":true}]}`, `{"b":true}`, nil},
+		{`{"enum":["a",1,null,{"b":true}]}`, `"b"`, []string{"must be one of the enum values"}},
+		{`{"const":[1,"a"]}`, `[1,"a"]`, nil},
+		{`{"const":[1,"a"]}`, `["a",1]`, []string{"must be equal to the const value"}},
+		// properties
+		{`{"properties":{"a":{"type":"string"}}}`, `{"a":"x","b":1}`, nil},
+		{`{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, []string{"/a: must be of type string"}},
+		{`{"properties":{"a/b~c":{"type":"string"}}}`, `{"a/b~c":1}`, []string{"/a~1b~0c: must be of type string"}},
+		{`{"properties":{"a":{"properties":{"b":{"type":"string"}}}}}`, `{"a":{"b":1}}`, []string{"/a/b: must be of type string"}},
+		{`{"properties":{"a":{"type":"string"}}}`, `"not an object"`, nil},
+		// required
+		{`{"required":["a","b"]}`, `{"a":1,"b":2}`, nil},
+		{`{"required":["a","b"]}`, `{"b":2}`, []string{`missing required property "a"`}},
+		{`{"required":["a","b"]}`, `{}`, []string{`missing required property "a"`, `missing required property "b"`}},
+		// additionalProperties
+		{`{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1}`, nil},
+		{`{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, []string{`property "b" is not allowed`}},
+		{`{"additionalProperties":{"type":"number"}}`, `{"a":1,"b":2}`, nil},
+		{`{"additionalProperties":{"type":"number"}}`, `{"a":1,"b":"x"}`, []string{"/b: must be of type number"}},
+		// patternProperties
+		{`{"patternProperties":{"^x_":{"type":"number"}},"additionalProperties":false}`, `{"x_a":1}`, nil},
+		{`{"patternProperties":{"^x_":{"type":"number"}},"additionalProperties":false}`, `{"x_a":"1"}`, []string{"/x_a: must be of type number"}},
+		{`{"patternProperties":{"^x_":{"type":"number"}},"additionalProperties":false}`, `{"y":1}`, []string{`property "y" is not allowed`}},
+		{`{"properties":{"x_a":{"minimum":0}},"patternProperties":{"^x_":{"maximum":10}}}`, `{"x_a":20}`, []string{"/x_a: must be less than or equal to 10"}},
+		// minProperties and maxProperties
+		{`{"minProperties":1,"maxProperties":2}`, `{"a":1}`, nil},
+		{`{"minProperties":1,"maxProperties":2}`, `{}`, []string{"must have at least 1 properties"}},
+		{`{"minProperties":1,"maxProperties":2}`, `{"a":1,"b":2,"c":3}`, []string{"must have at most 2 properties"}},
+		// items
+		{`{"items":{"type":"string"}}`, `["a","b"]`, nil},
+		{`{"items":{"type":"string"}}`, `["a",1,"c",2]`, []string{"/1: must be of type string", "/3: must be of type string"}},
+		{`{"items":[{"type":"string"},{"type":"number"}]}`, `["a",1,true]`, nil},
+		{`{"items":[{"type":"string"},{"type":"number"}]}`, `[1,"a"]`, []string{"/0: must be of type string", "/1: must be of type number"}},
+		{`{"items":[{"type":"string"}],"additionalItems":false}`, `["a"]`, nil},
+		{`{"items":[{"type":"string"}],"additionalItems":false}`, `["a","b"]`, []string{"/1: value is not allowed"}},
+		{`{"items":[{}],"additionalItems":{"type":"number"}}`, `["a",1,"b"]`, []string{"/2: must be of type number"}},
+		{`{"additionalItems":false}`, `[1,2]`, nil},
+		// minItems, maxItems, and uniqueItems
+		{`{"minItems":1,"maxItems":2}`, `[1]`, nil},
+		{`{"minItems":1,"maxItems":2}`, `[]`, []string{"must have at least 1 items"}},
+		{`{"minItems":1,"maxItems":2}`, `[1,2,3]`, []string{"must have at most 2 items"}},
+		{`{"uniqueItems":true}`, `[1,"1",{"a":1},{"a":2}]`, nil},
+		{`{"uniqueItems":true}`, `[1,{"a":1},{"a":1}]`, []string{"must have unique items"}},
+		{`{"uniqueItems":false}`, `[1,1]`, nil},
+		// minLength, maxLength, and pattern
+		{`{"minLength":2,"maxLength":3}`, `"ab"`, nil},
+		{`{"minLength":2,"maxLength":3}`, `"åäö"`, nil},
+		{`{"minLength":2,"maxLength":3}`, `"a"`, []string{"must be at least 2 characters long"}},
+		{`{"minLength":2,"maxLength":3}`, `"abcd"`, []string{"must be at most 3 characters long"}},
+		{`{"pattern":"^[a-z]+$"}`, `"abc"`, nil},
+		{`{"pattern":"^[a-z]+$"}`, `"aBc"`, []string{`must match pattern "^[a-z]+$"`}},
+		{`{"pattern":"b"}`, `"abc"`, nil},
+		// minimum, maximum, exclusiveMinimum, and exclusiveMaximum
+		{`{"minimum":1,"maximum":3}`, `1`, nil},
+		{`{"minimum":1,"maximum":3}`, `3`, nil},
+		{`{"minimum":1,"maximum":3}`, `0.5`, []string{"must be greater than or equal to 1"}},
+		{`{"minimum":1,"maximum":3}`, `3.5`, []string{"must be less than or equal to 3"}},
+		{`{"exclusiveMinimum":1,"exclusiveMaximum":3}`, `2`, nil},
+		{`{"exclusiveMinimum":1,"exclusiveMaximum":3}`, `1`, []string{"must be greater than 1"}},
+		{`{"exclusiveMinimum":1,"exclusiveMaximum":3}`, `3`, []string{"must be less than 3"}},
+		{`{"minimum":1.5}`, `"0"`, nil},
+		// multipleOf
+		{`{"multipleOf":3}`, `9`, nil},
+		{`{"multipleOf":3}`, `-6`, nil},
+		{`{"multipleOf":3}`, `10`, []string{"must be a multiple of 3"}},
+		{`{"multipleOf":0.1}`, `0.3`, nil},
+		{`{"multipleOf":0.1}`, `0.35`, []string{"must be a multiple of 0.1"}},
+		// allOf, anyOf, oneOf, and not
+		{`{"allOf":[{"minimum":1},{"maximum":3}]}`, `2`, nil},
+		{`{"allOf":[{"minimum":1},{"maximum":3}]}`, `0`, []string{"must be greater than or equal to 1"}},
+		{`{"allOf":[{"minimum":1},{"maximum":-1}]}`, `0`, []string{"must be greater than or equal to 1", "must be less than or equal to -1"}},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, `1`, nil},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, `true`, []string{"must match at least one schema in anyOf"}},
+		{`{"oneOf":[{"type":"integer"},{"type":"string"}]}`, `1`, nil},
+		{`{"oneOf":[{"type":"integer"},{"type":"number"}]}`, `1`, []string{"must match exactly one schema in oneOf"}},
+		{`{"oneOf":[{"type":"integer"},{"type":"string"}]}`, `true`, []string{"must match exactly one schema in oneOf"}},
+		{`{"not":{"type":"null"}}`, `1`, nil},
+		{`{"not":{"type":"null"}}`, `null`, []string{"must not match the schema in not"}},
+		// $ref
+		{`{"definitions":{"id":{"type":"integer"}},"properties":{"a":{"$ref":"#/definitions/id"}}}`, `{"a":1}`, nil},
+		{`{"definitions":{"id":{"type":"integer"}},"properties":{"a":{"$ref":"#/definitions/id"}}}`, `{"a":"1"}`, []string{"/a: must be of type integer"}},
+		{`{"definitions":{"a b":{"type":"integer"}},"$ref":"#/definitions/a%20b"}`, `"1"`, []string{"must be of type integer"}},
+		{`{"definitions":{"a/b":{"type":"integer"}},"$ref":"#/definitions/a~1b"}`, `"1"`, []string{"must be of type integer"}},
+		{`{"items":[{"type":"integer"}],"$ref":"#/items/0"}`, `"1"`, []string{"must be of type integer"}},
+		{`{"properties":{"next":{"$ref":"#"}},"required":["v"]}`, `{"v":1,"next":{"v":2,"next":{}}}`, []string{`/next/next: missing required property "v"`}},
+		// Unknown keywords are ignored
+		{`{"format":"email","title":"Test"}`, `"foo"`, nil},
+	}
+
+	for i, l := range tbl {
+		s, err := Compile([]byte(l.Schema))
+		if err != nil {
+			t.Fatalf("expected no error compiling schema %s, but got:\n%s\nin test #%d", l.Schema, err, i+1)
+		}
+		errs, err := s.ValidateJSON([]byte(l.Value))
+		if err != nil {
+			t.Fatalf("expected no error validating %s, but got:\n%s\nin test #%d", l.Value, err, i+1)
+		}
+		got := make([]string, len(errs))
+		for j, e := range errs {
+			got[j] = e.Error()
+		}
+		if strings.Join(got, "\n") != strings.Join(l.Expected, "\n") {
+			t.Fatalf("expected validating %s against %s to give errors:\n%s\nbut got:\n%s\nin test #%d", l.Value, l.Schema, strings.Join(l.Expected, "\n"), strings.Join(got, "\n"), i+1)
+		}
+		if (errs == nil) != (l.Expected == nil) {
+			t.Fatalf("expected nil errors to be %v, but got %v in test #%d", l.Expected == nil, errs == nil, i+1)
+		}
+	}
+}
+
+// Test compiling invalid schemas
+func TestCompileInvalidSchema(t *testing.T) {
+	tbl := []struct {
+		Schema   string
+		Expected string
+	}{
+		{`1`, "schema at # must be an object or a boolean"},
+		{`{"properties":{"a":"string"}}`, "schema at #/properties/a must be an object or a boolean"},
+		{`{"items":[{},1]}`, "schema at #/items/1 must be an object or a boolean"},
+		{`{"type":1}`, "type at # must be a string or an array of strings"},
+		{`{"type":["string",1]}`, "type at # must be a string or an array of strings"},
+		{`{"type":"int"}`, `unknown type "int" at #`},
+		{`{"enum":"a"}`, "enum at # must be an array"},
+		{`{"properties":[]}`, "properties at # must be an object"},
+		{`{"patternProperties":[]}`, "patternProperties at # must be an object"},
+		{`{"patternProperties":{"(":{}}}`, `invalid pattern "(" at #: error parsing regexp: missing closing ): ` + "`(`"},
+		{`{"required":"a"}`, "required at # must be an array of strings"},
+		{`{"required":[1]}`, "required at # must be an array of strings"},
+		{`{"minProperties":-1}`, "minProperties at # must be a non-negative integer"},
+		{`{"maxItems":1.5}`, "maxItems at # must be a non-negative integer"},
+		{`{"minLength":"1"}`, "minLength at # must be a non-negative integer"},
+		{`{"uniqueItems":1}`, "uniqueItems at # must be a boolean"},
+		{`{"pattern":1}`, "pattern at # must be a string"},
+		{`{"pattern":"["}`, `invalid pattern "[" at #: error parsing regexp: missing closing ]: ` + "`[`"},
+		{`{"minimum":"1"}`, "minimum at # must be a number"},
+		{`{"exclusiveMaximum":true}`, "exclusiveMaximum at # must be a number"},
+		{`{"multipleOf":0}`, "multipleOf at # must be greater than 0"},
+		{`{"allOf":[]}`, "allOf at # must be a non-empty array"},
+		{`{"anyOf":{}}`, "anyOf at # must be a non-empty array"},
+		{`{"oneOf":[{"type":"x"}]}`, `unknown type "x" at #/oneOf/0`},
+		{`{"not":null}`, "schema at #/not must be an object or a boolean"},
+		{`{"$ref":1}`, "$ref at # must be a string"},
+		{`{"$ref":"other.json#/a"}`, `unsupported $ref "other.json#/a": must be a JSON pointer fragment within the schema`},
+		{`{"$ref":"#/definitions/missing"}`, `unresolvable $ref "#/definitions/missing"`},
+		{`{"$ref":"#/%zz"}`, `invalid $ref "#/%zz": invalid URL escape "%zz"`},
+		{`{"definitions":{"a":{"type":"x"}},"$ref":"#/definitions/a"}`, `unknown type "x" at #/definitions/a`},
+	}
+
+	for i, l := range tbl {
+		_, err := Compile([]byte(l.Schema))
+		if err == nil {
+			t.Fatalf("expected an error compiling schema %s, but got none in test #%d", l.Schema, i+1)
+		}
+		if err.Error() != l.Expected {
+			t.Fatalf("expected error compiling schema %s to be:\n%s\nbut got:\n%s\nin test #%d", l.Schema, l.Expected, err, i+1)
+		}
+	}
+}
+
+// Test validating invalid JSON
+func TestValidateJSONInvalid(t *testing.T) {
+	s := MustCompile([]byte(`{}`))
+	if _, err := s.ValidateJSON([]byte(`{"a":`)); err == nil {
+		t.Fatal("expected an error validating invalid JSON, but got none")
+	}
+}
+
+// Test that MustCompile panics on an invalid schema
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if v := recover(); v == nil {
+			t.Fatal("expected MustCompile to panic, but it did not")
+		}
+	}()
+	MustCompile([]byte(`{"type":"int"}`))
+}
+
+// Test the error message of a list of errors
+func TestErrorsError(t *testing.T) {
+	errs := Errors{
+		{Path: "", Message: "first"},
+		{Path: "/a/0", Message: "second"},
+	}
+	if got, exp := errs.Error(), "first; /a/0: second"; got != exp {
+		t.Fatalf("expected error message to be:\n%s\nbut got:\n%s", exp, got)
+	}
+}
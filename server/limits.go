@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+var (
+	errParamsTooLarge = &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Params too large"}
+	errBodyTooLarge   = &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Request body too large"}
+)
+
+// setReadLimit sets the maximum size of messages read from the websocket
+// connection. A message exceeding the limit closes the connection with close
+// code 1009 (message too big).
+func (s *Service) setReadLimit(ws *websocket.Conn) {
+	if s.cfg.WSMaxMessageSize > 0 {
+		ws.SetReadLimit(int64(s.cfg.WSMaxMessageSize))
+	}
+}
+
+// handleReadLimitError closes the websocket connection, and counts err, if
+// caused by a message exceeding the read limit. The close message has already
+// been sent by the websocket package.
+func (s *Service) handleReadLimitError(ws *websocket.Conn, err error) {
+	if err != websocket.ErrReadLimit {
+		return
+	}
+	ws.Close()
+	if s.metrics != nil {
+		s.metrics.OversizedWSMessages.Add(1)
+	}
+}
+
+// limitBody limits the size of the request body that may be read.
+func (s *Service) limitBody(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.HTTPMaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.HTTPMaxBodySize))
+	}
+}
+
+// isBodyTooLargeError reports whether err was caused by reading a request
+// body exceeding the limit, and if so, counts it.
+func (s *Service) isBodyTooLargeError(err error) bool {
+	var mberr *http.MaxBytesError
+	if !errors.As(err, &mberr) {
+		return false
+	}
+	if s.metrics != nil {
+		s.metrics.OversizedHTTPBodies.Add(1)
+	}
+	return true
+}
+
+// checkParamsSize returns a system.invalidRequest error if the encoded call
+// params exceeds the maximum size. Params that are not already JSON encoded
+// are encoded to measure their size.
+func (s *Service) checkParamsSize(params interface{}) error {
+	if s.cfg.MaxCallParamsSize <= 0 || params == nil {
+		return nil
+	}
+	raw, ok := params.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(params); err != nil {
+			return nil
+		}
+	}
+	if len(raw) <= s.cfg.MaxCallParamsSize {
+		return nil
+	}
+	if s.metrics != nil {
+		s.metrics.OversizedCallParams.Add(1)
+	}
+	return errParamsTooLarge
+}
@@ -13,6 +13,9 @@ type MetricSet struct {
 	// WebSocket connectionws
 	WSConnections     openmetrics.Gauge
 	WSConnectionCount openmetrics.Counter
+	// WebSocket connections closed by keepalive timeouts
+	WSTimeoutsPong openmetrics.Counter
+	WSTimeoutsIdle openmetrics.Counter
 	// WebSocket requests
 	WSRequestsGet         openmetrics.Counter
 	WSRequestsSubscribe   openmetrics.Counter
@@ -22,10 +25,22 @@ type MetricSet struct {
 	// Cache
 	CacheResources     openmetrics.Gauge
 	CacheSubscriptions openmetrics.Gauge
+	CacheEventGaps     openmetrics.Counter
+	CacheAudits        openmetrics.Counter
+	CacheResets        openmetrics.Counter
+	CacheResetsPending openmetrics.Gauge
+	// CacheAuditDivergences is labeled by service name.
+	CacheAuditDivergences openmetrics.CounterFamily
+	// CacheSchemaViolations is labeled by service name.
+	CacheSchemaViolations openmetrics.CounterFamily
 	// HTTP requests
 	HTTPRequests     openmetrics.CounterFamily
 	HTTPRequestsGet  openmetrics.Counter
 	HTTPRequestsPost openmetrics.Counter
+	// Rejected requests exceeding a size limit
+	OversizedWSMessages openmetrics.Counter
+	OversizedHTTPBodies openmetrics.Counter
+	OversizedCallParams openmetrics.Counter
 }
 
 // Scrape updates the metric set with info on current mem usage.
@@ -67,6 +82,14 @@ func (m *MetricSet) Register(reg *openmetrics.Registry, version string, protocol
 		Help: "Total established WebSocket connections.",
 	}).With()
 
+	wsTimeouts := reg.Counter(openmetrics.Desc{
+		Name:   "resgate_ws_timeouts",
+		Help:   "Total WebSocket connections closed on timeout.",
+		Labels: []string{"reason"},
+	})
+	m.WSTimeoutsPong = wsTimeouts.With("pong")
+	m.WSTimeoutsIdle = wsTimeouts.With("idle")
+
 	// WebSocket requests
 	wsRequests := reg.Counter(openmetrics.Desc{
 		Name:   "resgate_ws_requests",
@@ -88,6 +111,16 @@ func (m *MetricSet) Register(reg *openmetrics.Registry, version string, protocol
 	m.HTTPRequestsGet = m.HTTPRequests.With("GET")
 	m.HTTPRequestsPost = m.HTTPRequests.With("POST")
 
+	// Oversized requests
+	oversized := reg.Counter(openmetrics.Desc{
+		Name:   "resgate_oversized_requests",
+		Help:   "Total client requests rejected for exceeding a size limit.",
+		Labels: []string{"limit"},
+	})
+	m.OversizedWSMessages = oversized.With("ws_message")
+	m.OversizedHTTPBodies = oversized.With("http_body")
+	m.OversizedCallParams = oversized.With("call_params")
+
 	// Cache
 	m.CacheResources = reg.Gauge(openmetrics.Desc{
 		Name: "resgate_cache_resources",
@@ -99,4 +132,31 @@ func (m *MetricSet) Register(reg *openmetrics.Registry, version string, protocol
 		Help: "Current number of subscriptions on cached resources.",
 	}).With()
 	m.CacheSubscriptions.Set(0)
+	m.CacheEventGaps = reg.Counter(openmetrics.Desc{
+		Name: "resgate_cache_event_gaps",
+		Help: "Total detected gaps in resource event sequences.",
+	}).With()
+	m.CacheResets = reg.Counter(openmetrics.Desc{
+		Name: "resgate_cache_resets",
+		Help: "Total completed resets of cached resources.",
+	}).With()
+	m.CacheResetsPending = reg.Gauge(openmetrics.Desc{
+		Name: "resgate_cache_resets_pending",
+		Help: "Current number of cached resource resets awaiting a response.",
+	}).With()
+	m.CacheResetsPending.Set(0)
+	m.CacheAudits = reg.Counter(openmetrics.Desc{
+		Name: "resgate_cache_audits",
+		Help: "Total cache audits of resources against services.",
+	}).With()
+	m.CacheAuditDivergences = reg.Counter(openmetrics.Desc{
+		Name:   "resgate_cache_audit_divergences",
+		Help:   "Total cached resources found diverging from the service.",
+		Labels: []string{"service"},
+	})
+	m.CacheSchemaViolations = reg.Counter(openmetrics.Desc{
+		Name:   "resgate_cache_schema_violations",
+		Help:   "Total resource values from services rejected by schema validation.",
+		Labels: []string{"service"},
+	})
 }
@@ -20,6 +20,9 @@ type Client interface {
 	// callback to be called once on a separate go routine.
 	SendRequest(subject string, payload []byte, cb Response)
 
+	// Publish publishes a message on a subject without expecting a response.
+	Publish(subject string, payload []byte) error
+
 	// Subscribe to all events on a resource namespace.
 	// The namespace has the format "event."+resource
 	Subscribe(namespace string, cb Response) (Unsubscriber, error)
@@ -0,0 +1,35 @@
+package mq
+
+import "strings"
+
+// prefixClient wraps a Client, prefixing all subjects that are sent to, or
+// subscribed on, the messaging system.
+type prefixClient struct {
+	Client
+	prefix string
+}
+
+// WithPrefix returns a Client that prefixes all request, publish and
+// subscription subjects with prefix followed by a dot. The prefix is removed
+// from the subjects passed to subscription callbacks, making the prefix
+// transparent to the caller.
+func WithPrefix(c Client, prefix string) Client {
+	return &prefixClient{Client: c, prefix: prefix + "."}
+}
+
+// SendRequest sends a request on the prefixed subject.
+func (c *prefixClient) SendRequest(subject string, payload []byte, cb Response) {
+	c.Client.SendRequest(c.prefix+subject, payload, cb)
+}
+
+// Publish publishes a message on the prefixed subject.
+func (c *prefixClient) Publish(subject string, payload []byte) error {
+	return c.Client.Publish(c.prefix+subject, payload)
+}
+
+// Subscribe to all events on a prefixed namespace.
+func (c *prefixClient) Subscribe(namespace string, cb Response) (Unsubscriber, error) {
+	return c.Client.Subscribe(c.prefix+namespace, func(subj string, payload []byte, err error) {
+		cb(strings.TrimPrefix(subj, c.prefix), payload, err)
+	})
+}
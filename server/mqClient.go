@@ -3,15 +3,54 @@ package server
 import (
 	"time"
 
+	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/rescache"
 )
 
 func (s *Service) initMQClient() {
+	if s.cfg.SubjectPrefix != "" {
+		s.mq = mq.WithPrefix(s.mq, s.cfg.SubjectPrefix)
+	}
+
+	s.cache = s.newCache(s.mq, s.cfg.CacheSnapshot)
+}
+
+// newCache creates a cache using the messaging client, with the cache
+// settings of the config, and the snapshot file path.
+func (s *Service) newCache(c mq.Client, snapshot string) *rescache.Cache {
 	unsubdelay := UnsubscribeDelay
 	if s.cfg.NoUnsubscribeDelay {
 		unsubdelay = 0
 	}
-	s.cache = rescache.NewCache(s.mq, CacheWorkers, s.cfg.ResetThrottle, unsubdelay, s.logger, s.metrics)
+	cache := rescache.NewCache(c, CacheWorkers, s.cfg.ResetThrottle, unsubdelay, s.logger, s.metrics)
+	cache.SetResetPriority(s.cfg.ResetPriority)
+	cache.SetAudit(time.Duration(s.cfg.CacheAuditInterval)*time.Millisecond, s.cfg.CacheAuditCorrect)
+	snapshotMaxAge := CacheSnapshotMaxAge
+	if s.cfg.CacheSnapshotMaxAge > 0 {
+		snapshotMaxAge = time.Duration(s.cfg.CacheSnapshotMaxAge) * time.Millisecond
+	}
+	cache.SetSnapshot(snapshot, snapshotMaxAge)
+	cache.SetWarmUp(s.cfg.CacheWarmUp)
+
+	rules := make([]rescache.RetentionRule, len(s.cfg.CacheRetention))
+	for i, r := range s.cfg.CacheRetention {
+		rules[i] = rescache.RetentionRule{
+			Pattern: rescache.ParseResourcePattern(r.Pattern),
+			Delay:   time.Duration(r.Delay) * time.Millisecond,
+			Pin:     r.Pin,
+		}
+	}
+	cache.SetRetentionRules(rules)
+
+	schemas := make([]rescache.SchemaRule, len(s.cfg.ResourceSchemas))
+	for i, r := range s.cfg.ResourceSchemas {
+		schemas[i] = rescache.SchemaRule{
+			Pattern: rescache.ParseResourcePattern(r.Pattern),
+			Schema:  s.cfg.resourceSchemas[i],
+		}
+	}
+	cache.SetSchemaRules(schemas)
+	return cache
 }
 
 // startMQClients creates a connection to the messaging system.
@@ -25,6 +64,10 @@ func (s *Service) startMQClient() error {
 		return err
 	}
 
+	if err := s.startTenantCaches(); err != nil {
+		return err
+	}
+
 	s.mq.SetClosedHandler(s.handleClosedMQ)
 	return nil
 }
@@ -47,6 +90,7 @@ func (s *Service) stopMQClient() {
 
 	s.Debugf("Stopping cache workers...")
 	s.cache.Stop()
+	s.stopTenantCaches()
 	s.Debugf("Cache workers stopped")
 }
 
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const openAPIVersion = "3.0.3"
+
+// Error response component names, and the HTTP status codes they describe.
+var openAPIErrorResponses = []struct {
+	Name   string
+	Status string
+	Desc   string
+}{
+	{"BadRequest", "400", "Invalid request or parameters"},
+	{"Unauthorized", "401", "Access denied"},
+	{"Forbidden", "403", "Forbidden"},
+	{"NotFound", "404", "Resource or method not found"},
+	{"MethodNotAllowed", "405", "Method not allowed"},
+	{"InternalError", "500", "Internal error"},
+	{"ServiceUnavailable", "503", "Service unavailable"},
+}
+
+// Error responses of the different operations, by HTTP status code.
+var (
+	openAPIGetErrors  = []string{"401", "403", "404"}
+	openAPICallErrors = []string{"400", "401", "403", "404", "405"}
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas   map[string]json.RawMessage  `json:"schemas"`
+	Responses map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                       `json:"$ref,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// openAPIHandler serves an OpenAPI document describing the HTTP API of the
+// resources set in the openApiResources setting.
+func (s *Service) openAPIHandler(w http.ResponseWriter, r *http.Request, t *tenant) {
+	err := s.setCommonHeaders(w, r)
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		reqHeaders := r.Header["Access-Control-Request-Headers"]
+		if len(reqHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+		}
+		return
+	}
+	if err != nil {
+		httpError(w, err, s.enc)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		httpError(w, reserr.ErrMethodNotAllowed, s.enc)
+		return
+	}
+
+	b, err := s.openAPIDocumentBytes(t)
+	if err != nil {
+		httpError(w, err, s.enc)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method == "GET" {
+		w.Write(b)
+	}
+}
+
+// openAPIDocumentBytes returns the encoded OpenAPI document of the tenant.
+// The document is cached for the duration of OpenAPICacheTTL, and concurrent
+// calls wait for a single build, to not have each client request sent to the
+// services.
+func (s *Service) openAPIDocumentBytes(t *tenant) ([]byte, error) {
+	t.openAPIMu.Lock()
+	for {
+		if t.openAPIDoc != nil && time.Now().Before(t.openAPIExpires) {
+			b := t.openAPIDoc
+			t.openAPIMu.Unlock()
+			return b, nil
+		}
+		if t.openAPIBuild == nil {
+			break
+		}
+		ch := t.openAPIBuild
+		t.openAPIMu.Unlock()
+		<-ch
+		t.openAPIMu.Lock()
+	}
+	ch := make(chan struct{})
+	t.openAPIBuild = ch
+	t.openAPIMu.Unlock()
+
+	b, err := json.Marshal(s.openAPIDocument(t))
+
+	t.openAPIMu.Lock()
+	if err == nil {
+		t.openAPIDoc = b
+		t.openAPIExpires = time.Now().Add(OpenAPICacheTTL)
+	}
+	t.openAPIBuild = nil
+	close(ch)
+	t.openAPIMu.Unlock()
+	return b, err
+}
+
+// openAPIDocument sends a schema request for each resource in the
+// openApiResources setting to the services of the tenant, and returns an
+// OpenAPI document describing them. Resources failing to respond are
+// described without a schema.
+func (s *Service) openAPIDocument(t *tenant) *openAPIDocument {
+	rnames := s.cfg.OpenAPIResources
+	results := make([]*codec.SchemaResult, len(rnames))
+	var wg sync.WaitGroup
+	wg.Add(len(rnames))
+	for i, rname := range rnames {
+		i, rname := i, rname
+		t.cache.Schema(rname, func(result *codec.SchemaResult, err error) {
+			if err != nil {
+				s.Debugf("Schema request for %s failed: %s", rname, err)
+			} else {
+				results[i] = result
+			}
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: "Resgate API", Version: Version},
+		Paths:   make(map[string]map[string]*openAPIOperation, len(rnames)),
+		Components: openAPIComponents{
+			Schemas:   map[string]json.RawMessage{"Error": openAPIErrorSchema(s.enc)},
+			Responses: make(map[string]*openAPIResponse, len(openAPIErrorResponses)),
+		},
+	}
+	for _, er := range openAPIErrorResponses {
+		doc.Components.Responses[er.Name] = &openAPIResponse{
+			Description: er.Desc,
+			Content:     s.openAPIContent(json.RawMessage(`{"$ref":"#/components/schemas/Error"}`)),
+		}
+	}
+	for i, rname := range rnames {
+		s.addOpenAPIResource(doc, t, rname, results[i])
+	}
+	return doc
+}
+
+// addOpenAPIResource adds the paths of a resource to the document. The
+// schema result may be nil.
+func (s *Service) addOpenAPIResource(doc *openAPIDocument, t *tenant, rname string, sr *codec.SchemaResult) {
+	path, params := s.openAPIPath(t, rname)
+	tags := []string{rname[:strings.IndexByte(rname+".", '.')]}
+
+	get := &openAPIOperation{
+		OperationID: "get." + rname,
+		Tags:        tags,
+		Parameters:  params,
+		Responses:   openAPIResponses(openAPIGetErrors),
+	}
+	get.Responses["200"] = &openAPIResponse{Description: "Resource", Content: s.openAPIContent(nil)}
+	if sr != nil {
+		get.Summary = sr.Title
+		get.Description = sr.Description
+		get.Responses["200"].Content = s.openAPIContent(sr.Schema)
+	}
+	doc.Paths[path] = map[string]*openAPIOperation{"get": get}
+	if sr == nil {
+		return
+	}
+
+	for m, sm := range sr.Methods {
+		doc.Paths[path+"/"+url.PathEscape(m)] = map[string]*openAPIOperation{
+			"post": s.openAPICallOperation("call."+rname+"."+m, tags, params, sm),
+		}
+		for _, mm := range []struct {
+			method string
+			call   *string
+		}{
+			{"put", s.cfg.PUTMethod},
+			{"delete", s.cfg.DELETEMethod},
+			{"patch", s.cfg.PATCHMethod},
+		} {
+			if mm.call != nil && *mm.call == m {
+				doc.Paths[path][mm.method] = s.openAPICallOperation(mm.method+"."+rname, tags, params, sm)
+			}
+		}
+	}
+}
+
+func (s *Service) openAPICallOperation(id string, tags []string, params []*openAPIParameter, sm *codec.SchemaMethod) *openAPIOperation {
+	op := &openAPIOperation{
+		OperationID: id,
+		Tags:        tags,
+		Parameters:  params,
+		Responses:   openAPIResponses(openAPICallErrors),
+	}
+	op.Responses["200"] = &openAPIResponse{Description: "Call result", Content: s.openAPIContent(nil)}
+	op.Responses["204"] = &openAPIResponse{Description: "No result"}
+	if sm == nil {
+		return op
+	}
+	op.Description = sm.Description
+	if sm.Params != nil {
+		op.RequestBody = &openAPIRequestBody{
+			Content: map[string]*openAPIMediaType{"application/json": {Schema: sm.Params}},
+		}
+	}
+	op.Responses["200"].Content = s.openAPIContent(sm.Result)
+	return op
+}
+
+// openAPIPath returns the templated path of a resource name under the API
+// path of the tenant, and the path parameters for any $ prefixed parts.
+func (s *Service) openAPIPath(t *tenant, rname string) (string, []*openAPIParameter) {
+	parts := strings.Split(rname, ".")
+	var params []*openAPIParameter
+	for i, p := range parts {
+		if p[0] == '$' {
+			params = append(params, &openAPIParameter{
+				Name:     p[1:],
+				In:       "path",
+				Required: true,
+				Schema:   json.RawMessage(`{"type":"string"}`),
+			})
+			parts[i] = "{" + p[1:] + "}"
+		} else {
+			parts[i] = url.PathEscape(p)
+		}
+	}
+	return t.apiPath + strings.Join(parts, "/"), params
+}
+
+func (s *Service) openAPIContent(schema json.RawMessage) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{s.enc.ContentType(): {Schema: schema}}
+}
+
+func openAPIResponses(statuses []string) map[string]*openAPIResponse {
+	rs := make(map[string]*openAPIResponse, len(statuses)+1)
+	for _, status := range statuses {
+		for _, er := range openAPIErrorResponses {
+			if er.Status == status {
+				rs[status] = &openAPIResponse{Ref: "#/components/responses/" + er.Name}
+			}
+		}
+	}
+	rs["default"] = &openAPIResponse{Ref: "#/components/responses/InternalError"}
+	return rs
+}
+
+// openAPIErrorSchema returns the schema of errors encoded by the API encoder.
+func openAPIErrorSchema(enc APIEncoder) json.RawMessage {
+	switch enc.(type) {
+	case *encoderJSONAPI:
+		return json.RawMessage(`{"type":"object","required":["errors"],"properties":{"errors":{"type":"array","items":{"type":"object","properties":{"status":{"type":"string"},"code":{"type":"string"},"title":{"type":"string"},"meta":{"type":"object"}}}}}}`)
+	case *encoderHAL:
+		return json.RawMessage(`{"type":"object","required":["message","logref"],"properties":{"message":{"type":"string"},"logref":{"type":"string"},"data":{}}}`)
+	}
+	return json.RawMessage(`{"type":"object","required":["code","message"],"properties":{"code":{"type":"string"},"message":{"type":"string"},"data":{}}}`)
+}
+
+// isValidOpenAPIResource returns true if rname is a valid resource name,
+// where any part prefixed with $ is a named path parameter.
+func isValidOpenAPIResource(rname string) bool {
+	if !codec.IsValidRID(rname, false) {
+		return false
+	}
+	for _, p := range strings.Split(rname, ".") {
+		if p == "$" {
+			return false
+		}
+	}
+	return true
+}
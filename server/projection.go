@@ -0,0 +1,84 @@
+package server
+
+import (
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// projection is the set of model properties sent to the client on a
+// projected subscription.
+type projection map[string]bool
+
+var (
+	errFieldsOnCollection = &reserr.Error{Code: reserr.CodeInvalidParams, Message: "Fields are only supported on models"}
+	errFieldsMismatch     = &reserr.Error{Code: reserr.CodeInvalidParams, Message: "Fields do not match existing subscription"}
+)
+
+func newProjection(fields []string) projection {
+	p := make(projection, len(fields))
+	for _, f := range fields {
+		p[f] = true
+	}
+	return p
+}
+
+// matches reports whether the projection matches the requested fields. A nil
+// projection only matches nil fields.
+func (p projection) matches(fields []string) bool {
+	if p == nil || fields == nil {
+		return p == nil && fields == nil
+	}
+	for _, f := range fields {
+		if !p[f] {
+			return false
+		}
+	}
+	return len(p) == len(newProjection(fields))
+}
+
+// model returns a model with only the selected properties.
+func (p projection) model(m *rescache.Model) *rescache.Model {
+	vals := make(map[string]codec.Value, len(p))
+	for k := range p {
+		if v, ok := m.Values[k]; ok {
+			vals[k] = v
+		}
+	}
+	return &rescache.Model{Values: vals}
+}
+
+// changeEvent returns a model change event with only the selected properties,
+// or nil if no selected property was changed.
+func (p projection) changeEvent(ev *rescache.ResourceEvent) *rescache.ResourceEvent {
+	var ch map[string]codec.Value
+	var patches map[string]codec.Value
+	for k, v := range ev.Changed {
+		if !p[k] {
+			continue
+		}
+		if ch == nil {
+			ch = make(map[string]codec.Value, len(ev.Changed))
+		}
+		ch[k] = v
+		if pv, ok := ev.Patches[k]; ok {
+			if patches == nil {
+				patches = make(map[string]codec.Value, len(ev.Patches))
+			}
+			patches[k] = pv
+		}
+	}
+	if ch == nil {
+		return nil
+	}
+
+	return &rescache.ResourceEvent{
+		Event:     ev.Event,
+		Payload:   ev.Payload,
+		Changed:   ch,
+		Patches:   patches,
+		OldValues: ev.OldValues,
+		Version:   ev.Version,
+		Update:    ev.Update,
+	}
+}
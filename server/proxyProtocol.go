@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol header constants, as described in:
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyV2HeaderLen = 16
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyProtoListener is a listener that reads a PROXY protocol header on
+// connections accepted from trusted proxies. The client address in the
+// header is used as the remote address of the connection.
+type proxyProtoListener struct {
+	net.Listener
+	s *Service
+}
+
+// proxyProtoConn is a connection from a trusted proxy. The PROXY protocol
+// header is read on the first call to Read or RemoteAddr, and not by Accept,
+// to avoid blocking the listener on slow connections.
+type proxyProtoConn struct {
+	net.Conn
+	r          *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// Accept waits for and returns the next connection. Connections from
+// addresses that are not trusted proxies are returned as is.
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.s.isTrustedProxy(addrIP(conn.RemoteAddr().String())) {
+		return conn, nil
+	}
+	return &proxyProtoConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// Read reads data following the PROXY protocol header.
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address of the PROXY protocol header. If the
+// header has no client address, the address of the proxy is returned.
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads the PROXY protocol header, version 1 or 2. A connection
+// without a valid header is closed, and fails on read.
+func (c *proxyProtoConn) readHeader() {
+	err := c.Conn.SetReadDeadline(time.Now().Add(ProxyProtocolHeaderTimeout))
+	if err == nil {
+		c.remoteAddr, err = readProxyHeader(c.r)
+	}
+	if err == nil {
+		err = c.Conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil {
+		c.err = err
+		c.Conn.Close()
+	}
+}
+
+// readProxyHeader reads a PROXY protocol header and returns the source
+// address. Returns nil without error if the header contains no source
+// address, such as for health checks sent by the proxy itself.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxyV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == proxyV1Prefix {
+		return readProxyHeaderV1(r)
+	}
+	return readProxyHeaderV2(r)
+}
+
+// readProxyHeaderV1 reads a human-readable version 1 header, such as:
+//
+//	PROXY TCP4 203.0.113.5 10.0.0.1 4711 8080\r\n
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a binary version 2 header.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [proxyV2HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:12], proxyV2Signature) || hdr[12]>>4 != 2 {
+		return nil, errInvalidProxyHeader
+	}
+	data := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	switch hdr[12] & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, errInvalidProxyHeader
+	}
+
+	// Address family and transport protocol. Only TCP over IPv4 and IPv6
+	// carries an address used by resgate.
+	switch hdr[13] {
+	case 0x11: // TCP over IPv4
+		if len(data) < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(data) < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:]))}, nil
+	}
+	return nil, nil
+}
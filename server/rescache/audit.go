@@ -0,0 +1,228 @@
+package rescache
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// SetAudit sets the interval at which a cached resource is sampled and
+// compared with a fresh get response from the service. If correct is true,
+// any divergence found is corrected by applying the difference as events.
+// An interval of zero disables the audit.
+// Must be called before Start is called.
+func (c *Cache) SetAudit(interval time.Duration, correct bool) {
+	c.auditInterval = interval
+	c.auditCorrect = correct
+}
+
+// startAuditor starts the auditor goroutine, if the audit is enabled.
+func (c *Cache) startAuditor() {
+	if c.auditInterval <= 0 {
+		return
+	}
+	c.auditStop = make(chan struct{})
+	c.auditDone = make(chan struct{})
+	go c.auditor(c.auditInterval, c.auditStop, c.auditDone)
+}
+
+// stopAuditor stops the auditor goroutine and waits for it to exit.
+func (c *Cache) stopAuditor() {
+	if c.auditStop == nil {
+		return
+	}
+	close(c.auditStop)
+	<-c.auditDone
+	c.auditStop = nil
+	c.auditDone = nil
+}
+
+func (c *Cache) auditor(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.auditSample()
+		}
+	}
+}
+
+// auditSample picks a random subscribed resource from the cache and audits
+// it. Only a single resource is audited at a time, and a sample is skipped if
+// the previous audit is still in progress.
+func (c *Cache) auditSample() {
+	if !atomic.CompareAndSwapInt32(&c.auditing, 0, 1) {
+		return
+	}
+
+	c.mu.Lock()
+	var eventSub *EventSubscription
+	if c.started {
+		// Map iteration order is random, which makes it a sample.
+		for _, e := range c.eventSubs {
+			// Skip resources only held by the unsubscribe queue.
+			e.mu.Lock()
+			count := e.count
+			e.mu.Unlock()
+			if count > 0 {
+				eventSub = e
+				break
+			}
+		}
+	}
+	if eventSub == nil {
+		c.mu.Unlock()
+		atomic.StoreInt32(&c.auditing, 0)
+		return
+	}
+	// Hold the resource in the cache until the audit is completed.
+	eventSub.addCount()
+	if c.metrics != nil {
+		c.metrics.CacheSubscriptions.Add(1)
+	}
+	c.mu.Unlock()
+
+	eventSub.Enqueue(eventSub.audit)
+}
+
+// audit sends a get request for the base resource and each of the query
+// resources, and compares the responses with the cached values.
+func (e *EventSubscription) audit() {
+	pending := 1
+	done := func() {
+		pending--
+		if pending == 0 {
+			e.removeCount(1)
+			atomic.StoreInt32(&e.cache.auditing, 0)
+		}
+	}
+
+	if e.base != nil && e.base.query == "" && e.base.audit(done) {
+		pending++
+	}
+	for _, rs := range e.queries {
+		if rs.audit(done) {
+			pending++
+		}
+	}
+	done()
+}
+
+// audit sends a get request for the resource, and compares the response with
+// the cached value. The done callback is called from within the event
+// subscription queue once the audit is completed. Returns false if no audit
+// was made, in which case done will not be called.
+func (rs *ResourceSubscription) audit(done func()) bool {
+	if (rs.state != stateModel && rs.state != stateCollection) || rs.resetting {
+		return false
+	}
+
+	version := rs.version
+	subj := "get." + rs.e.ResourceName
+	payload := codec.CreateGetRequest(rs.query)
+	rs.e.cache.mq.SendRequest(subj, payload, func(_ string, data []byte, err error) {
+		rs.e.Enqueue(func() {
+			rs.processAuditResponse(version, data, err)
+			done()
+		})
+	})
+	return true
+}
+
+func (rs *ResourceSubscription) processAuditResponse(version uint, payload []byte, err error) {
+	var result *codec.GetResult
+	if err == nil {
+		result, err = codec.DecodeGetResponse(payload)
+		if err == nil {
+			err = rs.e.validateGetResult(payload, result)
+		}
+	}
+	if err != nil {
+		rs.e.cache.Errorf("Subscription %s: Audit get error - %s", rs.e.ResourceName, err)
+		return
+	}
+
+	// The audit is inconclusive if the resource has been modified, is being
+	// reset, or no longer has any subscribers while awaiting the response. It is
+	// also inconclusive if the sequence numbers tells the response is not
+	// of the same state as the cached resource.
+	if rs.version != version || rs.resetting || len(rs.subs) == 0 || (rs.state != stateModel && rs.state != stateCollection) {
+		return
+	}
+	if result.Seq != 0 && rs.seq != 0 && result.Seq != rs.seq {
+		return
+	}
+
+	c := rs.e.cache
+	if c.metrics != nil {
+		c.metrics.CacheAudits.Add(1)
+	}
+
+	var cached interface{}
+	var equal, mismatch bool
+	switch rs.state {
+	case stateModel:
+		cached = rs.model
+		mismatch = result.Model == nil
+		equal = !mismatch && modelEqual(rs.model.Values, result.Model)
+	case stateCollection:
+		cached = rs.collection
+		mismatch = result.Collection == nil
+		equal = !mismatch && collectionEqual(rs.collection.Values, result.Collection)
+	}
+	if equal {
+		return
+	}
+
+	name := serviceName(rs.e.ResourceName)
+	cachedData, _ := json.Marshal(cached)
+	c.Errorf("Subscription %s: Audit found cache diverging from service %s:\n\tCached: %s\n\tService: %s", rs.e.ResourceName, name, cachedData, payload)
+	if c.metrics != nil {
+		c.metrics.CacheAuditDivergences.With(name).Add(1)
+	}
+
+	// A mismatching resource type cannot be corrected with events.
+	if !c.auditCorrect || mismatch {
+		return
+	}
+
+	rs.seq = result.Seq
+	switch rs.state {
+	case stateModel:
+		rs.processResetModel(result.Model)
+	case stateCollection:
+		rs.processResetCollection(result.Collection)
+	}
+}
+
+func modelEqual(a, b map[string]codec.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || !v.Equal(w) {
+			return false
+		}
+	}
+	return true
+}
+
+func collectionEqual(a, b []codec.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if !v.Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
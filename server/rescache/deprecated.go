@@ -1,9 +1,5 @@
 package rescache
 
-import (
-	"strings"
-)
-
 type featureType int
 
 // deprecated feature types
@@ -14,12 +10,7 @@ const (
 
 // deprecated logs a deprecated error for each unique service name and feature
 func (c *Cache) deprecated(rid string, typ featureType) {
-	// Get service name
-	idx := strings.IndexByte(rid, '.')
-	name := rid
-	if idx >= 0 {
-		name = rid[:idx]
-	}
+	name := serviceName(rid)
 
 	c.depMutex.Lock()
 	defer c.depMutex.Unlock()
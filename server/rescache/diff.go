@@ -0,0 +1,143 @@
+package rescache
+
+import "github.com/resgateio/resgate/server/codec"
+
+// maxDiffDistance is the edit distance limit for diffCollection. If the
+// number of added and removed values exceeds the limit, the differing
+// sequences are replaced as a whole instead of searching for a shorter
+// edit script.
+const maxDiffDistance = 1000
+
+// diffCollection returns a sequence of remove and add events that transforms
+// collection a into collection b.
+//
+// It uses the Myers diff algorithm, which runs in O((N+M)D) time, where D is
+// the number of added and removed values. The remove events are ordered by
+// descending index, followed by the add events ordered by ascending index.
+//
+// http://www.xmailserver.org/diff2.pdf
+func diffCollection(a, b []codec.Value) []*ResourceEvent {
+	s := 0
+	m := len(a)
+	n := len(b)
+
+	// Trim of matches at the start and end
+	for s < m && s < n && a[s].Equal(b[s]) {
+		s++
+	}
+	if s == m && s == n {
+		return nil
+	}
+	for s < m && s < n && a[m-1].Equal(b[n-1]) {
+		m--
+		n--
+	}
+	aa := a[s:m]
+	bb := b[s:n]
+	m -= s
+	n -= s
+
+	max := m + n
+	if max > maxDiffDistance {
+		max = maxDiffDistance
+	}
+	// v[offset+k] holds the furthest reaching x on diagonal k.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the diagonals -d to d of v, as they were before step d.
+	var trace [][]int
+
+	d := 0
+Loop:
+	for ; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < m && y < n && aa[x].Equal(bb[y]) {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= m && y >= n {
+				break Loop
+			}
+		}
+	}
+
+	// Edit distance limit exceeded. Replace all values.
+	if d > max {
+		return replaceEvents(aa, bb, s)
+	}
+
+	// Backtrack to find the removed and added values.
+	steps := make([]*ResourceEvent, 0, d)
+	adds := make([]int, 0, d)
+	x, y := m, n
+	for ; d > 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var pk int
+		if k == -d || (k != d && vd[k-1+d] < vd[k+1+d]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := vd[pk+d]
+		py := px - pk
+		// Skip diagonal matches
+		for x > px && y > py {
+			x--
+			y--
+		}
+		if x == px {
+			adds = append(adds, py)
+		} else {
+			steps = append(steps, removeEvent(s+px))
+		}
+		x, y = px, py
+	}
+
+	// Adds are backtracked in descending order
+	for i := len(adds) - 1; i >= 0; i-- {
+		steps = append(steps, addEvent(bb[adds[i]], s+adds[i]))
+	}
+	return steps
+}
+
+// replaceEvents returns events removing all values in a, and adding all
+// values in b, starting at index s.
+func replaceEvents(a, b []codec.Value, s int) []*ResourceEvent {
+	steps := make([]*ResourceEvent, 0, len(a)+len(b))
+	for i := len(a) - 1; i >= 0; i-- {
+		steps = append(steps, removeEvent(s+i))
+	}
+	for i, v := range b {
+		steps = append(steps, addEvent(v, s+i))
+	}
+	return steps
+}
+
+func removeEvent(idx int) *ResourceEvent {
+	return &ResourceEvent{
+		Event: "remove",
+		Payload: codec.EncodeRemoveEvent(&codec.RemoveEvent{
+			Idx: idx,
+		}),
+	}
+}
+
+func addEvent(v codec.Value, idx int) *ResourceEvent {
+	return &ResourceEvent{
+		Event: "add",
+		Payload: codec.EncodeAddEvent(&codec.AddEvent{
+			Value: v,
+			Idx:   idx,
+		}),
+	}
+}
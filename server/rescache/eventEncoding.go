@@ -0,0 +1,58 @@
+package rescache
+
+import "sync"
+
+// EventVariant identifies a client encoding of a resource event. Subscribers
+// with the same variant receive identical encodings of the same event.
+type EventVariant struct {
+	// RID is the resource ID as subscribed to by the client.
+	RID string
+	// ProtocolVersion is the client's RES protocol version.
+	ProtocolVersion int
+}
+
+// eventEncodings holds the client encodings of a resource event, shared by
+// all subscribers of the resource.
+type eventEncodings struct {
+	mu sync.Mutex
+	m  map[EventVariant]*eventEncoding
+}
+
+type eventEncoding struct {
+	once sync.Once
+	data []byte
+}
+
+// Encode returns the client encoding of the event for the variant. The first
+// call for a variant calls encode, and subsequent calls for the same variant
+// returns the same encoding without calling encode. The returned slice is
+// shared and must not be modified.
+//
+// Events not passed to subscribers by the cache, such as events derived by a
+// single subscriber, are encoded on each call.
+func (r *ResourceEvent) Encode(v EventVariant, encode func() []byte) []byte {
+	if r.encodings == nil {
+		return encode()
+	}
+
+	r.encodings.mu.Lock()
+	enc, ok := r.encodings.m[v]
+	if !ok {
+		enc = &eventEncoding{}
+		r.encodings.m[v] = enc
+	}
+	r.encodings.mu.Unlock()
+
+	enc.once.Do(func() {
+		enc.data = encode()
+	})
+	return enc.data
+}
+
+// shareEncodings makes the event encode once per variant, for all
+// subscribers. Must be called before passing the event to the subscribers.
+func (r *ResourceEvent) shareEncodings() {
+	if r.encodings == nil {
+		r.encodings = &eventEncodings{m: make(map[EventVariant]*eventEncoding, 1)}
+	}
+}
@@ -3,7 +3,9 @@ package rescache
 import (
 	"sync"
 
+	"github.com/jirenius/timerqueue"
 	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/jsonschema"
 	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/reserr"
 )
@@ -23,10 +25,11 @@ type EventSubscription struct {
 	// Immutable
 	ResourceName string
 	cache        *Cache
+	unsubQueue   *timerqueue.Queue
+	schema       *jsonschema.Schema
 
 	// Protected by cache mutex
 	mqSub mq.Unsubscriber
-	count int64
 
 	// Protected by single goroutine
 	base    *ResourceSubscription
@@ -35,6 +38,7 @@ type EventSubscription struct {
 
 	// Mutex protected
 	mu    sync.Mutex
+	count int64
 	queue []func()
 	locks []func()
 }
@@ -82,6 +86,10 @@ func (e *EventSubscription) addSubscriber(sub Subscriber, t *Throttle) {
 		case stateSubscribed:
 			// Progress state
 			rs.state = stateRequested
+			// Serve any stale resource from the snapshot while revalidating
+			if payload := e.cache.takeStale(e.ResourceName, q); payload != nil && rs.loadStale(payload, t) {
+				return
+			}
 			// Create request
 			subj := "get." + e.ResourceName
 			payload := codec.CreateGetRequest(q)
@@ -215,7 +223,7 @@ func (e *EventSubscription) addCount() {
 	defer e.mu.Unlock()
 
 	if e.count == 0 {
-		e.cache.unsubQueue.Remove(e)
+		e.unsubQueue.Remove(e)
 	}
 	e.count++
 }
@@ -225,7 +233,7 @@ func (e *EventSubscription) addCount() {
 func (e *EventSubscription) removeCount(n int64) {
 	e.count -= n
 	if e.count == 0 && n != 0 {
-		e.cache.unsubQueue.Add(e)
+		e.unsubQueue.Add(e)
 	}
 
 	// Metrics
@@ -260,6 +268,13 @@ func (e *EventSubscription) enqueueEvent(subj string, payload []byte) {
 				return
 			}
 
+			switch event {
+			case "change", "add", "remove", "move":
+				if !e.base.validateSequence(event, ev) {
+					return
+				}
+			}
+
 			e.base.handleEvent(&ResourceEvent{Event: event, Payload: ev})
 		}
 	})
@@ -324,6 +339,9 @@ func (e *EventSubscription) handleQueryEvent(subj string, payload []byte) {
 						e.cache.Errorf("Error processing query event for %s?%s: non-model payload on model %s", e.ResourceName, rs.query, data)
 						return
 					}
+					if e.validateValues(subj, data, result.Model) != nil {
+						return
+					}
 					rs.processResetModel(result.Model)
 				// Handle collection response
 				case result.Collection != nil:
@@ -331,6 +349,9 @@ func (e *EventSubscription) handleQueryEvent(subj string, payload []byte) {
 						e.cache.Errorf("Error processing query event for %s?%s: non-model payload on model %s", e.ResourceName, rs.query, data)
 						return
 					}
+					if e.validateValues(subj, data, result.Collection) != nil {
+						return
+					}
 					rs.processResetCollection(result.Collection)
 				}
 			})
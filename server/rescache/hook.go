@@ -0,0 +1,22 @@
+package rescache
+
+// EventHook is called for each change, add, remove, move, and delete event
+// applied to a cached resource, including query resources. Events are passed
+// after sequence validation and schema validation, and include the events
+// derived from resets and audits. The hook does not keep any resource in the
+// cache. It is called by a cache worker with the resource locked, and must
+// not block.
+type EventHook func(rid string, ev *ResourceEvent)
+
+// SetEventHook sets a hook to be called for each event applied to a cached
+// resource.
+// Must be called before Start is called.
+func (c *Cache) SetEventHook(h EventHook) {
+	c.eventHook = h
+}
+
+func (rs *ResourceSubscription) callEventHook(r *ResourceEvent) {
+	if h := rs.e.cache.eventHook; h != nil {
+		h(resourceID(rs.e.ResourceName, rs.query), r)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,9 +22,18 @@ type Cache struct {
 	logger           logger.Logger
 	workers          int
 	resetThrottle    int
+	resetPriority    bool
 	unsubscribeDelay time.Duration
 	conns            map[string]Conn
 	metrics          *metrics.MetricSet
+	auditInterval    time.Duration
+	auditCorrect     bool
+	snapshotPath     string
+	snapshotMaxAge   time.Duration
+	warmUp           []ResourcePattern
+	retention        []RetentionRule
+	schemas          []SchemaRule
+	eventHook        EventHook
 
 	mu         sync.Mutex
 	started    bool
@@ -31,6 +41,19 @@ type Cache struct {
 	inCh       chan *EventSubscription
 	unsubQueue *timerqueue.Queue
 	resetSub   mq.Unsubscriber
+	// Unsubscribe queues for each retention rule. Nil for pinning rules.
+	retentionQueues []*timerqueue.Queue
+	auditStop       chan struct{}
+	auditDone       chan struct{}
+	auditing        int32
+	warmUpMu        sync.Mutex
+	warmUpStop      chan struct{}
+	warmUpWG        sync.WaitGroup
+
+	// Stale resources loaded from snapshot
+	staleMu    sync.Mutex
+	stale      map[string][]byte
+	staleTimer *time.Timer
 
 	// Handlers for testing
 	onUnsubscribe func(rid string)
@@ -58,16 +81,28 @@ type Conn interface {
 
 // ResourceEvent represents an event on a resource
 type ResourceEvent struct {
-	Event     string
-	Payload   json.RawMessage
-	Idx       int
-	Value     codec.Value
-	Changed   map[string]codec.Value
+	Event   string
+	Payload json.RawMessage
+	Idx     int
+	// To is the index the value is moved to by a move event. Idx holds the
+	// index it is moved from.
+	To    int
+	Value codec.Value
+	// Values holds the collection values resulting from an add, remove, or
+	// move event. The slice must not be modified.
+	Values  []codec.Value
+	Changed map[string]codec.Value
+	// Patches holds the patch values of changed data values, keyed by
+	// property name. The resulting values are found in Changed.
+	Patches   map[string]codec.Value
 	OldValues map[string]codec.Value
 	// Version is the targeted internal version of the resource
 	Version uint
 	// Update flags if the event causes a version bump. Set by eg. add/remove/change.
 	Update bool
+
+	// encodings holds the client encodings shared by the subscribers.
+	encodings *eventEncodings
 }
 
 // NewCache creates a new Cache instance
@@ -90,6 +125,13 @@ func (c *Cache) SetLogger(l logger.Logger) {
 	c.logger = l
 }
 
+// SetResetPriority sets if resource get requests sent in response to a system
+// reset should be prioritized by the number of subscribers, when throttled.
+// Must be called before Start is called.
+func (c *Cache) SetResetPriority(priority bool) {
+	c.resetPriority = priority
+}
+
 // SetOnUnsubscribe sets a callback that is called when a resource is removed
 // from the cache and unsubscribed. Used for testing purpose.
 // Must be called before Start is called.
@@ -106,7 +148,9 @@ func (c *Cache) Start() error {
 	inCh := make(chan *EventSubscription, 100)
 	c.eventSubs = make(map[string]*EventSubscription)
 	c.unsubQueue = timerqueue.New(c.mqUnsubscribe, c.unsubscribeDelay)
+	c.startRetentionQueues()
 	c.inCh = inCh
+	c.loadSnapshot()
 
 	for i := 0; i < c.workers; i++ {
 		go c.startWorker(inCh)
@@ -129,6 +173,8 @@ func (c *Cache) Start() error {
 
 	c.resetSub = resetSub
 	c.started = true
+	c.startWarmUp()
+	c.startAuditor()
 	return nil
 }
 
@@ -229,6 +275,18 @@ func (c *Cache) CustomAuth(req codec.AuthRequester, subj, query string, token, p
 	})
 }
 
+// Schema sends a schema request for a resource
+func (c *Cache) Schema(rname string, callback func(result *codec.SchemaResult, err error)) {
+	c.mq.SendRequest("schema."+rname, codec.CreateSchemaRequest(), func(_ string, data []byte, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		callback(codec.DecodeSchemaResponse(data))
+	})
+}
+
 func (c *Cache) sendRequest(rname, subj string, payload []byte, cb func(data []byte, err error)) {
 	eventSub, _ := c.getSubscription(rname, false)
 	c.mq.SendRequest(subj, payload, func(_ string, data []byte, err error) {
@@ -264,18 +322,25 @@ func (c *Cache) getSubscription(name string, subscribe bool) (*EventSubscription
 
 	eventSub, ok := c.eventSubs[name]
 	if !ok {
+		unsubQueue, pinned := c.retentionFor(name)
 		eventSub = &EventSubscription{
 			ResourceName: name,
 			cache:        c,
+			unsubQueue:   unsubQueue,
+			schema:       c.schemaFor(name),
 			count:        1,
 		}
+		// Pinned resources holds an extra count to never be unsubscribed.
+		if pinned {
+			eventSub.count++
+		}
 
 		c.eventSubs[name] = eventSub
 
 		// Metrics
 		if c.metrics != nil {
 			c.metrics.CacheResources.Add(1)
-			c.metrics.CacheSubscriptions.Add(1)
+			c.metrics.CacheSubscriptions.Add(float64(eventSub.count))
 		}
 
 	} else {
@@ -307,8 +372,15 @@ func (c *Cache) Stop() {
 	if !c.started {
 		return
 	}
+	c.stopAuditor()
+	c.stopWarmUp()
+	c.clearStale()
+	c.mu.Lock()
+	c.writeSnapshot()
+	c.mu.Unlock()
 	close(c.inCh)
 	c.unsubQueue.Clear()
+	c.clearRetentionQueues()
 	c.resetSub = nil
 	c.started = false
 }
@@ -386,6 +458,23 @@ func (c *Cache) forEachMatch(p []string, cb func(e *EventSubscription)) {
 	}
 }
 
+// resourceID returns the resource ID of a resource name and query.
+func resourceID(name, query string) string {
+	if query == "" {
+		return name
+	}
+	return name + "?" + query
+}
+
+// serviceName returns the service name part of a resource ID.
+func serviceName(rid string) string {
+	idx := strings.IndexByte(rid, '.')
+	if idx >= 0 {
+		return rid[:idx]
+	}
+	return rid
+}
+
 func (c *Cache) handleSystemTokenReset(payload []byte) {
 	r, err := codec.DecodeSystemTokenReset(payload)
 	if err != nil {
@@ -67,6 +67,12 @@ type ResourceSubscription struct {
 	// version is the internal resource version, starting with 0 and bumped +1
 	// for each modifying event.
 	version uint
+	// seq is the last known service sequence number of the resource, or 0 if
+	// the service does not sequence its events.
+	seq uint64
+	// validated flags that events are derived from an already validated
+	// state, and are not to be validated against the resource schema.
+	validated bool
 	// Three types of values stored
 	model      *Model
 	collection *Collection
@@ -149,13 +155,23 @@ func (rs *ResourceSubscription) handleEvent(r *ResourceEvent) {
 		if rs.resetting || !rs.handleEventRemove(r) {
 			return
 		}
+	case "move":
+		if rs.resetting || !rs.handleEventMove(r) {
+			return
+		}
 	case "delete":
 		if !rs.resetting {
+			rs.callEventHook(r)
 			rs.handleEventDelete(r)
 		}
 		return
 	}
 
+	if r.Update {
+		rs.callEventHook(r)
+	}
+
+	r.shareEncodings()
 	rs.e.mu.Unlock()
 	for sub := range rs.subs {
 		sub.Event(r)
@@ -163,6 +179,42 @@ func (rs *ResourceSubscription) handleEvent(r *ResourceEvent) {
 	rs.e.mu.Lock()
 }
 
+// validateSequence checks the sequence number of a resource event against the
+// last known sequence number of the resource. It returns false if the event
+// should be discarded, either because it is a duplicate, or because a gap is
+// detected, in which case the resource is reset. A sequence number lower than
+// the last known, such as after a service restart, is treated as a gap.
+func (rs *ResourceSubscription) validateSequence(event string, payload json.RawMessage) bool {
+	// Let handleEvent discard any event received while loading or resetting.
+	if rs.state <= stateRequested || rs.resetting {
+		return true
+	}
+
+	seq, err := codec.DecodeEventSequence(payload)
+	if err != nil || seq == 0 {
+		return true
+	}
+
+	switch {
+	case rs.seq == 0 || seq == rs.seq+1:
+		rs.seq = seq
+		return true
+	case seq == rs.seq:
+		// Event is already covered by the cached state.
+		return false
+	}
+
+	rs.e.cache.Logf("Event sequence gap detected on %s.%s: expected %d but got %d. Resetting resource.", rs.e.ResourceName, event, rs.seq+1, seq)
+
+	// Metrics
+	if rs.e.cache.metrics != nil {
+		rs.e.cache.metrics.CacheEventGaps.Add(1)
+	}
+
+	rs.handleResetResource(nil)
+	return false
+}
+
 func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 	if rs.state == stateCollection {
 		rs.e.cache.Errorf("Error processing event %s.%s: change event on collection", rs.e.ResourceName, r.Event)
@@ -192,14 +244,31 @@ func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 	}
 
 	// Update model properties
+	var patches map[string]codec.Value
 	for k, v := range props {
-		if v.Type == codec.ValueTypeDelete {
+		switch v.Type {
+		case codec.ValueTypeDelete:
 			if _, ok := m[k]; ok {
 				delete(m, k)
 			} else {
 				delete(props, k)
 			}
-		} else {
+		case codec.ValueTypePatch:
+			nv, ok, err := m[k].ApplyPatch(v)
+			if err != nil {
+				rs.e.cache.Errorf("Error processing event %s.%s: property %s: %s", rs.e.ResourceName, r.Event, k, err)
+			}
+			if !ok {
+				delete(props, k)
+				continue
+			}
+			m[k] = nv
+			props[k] = nv
+			if patches == nil {
+				patches = make(map[string]codec.Value, len(props))
+			}
+			patches[k] = v
+		default:
 			if m[k].Equal(v) {
 				delete(props, k)
 			} else {
@@ -213,7 +282,12 @@ func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 		return false
 	}
 
+	if !rs.validateEvent(r, m) {
+		return false
+	}
+
 	r.Changed = props
+	r.Patches = patches
 	r.OldValues = rs.model.Values
 	r.Update = true
 	rs.model = &Model{Values: m}
@@ -248,9 +322,13 @@ func (rs *ResourceSubscription) handleEventAdd(r *ResourceEvent) bool {
 	copy(col, old[0:idx])
 	copy(col[idx+1:], old[idx:])
 	col[idx] = params.Value
+	if !rs.validateEvent(r, col) {
+		return false
+	}
 
 	rs.collection = &Collection{Values: col}
 	rs.version++
+	r.Values = col
 	r.Idx = params.Idx
 	r.Value = params.Value
 	r.Update = true
@@ -285,9 +363,73 @@ func (rs *ResourceSubscription) handleEventRemove(r *ResourceEvent) bool {
 	col := make([]codec.Value, l-1)
 	copy(col, old[0:idx])
 	copy(col[idx:], old[idx+1:])
+	if !rs.validateEvent(r, col) {
+		return false
+	}
 	rs.collection = &Collection{Values: col}
 	rs.version++
+	r.Values = col
 	r.Idx = params.Idx
+	// Re-encode the payload, as it is passed on to the clients, to exclude
+	// any service specific properties such as the sequence number.
+	r.Payload = codec.EncodeRemoveEvent(params)
+	r.Update = true
+
+	return true
+}
+
+func (rs *ResourceSubscription) handleEventMove(r *ResourceEvent) bool {
+	if rs.state == stateModel {
+		rs.e.cache.Errorf("Error processing event %s.%s: move event on model", rs.e.ResourceName, r.Event)
+		return false
+	}
+
+	params, err := codec.DecodeMoveEvent(r.Payload)
+	if err != nil {
+		rs.e.cache.Errorf("Error processing event %s.%s: %s", rs.e.ResourceName, r.Event, err)
+		return false
+	}
+
+	from := params.From
+	to := params.To
+	old := rs.collection.Values
+	l := len(old)
+
+	if from < 0 || from >= l {
+		rs.e.cache.Errorf("Error processing event %s.%s: from %d is out of bounds", rs.e.ResourceName, r.Event, from)
+		return false
+	}
+	if to < 0 || to >= l {
+		rs.e.cache.Errorf("Error processing event %s.%s: to %d is out of bounds", rs.e.ResourceName, r.Event, to)
+		return false
+	}
+	if from == to {
+		return false
+	}
+
+	v := old[from]
+	// Copy collection as the old slice might have been
+	// passed to a Subscriber and should be considered immutable
+	col := make([]codec.Value, l)
+	copy(col, old)
+	if from < to {
+		copy(col[from:to], old[from+1:to+1])
+	} else {
+		copy(col[to+1:from+1], old[to:from])
+	}
+	col[to] = v
+	if !rs.validateEvent(r, col) {
+		return false
+	}
+	rs.collection = &Collection{Values: col}
+	rs.version++
+	r.Values = col
+	r.Idx = from
+	r.To = to
+	r.Value = v
+	// Re-encode the payload, as it is passed on to the clients, to exclude
+	// any service specific properties such as the sequence number.
+	r.Payload = codec.EncodeMoveEvent(params)
 	r.Update = true
 
 	return true
@@ -300,6 +442,7 @@ func (rs *ResourceSubscription) handleEventDelete(r *ResourceEvent) {
 	rs.unregister()
 	rs.e.removeCount(c)
 
+	r.shareEncodings()
 	rs.e.mu.Unlock()
 	for sub := range subs {
 		sub.Event(r)
@@ -310,19 +453,24 @@ func (rs *ResourceSubscription) handleEventDelete(r *ResourceEvent) {
 func (rs *ResourceSubscription) enqueueGetResponse(data []byte, err error) {
 	rs.e.Enqueue(func() {
 		rs, sublist := rs.processGetResponse(data, err)
+		rs.loaded(sublist)
+	})
+}
 
-		rs.e.mu.Unlock()
-		defer rs.e.mu.Lock()
-		if rs.state == stateError {
-			for _, sub := range sublist {
-				sub.Loaded(nil, rs.err)
-			}
-		} else {
-			for _, sub := range sublist {
-				sub.Loaded(rs, nil)
-			}
+// loaded calls Loaded on the subscribers with the result of a get response.
+// The EventSubscription mutex is released during the calls.
+func (rs *ResourceSubscription) loaded(sublist []Subscriber) {
+	rs.e.mu.Unlock()
+	defer rs.e.mu.Lock()
+	if rs.state == stateError {
+		for _, sub := range sublist {
+			sub.Loaded(nil, rs.err)
 		}
-	})
+	} else {
+		for _, sub := range sublist {
+			sub.Loaded(rs, nil)
+		}
+	}
 }
 
 // unregister deletes itself and all its links from
@@ -349,8 +497,16 @@ func (rs *ResourceSubscription) processGetResponse(payload []byte, err error) (n
 	// or an error in the service's response
 	if err == nil {
 		result, err = codec.DecodeGetResponse(payload)
+		if err == nil {
+			err = rs.e.validateGetResult(payload, result)
+		}
 	}
+	return rs.processGetResult(result, err)
+}
 
+// processGetResult processes a decoded and validated get result, or the error
+// of a failed get request.
+func (rs *ResourceSubscription) processGetResult(result *codec.GetResult, err error) (nrs *ResourceSubscription, sublist []Subscriber) {
 	// Get request failed
 	if err != nil {
 		// Set state and store the error in case any other
@@ -421,6 +577,7 @@ func (rs *ResourceSubscription) processGetResponse(payload []byte, err error) (n
 
 	// Make sure internal resource version has its 0 value
 	nrs.version = 0
+	nrs.seq = result.Seq
 
 	if result.Model != nil {
 		nrs.model = &Model{Values: result.Model}
@@ -440,28 +597,41 @@ func (rs *ResourceSubscription) handleResetResource(t *Throttle) {
 
 	rs.resetting = true
 
+	c := rs.e.cache
+	if c.metrics != nil {
+		c.metrics.CacheResetsPending.Add(1)
+	}
+
 	// Create request
 	subj := "get." + rs.e.ResourceName
 	payload := codec.CreateGetRequest(rs.query)
-
-	if t != nil {
-		t.Add(func() {
-			rs.e.cache.mq.SendRequest(subj, payload, func(_ string, data []byte, err error) {
-				rs.e.Enqueue(func() {
-					rs.resetting = false
-					rs.processResetGetResponse(data, err)
-				})
-				t.Done()
-			})
-		})
-	} else {
-		rs.e.cache.mq.SendRequest(subj, payload, func(_ string, data []byte, err error) {
+	send := func() {
+		c.mq.SendRequest(subj, payload, func(_ string, data []byte, err error) {
+			// Update metrics before enqueuing, as the queued callback is
+			// not called if the event subscription is unsubscribed.
+			if c.metrics != nil {
+				c.metrics.CacheResetsPending.Add(-1)
+				c.metrics.CacheResets.Add(1)
+			}
 			rs.e.Enqueue(func() {
 				rs.resetting = false
 				rs.processResetGetResponse(data, err)
 			})
+			t.Done()
 		})
 	}
+
+	switch {
+	case t == nil:
+		send()
+	case c.resetPriority:
+		// Prioritize resources with the most subscribers. Each resource,
+		// including each query resource, is prioritized by its own
+		// subscriber count.
+		t.AddPriority(len(rs.subs), send)
+	default:
+		t.Add(send)
+	}
 }
 
 func (rs *ResourceSubscription) handleResetAccess(t *Throttle) {
@@ -479,6 +649,9 @@ func (rs *ResourceSubscription) processResetGetResponse(payload []byte, err erro
 		if err == nil && ((rs.state == stateModel && result.Model == nil) || (rs.state == stateCollection && result.Collection == nil)) {
 			err = errors.New("mismatching resource type")
 		}
+		if err == nil {
+			err = rs.e.validateGetResult(payload, result)
+		}
 	}
 
 	// Get request failed
@@ -494,6 +667,8 @@ func (rs *ResourceSubscription) processResetGetResponse(payload []byte, err erro
 		return
 	}
 
+	rs.seq = result.Seq
+
 	switch rs.state {
 	case stateModel:
 		rs.processResetModel(result.Model)
@@ -528,124 +703,18 @@ func (rs *ResourceSubscription) processResetModel(props map[string]codec.Value)
 		Payload: codec.EncodeChangeEvent(props),
 	}
 
+	rs.validated = true
 	rs.handleEvent(r)
+	rs.validated = false
 }
 
 func (rs *ResourceSubscription) processResetCollection(collection []codec.Value) {
-	events := lcs(rs.collection.Values, collection)
+	events := diffCollection(rs.collection.Values, collection)
 
+	// Intermediate states are not validated, as the resulting state is.
+	rs.validated = true
 	for _, r := range events {
 		rs.handleEvent(r)
 	}
-}
-
-func lcs(a, b []codec.Value) []*ResourceEvent {
-	var i, j int
-	// Do a LCS matric calculation
-	// https://en.wikipedia.org/wiki/Longest_common_subsequence_problem
-	s := 0
-	m := len(a)
-	n := len(b)
-
-	// Trim of matches at the start and end
-	for s < m && s < n && a[s].Equal(b[s]) {
-		s++
-	}
-
-	if s == m && s == n {
-		return nil
-	}
-
-	for s < m && s < n && a[m-1].Equal(b[n-1]) {
-		m--
-		n--
-	}
-
-	var aa, bb []codec.Value
-	if s > 0 || m < len(a) {
-		aa = a[s:m]
-		m = m - s
-	} else {
-		aa = a
-	}
-	if s > 0 || n < len(b) {
-		bb = b[s:n]
-		n = n - s
-	} else {
-		bb = b
-	}
-
-	// Create matrix and initialize it
-	w := m + 1
-	c := make([]int, w*(n+1))
-
-	for i = 0; i < m; i++ {
-		for j = 0; j < n; j++ {
-			if aa[i].Equal(bb[j]) {
-				c[(i+1)+w*(j+1)] = c[i+w*j] + 1
-			} else {
-				v1 := c[(i+1)+w*j]
-				v2 := c[i+w*(j+1)]
-				if v2 > v1 {
-					c[(i+1)+w*(j+1)] = v2
-				} else {
-					c[(i+1)+w*(j+1)] = v1
-				}
-			}
-		}
-	}
-
-	steps := make([]*ResourceEvent, 0, m+n-2*c[w*(n+1)-1])
-
-	idx := m + s
-	i = m
-	j = n
-	r := 0
-
-	var adds [][3]int
-	addCount := n - c[w*(n+1)-1]
-	if addCount > 0 {
-		adds = make([][3]int, 0, addCount)
-	}
-Loop:
-	for {
-		m = i - 1
-		n = j - 1
-		switch {
-		case i > 0 && j > 0 && aa[m].Equal(bb[n]):
-			idx--
-			i--
-			j--
-		case j > 0 && (i == 0 || c[i+w*n] >= c[m+w*j]):
-			adds = append(adds, [3]int{n, idx, r})
-			j--
-		case i > 0 && (j == 0 || c[i+w*n] < c[m+w*j]):
-			idx--
-			steps = append(steps, &ResourceEvent{
-				Event: "remove",
-				Payload: codec.EncodeRemoveEvent(&codec.RemoveEvent{
-					Idx: idx,
-				}),
-			})
-			r++
-			i--
-		default:
-			break Loop
-		}
-	}
-
-	// Do the adds
-	l := len(adds) - 1
-	for i := l; i >= 0; i-- {
-		add := adds[i]
-		steps = append(steps, &ResourceEvent{
-			Event: "add",
-			Payload: codec.EncodeAddEvent(&codec.AddEvent{
-				Value: bb[add[0]],
-				Idx:   add[1] - r + add[2] + l - i,
-			}),
-		})
-	}
-
-	return steps
+	rs.validated = false
 }
@@ -0,0 +1,58 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/jirenius/timerqueue"
+)
+
+// RetentionRule sets how long resources matching the pattern are kept in the
+// cache after the last subscription is removed, overriding the default
+// unsubscribe delay. If Pin is true, matching resources are never removed.
+type RetentionRule struct {
+	Pattern ResourcePattern
+	Delay   time.Duration
+	Pin     bool
+}
+
+// SetRetentionRules sets the retention rules. The first rule matching a
+// resource is applied.
+// Must be called before Start is called.
+func (c *Cache) SetRetentionRules(rules []RetentionRule) {
+	c.retention = rules
+}
+
+// startRetentionQueues creates an unsubscribe queue for each retention rule
+// that is not pinning resources.
+func (c *Cache) startRetentionQueues() {
+	c.retentionQueues = make([]*timerqueue.Queue, len(c.retention))
+	for i, r := range c.retention {
+		if !r.Pin {
+			c.retentionQueues[i] = timerqueue.New(c.mqUnsubscribe, r.Delay)
+		}
+	}
+}
+
+// clearRetentionQueues clears all retention rule unsubscribe queues.
+func (c *Cache) clearRetentionQueues() {
+	for _, q := range c.retentionQueues {
+		if q != nil {
+			q.Clear()
+		}
+	}
+}
+
+// retentionFor returns the unsubscribe queue to use for a resource, and
+// whether the resource should be pinned in the cache.
+func (c *Cache) retentionFor(name string) (*timerqueue.Queue, bool) {
+	pin := c.isPinned(name)
+	for i, r := range c.retention {
+		if r.Pattern.Match(name) {
+			if r.Pin {
+				return c.unsubQueue, true
+			}
+			return c.retentionQueues[i], pin
+		}
+	}
+	return c.unsubQueue, pin
+}
@@ -0,0 +1,90 @@
+package rescache
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/jsonschema"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// SchemaRule sets a JSON Schema that models and collections matching the
+// pattern are validated against. Values are validated as sent by the service,
+// with resource references and data values in RES value notation.
+type SchemaRule struct {
+	Pattern ResourcePattern
+	Schema  *jsonschema.Schema
+}
+
+var errInvalidResourceValue = reserr.InternalError(errors.New("invalid resource value"))
+
+// SetSchemaRules sets the schema rules. The first rule matching a resource is
+// applied.
+// Must be called before Start is called.
+func (c *Cache) SetSchemaRules(rules []SchemaRule) {
+	c.schemas = rules
+}
+
+// schemaFor returns the schema of the first rule matching the resource, or
+// nil if no rule matches.
+func (c *Cache) schemaFor(name string) *jsonschema.Schema {
+	for _, r := range c.schemas {
+		if r.Pattern.Match(name) {
+			return r.Schema
+		}
+	}
+	return nil
+}
+
+// validateGetResult validates the model or collection of a get result
+// against the schema of the resource.
+func (e *EventSubscription) validateGetResult(payload []byte, result *codec.GetResult) error {
+	if result.Model != nil {
+		return e.validateValues("get."+e.ResourceName, payload, result.Model)
+	}
+	return e.validateValues("get."+e.ResourceName, payload, result.Collection)
+}
+
+// validateEvent validates the model's values or collection's values resulting
+// from applying an event. Events derived from an already validated state are
+// not validated.
+func (rs *ResourceSubscription) validateEvent(r *ResourceEvent, values interface{}) bool {
+	if rs.validated {
+		return true
+	}
+	return rs.e.validateValues("event."+rs.e.ResourceName+"."+r.Event, r.Payload, values) == nil
+}
+
+// validateValues validates a model's values or a collection's values against
+// the schema of the resource. If the values are invalid, the subject and
+// payload of the offending message is logged, and a system.internalError is
+// returned.
+//
+// The values are encoded to JSON and decoded again before validation, as the
+// validator operates on plain JSON values. This costs a full encoding of the
+// resource for each validated get response and event, and is only done for
+// resources with a schema.
+func (e *EventSubscription) validateValues(subj string, payload []byte, values interface{}) error {
+	if e.schema == nil {
+		return nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return reserr.InternalError(err)
+	}
+	errs, err := e.schema.ValidateJSON(data)
+	if err != nil {
+		return reserr.InternalError(err)
+	}
+	if errs == nil {
+		return nil
+	}
+
+	name := serviceName(e.ResourceName)
+	e.cache.Errorf("Invalid resource value from service %s on %s: %s\n\tPayload: %s", name, subj, errs, payload)
+	if e.cache.metrics != nil {
+		e.cache.metrics.CacheSchemaViolations.With(name).Add(1)
+	}
+	return errInvalidResourceValue
+}
@@ -0,0 +1,207 @@
+package rescache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// snapshot is the file format of a cache snapshot. Each resource is stored
+// as a get response, keyed by resource ID, with the query appended after a
+// question mark (?) for query resources.
+type snapshot struct {
+	Resources map[string]json.RawMessage `json:"resources"`
+}
+
+// SetSnapshot sets the path of the file where a snapshot of the cached
+// resources is written when the cache is stopped, and loaded from when the
+// cache is started. An empty path disables snapshots.
+//
+// The maxAge is the max age of the snapshot, counted from the modification
+// time of the file. An older snapshot is not loaded, and stale resources not
+// yet served are discarded once the snapshot reaches the max age.
+// Must be called before Start is called.
+func (c *Cache) SetSnapshot(path string, maxAge time.Duration) {
+	c.snapshotPath = path
+	c.snapshotMaxAge = maxAge
+}
+
+// loadSnapshot loads the snapshot file, storing its resources as stale
+// entries to be served to the first subscriber of each resource, until the
+// snapshot reaches its max age.
+// Failing to load the snapshot is logged, but is not considered fatal.
+func (c *Cache) loadSnapshot() {
+	if c.snapshotPath == "" {
+		return
+	}
+	fi, err := os.Stat(c.snapshotPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.Errorf("Error loading cache snapshot: %s", err)
+		}
+		return
+	}
+	ttl := c.snapshotMaxAge - time.Since(fi.ModTime())
+	if ttl <= 0 {
+		c.Logf("Cache snapshot older than %s is not loaded", c.snapshotMaxAge)
+		return
+	}
+	data, err := os.ReadFile(c.snapshotPath)
+	if err != nil {
+		c.Errorf("Error loading cache snapshot: %s", err)
+		return
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		c.Errorf("Error loading cache snapshot: %s", err)
+		return
+	}
+
+	stale := make(map[string][]byte, len(s.Resources))
+	for k, payload := range s.Resources {
+		// Validate the entries to make sure they may be served as they are.
+		if _, err := codec.DecodeGetResponse(payload); err != nil {
+			c.Errorf("Error loading cache snapshot resource %s: %s", k, err)
+			continue
+		}
+		stale[k] = payload
+	}
+
+	c.staleMu.Lock()
+	c.stale = stale
+	c.staleTimer = time.AfterFunc(ttl, c.clearStale)
+	c.staleMu.Unlock()
+	c.Logf("Loaded %d stale resources from cache snapshot", len(stale))
+}
+
+// clearStale discards any stale resources not yet served.
+func (c *Cache) clearStale() {
+	c.staleMu.Lock()
+	defer c.staleMu.Unlock()
+	if c.staleTimer != nil {
+		c.staleTimer.Stop()
+		c.staleTimer = nil
+	}
+	if len(c.stale) > 0 {
+		c.Logf("Discarded %d stale resources from cache snapshot", len(c.stale))
+	}
+	c.stale = nil
+}
+
+// takeStale returns the stale get response payload for a resource loaded from
+// the snapshot, or nil if there is none. The entry is removed, as it should
+// only be served until revalidated.
+func (c *Cache) takeStale(rid, query string) []byte {
+	c.staleMu.Lock()
+	defer c.staleMu.Unlock()
+	if c.stale == nil {
+		return nil
+	}
+	k := resourceID(rid, query)
+	payload, ok := c.stale[k]
+	if !ok {
+		return nil
+	}
+	delete(c.stale, k)
+	return payload
+}
+
+// writeSnapshot writes all cached models and collections to the snapshot
+// file. It is assumed the cache mutex is held.
+func (c *Cache) writeSnapshot() {
+	if c.snapshotPath == "" {
+		return
+	}
+
+	s := snapshot{Resources: make(map[string]json.RawMessage)}
+	for _, eventSub := range c.eventSubs {
+		eventSub.snapshot(s.Resources)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		c.Errorf("Error encoding cache snapshot: %s", err)
+		return
+	}
+
+	// Write to a temporary file first, to not leave a partially written
+	// snapshot if failing.
+	tmp, err := os.CreateTemp(filepath.Dir(c.snapshotPath), filepath.Base(c.snapshotPath)+".*.tmp")
+	if err != nil {
+		c.Errorf("Error writing cache snapshot: %s", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.snapshotPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		c.Errorf("Error writing cache snapshot: %s", err)
+		return
+	}
+	c.Logf("Wrote %d resources to cache snapshot", len(s.Resources))
+}
+
+// snapshot adds the event subscription's loaded models and collections to the
+// map, encoded as get responses.
+func (e *EventSubscription) snapshot(m map[string]json.RawMessage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.base != nil {
+		e.base.snapshot(m, "")
+	}
+	for q, rs := range e.queries {
+		rs.snapshot(m, q)
+	}
+	for q, rs := range e.links {
+		rs.snapshot(m, q)
+	}
+}
+
+// snapshot adds the resource to the map, using the query q for the key.
+func (rs *ResourceSubscription) snapshot(m map[string]json.RawMessage, q string) {
+	var r codec.GetResult
+	switch rs.state {
+	case stateModel:
+		r.Model = rs.model.Values
+	case stateCollection:
+		r.Collection = rs.collection.Values
+	default:
+		return
+	}
+	r.Query = rs.query
+	r.Seq = rs.seq
+	payload, err := json.Marshal(codec.GetResponse{Result: &r})
+	if err != nil {
+		return
+	}
+	m[resourceID(rs.e.ResourceName, q)] = payload
+}
+
+// loadStale loads the resource from a stale get response payload, and
+// revalidates it against the service using a reset, which in turn sends any
+// difference as events.
+// Returns false, without loading, if the values are not valid against the
+// resource schema, in which case a get request should be sent instead.
+func (rs *ResourceSubscription) loadStale(payload []byte, t *Throttle) bool {
+	result, err := codec.DecodeGetResponse(payload)
+	if err == nil {
+		err = rs.e.validateGetResult(payload, result)
+	}
+	if err != nil {
+		return false
+	}
+	nrs, sublist := rs.processGetResult(result, nil)
+	if nrs.state != stateError {
+		nrs.handleResetResource(t)
+	}
+	nrs.loaded(sublist)
+	return true
+}
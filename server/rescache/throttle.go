@@ -1,6 +1,9 @@
 package rescache
 
-import "sync"
+import (
+	"container/heap"
+	"sync"
+)
 
 // Throttle ensures that only a set number of callbacks are running at the same
 // time. Once a callback is complete, it should call Done to let next queued
@@ -11,8 +14,42 @@ import "sync"
 type Throttle struct {
 	limit   int
 	running int
+	seq     uint64
 	mu      sync.Mutex
-	queue   []func()
+	queue   throttleQueue
+}
+
+type throttled struct {
+	cb       func()
+	priority int
+	seq      uint64
+}
+
+// throttleQueue is a priority queue of throttled callbacks, implementing
+// heap.Interface. Callbacks with higher priority are first, and callbacks with
+// the same priority are ordered by sequence number.
+type throttleQueue []throttled
+
+func (q throttleQueue) Len() int { return len(q) }
+
+func (q throttleQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q throttleQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *throttleQueue) Push(x interface{}) { *q = append(*q, x.(throttled)) }
+
+func (q *throttleQueue) Pop() interface{} {
+	old := *q
+	n := len(old) - 1
+	v := old[n]
+	old[n] = throttled{}
+	*q = old[:n]
+	return v
 }
 
 // NewThrottle creates a new throttle.
@@ -23,10 +60,19 @@ func NewThrottle(limit int) *Throttle {
 // Add calls the provided callback or queues it if the limit of concurrently
 // running callbacks is reached.
 func (t *Throttle) Add(cb func()) {
+	t.AddPriority(0, cb)
+}
+
+// AddPriority calls the provided callback or queues it if the limit of
+// concurrently running callbacks is reached. Queued callbacks with a higher
+// priority are called before those with a lower priority. Callbacks with the
+// same priority are called in the order they were added.
+func (t *Throttle) AddPriority(priority int, cb func()) {
 	t.mu.Lock()
 
 	if t.running >= t.limit {
-		t.queue = append(t.queue, cb)
+		t.seq++
+		heap.Push(&t.queue, throttled{cb: cb, priority: priority, seq: t.seq})
 		t.mu.Unlock()
 		return
 	}
@@ -55,8 +101,7 @@ func (t *Throttle) Done() {
 		return
 	}
 
-	cb := t.queue[0]
-	t.queue = t.queue[1:]
+	cb := heap.Pop(&t.queue).(throttled).cb
 	t.mu.Unlock()
 	go cb()
 }
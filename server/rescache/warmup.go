@@ -0,0 +1,129 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// Delays between warm-up attempts of a resource failing to be fetched. The
+// delay is doubled on each failed attempt, up to the max delay.
+const (
+	warmUpRetryMin = 500 * time.Millisecond
+	warmUpRetryMax = time.Minute
+)
+
+// SetWarmUp sets the resource IDs and resource patterns of resources to keep
+// pinned in the cache. Resources matching any of the patterns are never
+// removed from the cache once loaded, regardless of the unsubscribe delay.
+// Resource IDs without wildcards are also fetched when the cache is started.
+// The patterns are assumed to be valid.
+// Must be called before Start is called.
+func (c *Cache) SetWarmUp(patterns []string) {
+	c.warmUp = make([]ResourcePattern, len(patterns))
+	for i, p := range patterns {
+		c.warmUp[i] = ParseResourcePattern(p)
+	}
+}
+
+// isPinned reports whether the resource name matches any warm-up pattern.
+func (c *Cache) isPinned(name string) bool {
+	for _, p := range c.warmUp {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// startWarmUp subscribes to and fetches all warm-up resource IDs without
+// wildcards.
+func (c *Cache) startWarmUp() {
+	c.warmUpMu.Lock()
+	c.warmUpStop = make(chan struct{})
+	c.warmUpMu.Unlock()
+	for _, p := range c.warmUp {
+		if p.hasWild {
+			continue
+		}
+		eventSub, err := c.getSubscription(p.pattern, true)
+		if err != nil {
+			c.Errorf("Cache warm-up of %s failed: %s", p.pattern, err)
+			continue
+		}
+		eventSub.Enqueue(func() { eventSub.warmUp(warmUpRetryMin) })
+	}
+}
+
+// stopWarmUp stops any pending warm-up retries and waits for them to exit.
+func (c *Cache) stopWarmUp() {
+	c.warmUpMu.Lock()
+	if c.warmUpStop == nil {
+		c.warmUpMu.Unlock()
+		return
+	}
+	close(c.warmUpStop)
+	c.warmUpStop = nil
+	c.warmUpMu.Unlock()
+	c.warmUpWG.Wait()
+}
+
+// warmUp loads the base resource, unless it is already requested or loaded.
+// A stale resource from the snapshot is loaded and revalidated. Otherwise a
+// get request is sent, and retried after the retry delay if it fails. The
+// subscription count added by getSubscription is removed once completed.
+func (e *EventSubscription) warmUp(retry time.Duration) {
+	rs := e.getResourceSubscription("")
+	if rs.state != stateSubscribed {
+		e.removeCount(1)
+		return
+	}
+
+	rs.state = stateRequested
+	if payload := e.cache.takeStale(e.ResourceName, ""); payload != nil && rs.loadStale(payload, nil) {
+		e.removeCount(1)
+		return
+	}
+
+	e.cache.mq.SendRequest("get."+e.ResourceName, codec.CreateGetRequest(""), func(_ string, data []byte, err error) {
+		e.Enqueue(func() {
+			nrs, sublist := rs.processGetResponse(data, err)
+			if nrs.state == stateError {
+				e.cache.Errorf("Cache warm-up of %s failed, retrying in %s: %s", e.ResourceName, retry, nrs.err)
+				e.retryWarmUp(retry)
+			} else {
+				e.removeCount(1)
+			}
+			nrs.loaded(sublist)
+		})
+	})
+}
+
+// retryWarmUp calls warmUp after the delay, with the delay doubled, unless
+// the cache is stopped.
+func (e *EventSubscription) retryWarmUp(delay time.Duration) {
+	c := e.cache
+	c.warmUpMu.Lock()
+	stop := c.warmUpStop
+	if stop == nil {
+		c.warmUpMu.Unlock()
+		return
+	}
+	c.warmUpWG.Add(1)
+	c.warmUpMu.Unlock()
+
+	go func() {
+		defer c.warmUpWG.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-stop:
+		case <-timer.C:
+			next := delay * 2
+			if next > warmUpRetryMax {
+				next = warmUpRetryMax
+			}
+			e.Enqueue(func() { e.warmUp(next) })
+		}
+	}()
+}
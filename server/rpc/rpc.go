@@ -14,7 +14,7 @@ import (
 type Requester interface {
 	Reply(data []byte)
 	GetResource(rid string, callback func(data *Resources, err error))
-	SubscribeResource(rid string, callback func(data *Resources, err error))
+	SubscribeResource(rid string, window *Window, fields []string, callback func(data *Resources, err error))
 	UnsubscribeResource(rid string, count int, callback func(ok bool))
 	CallResource(rid, action string, params interface{}, callback func(result interface{}, err error))
 	AuthResource(rid, action string, params interface{}, callback func(result interface{}, err error))
@@ -99,6 +99,20 @@ type CallResourceResult struct {
 	*Resources
 }
 
+// SubscribeRequest represents the params of a subscribe request
+type SubscribeRequest struct {
+	Offset *int     `json:"offset"`
+	Limit  *int     `json:"limit"`
+	Fields []string `json:"fields"`
+}
+
+// Window represents the range of a collection sent to the client on a
+// windowed subscription.
+type Window struct {
+	Offset int
+	Limit  int
+}
+
 // UnsubscribeRequest represents the params of an unsubscribe request
 type UnsubscribeRequest struct {
 	Count *int `json:"count"`
@@ -178,7 +192,39 @@ func HandleRequest(data []byte, req Requester) error {
 			}
 		})
 	case "subscribe":
-		req.SubscribeResource(rid, func(data *Resources, err error) {
+		var window *Window
+		var fields []string
+		if len(r.Params) > 0 && !bytes.Equal(r.Params, nullBytes) {
+			var sr SubscribeRequest
+			err := json.Unmarshal(r.Params, &sr)
+			if err != nil {
+				req.Reply(r.ErrorResponse(reserr.ErrInvalidParams))
+				return nil
+			}
+			if sr.Limit != nil {
+				window = &Window{Limit: *sr.Limit}
+				if sr.Offset != nil {
+					window.Offset = *sr.Offset
+				}
+				if window.Limit <= 0 || window.Offset < 0 {
+					req.Reply(r.ErrorResponse(reserr.ErrInvalidParams))
+					return nil
+				}
+			} else if sr.Offset != nil {
+				req.Reply(r.ErrorResponse(reserr.ErrInvalidParams))
+				return nil
+			}
+			if sr.Fields != nil {
+				// A window is only valid for collections, and fields only
+				// for models.
+				if len(sr.Fields) == 0 || window != nil {
+					req.Reply(r.ErrorResponse(reserr.ErrInvalidParams))
+					return nil
+				}
+				fields = sr.Fields
+			}
+		}
+		req.SubscribeResource(rid, window, fields, func(data *Resources, err error) {
 			if err != nil {
 				req.Reply(r.ErrorResponse(err))
 			} else {
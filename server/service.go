@@ -12,6 +12,7 @@ import (
 	"github.com/resgateio/resgate/server/metrics"
 	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/webhook"
 )
 
 // Service is a RES gateway implementation
@@ -25,6 +26,13 @@ type Service struct {
 	mq    mq.Client
 	cache *rescache.Cache
 
+	// tenants
+	tenant  *tenant   // Default tenant, using mq and cache
+	tenants []*tenant // Tenants of the tenants setting
+
+	// webhooks
+	webhooks []*webhook.Webhook
+
 	// httpServer
 	h        *http.Server
 	enc      APIEncoder
@@ -57,10 +65,13 @@ func NewService(mq mq.Client, cfg Config) (*Service, error) {
 	s.initMetricsServer()
 	s.initHTTPServer()
 	s.initWSHandler()
+	base := s.mq
 	s.initMQClient()
+	s.initWebhooks()
 	if err := s.initAPIHandler(); err != nil {
 		return nil, err
 	}
+	s.initTenants(base)
 	return s, nil
 }
 
@@ -75,6 +86,9 @@ func (s *Service) SetLogger(l logger.Logger) *Service {
 
 	s.logger = l
 	s.cache.SetLogger(l)
+	for _, t := range s.tenants {
+		t.cache.SetLogger(l)
+	}
 	return s
 }
 
@@ -88,6 +102,9 @@ func (s *Service) SetOnWSClose(cb func(ws *websocket.Conn)) {
 // from the cache and unsubscribed. Used for testing.
 func (s *Service) SetOnUnsubscribe(cb func(rid string)) {
 	s.cache.SetOnUnsubscribe(cb)
+	for _, t := range s.tenants {
+		t.cache.SetOnUnsubscribe(cb)
+	}
 }
 
 // Logf writes a formatted log message
@@ -139,13 +156,17 @@ func (s *Service) start() error {
 	s.Debugf("Go runtime version %s", runtime.Version())
 	s.stop = make(chan error, 1)
 
+	s.startWebhooks()
+
 	if err := s.startMQClient(); err != nil {
 		return err
 	}
 
 	s.startMetricsServer()
 
-	s.startHTTPServer()
+	if err := s.startHTTPServer(); err != nil {
+		return err
+	}
 	s.Logf("Server ready")
 
 	return nil
@@ -170,6 +191,7 @@ func (s *Service) Stop(err error) {
 	s.stopWSHandler()
 	s.stopHTTPServer()
 	s.stopMQClient()
+	s.stopWebhooks()
 
 	s.mu.Lock()
 	s.stop <- err
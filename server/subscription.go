@@ -54,6 +54,8 @@ type Subscription struct {
 	accessCallbacks []func(*rescache.Access)
 	flags           uint8
 	throttle        *rescache.Throttle
+	window          *window
+	fields          projection
 
 	// Protected by conn
 	direct       int // Number of direct subscriptions
@@ -90,6 +92,7 @@ const (
 const (
 	flagAccessCalled uint8 = 1 << iota
 	flagReaccess
+	flagTrackValues
 )
 
 var (
@@ -174,6 +177,25 @@ func (s *Subscription) CollectionValues() []codec.Value {
 	return s.collection.Values
 }
 
+// SetWindow sets the range of the collection to send to the client.
+// Must be called before the subscription is loaded.
+func (s *Subscription) SetWindow(w *rpc.Window) {
+	s.window = &window{offset: w.Offset, limit: w.Limit}
+}
+
+// TrackValues keeps the model or collection values in sync with the processed
+// events, instead of only holding the values as loaded.
+// Must be called before the subscription is loaded.
+func (s *Subscription) TrackValues() {
+	s.flags |= flagTrackValues
+}
+
+// SetFields sets the model properties to send to the client.
+// Must be called before the subscription is loaded.
+func (s *Subscription) SetFields(fields []string) {
+	s.fields = newProjection(fields)
+}
+
 // Ref returns the referenced subscription, or nil if subscription has no such reference.
 func (s *Subscription) Ref(rid string) *Subscription {
 	r := s.refs[rid]
@@ -226,8 +248,16 @@ func (s *Subscription) Loaded(resourceSub *rescache.ResourceSubscription, err er
 func (s *Subscription) setResource() {
 	switch s.typ {
 	case rescache.TypeCollection:
+		if s.fields != nil {
+			s.err = errFieldsOnCollection
+			return
+		}
 		s.setCollection()
 	case rescache.TypeModel:
+		if s.window != nil {
+			s.err = errWindowOnModel
+			return
+		}
 		s.setModel()
 	default:
 		err := fmt.Errorf("subscription %s: unknown resource type", s.rid)
@@ -303,7 +333,16 @@ func (s *Subscription) unqueueEvents(reason uint8) {
 		return
 	}
 
-	// Start with reaccess calls
+	// Start with any pending window events
+	if s.window != nil && len(s.window.pending) > 0 {
+		evs := s.window.pending
+		s.window.pending = nil
+		if !s.processWindowEvents(evs) {
+			return
+		}
+	}
+
+	// Continue with reaccess calls
 	if s.flags&flagReaccess != 0 {
 		s.handleReaccess(nil)
 		if s.queueFlag != 0 {
@@ -420,6 +459,10 @@ func (s *Subscription) populateResourcesLegacy(r *rpc.Resources, indirect bool)
 func (s *Subscription) setModel() {
 	s.queueEvents(queueReasonLoading)
 	m, version := s.resourceSub.GetModel()
+	// Only subscribe to references of selected properties
+	if s.fields != nil {
+		m = s.fields.model(m)
+	}
 	for _, v := range m.Values {
 		if !s.subscribeRef(v) {
 			return
@@ -433,6 +476,11 @@ func (s *Subscription) setModel() {
 func (s *Subscription) setCollection() {
 	s.queueEvents(queueReasonLoading)
 	c, version := s.resourceSub.GetCollection()
+	// Only subscribe to references within the window
+	if s.window != nil {
+		s.window.values = c.Values
+		c = &rescache.Collection{Values: s.window.slice()}
+	}
 	for _, v := range c.Values {
 		if !s.subscribeRef(v) {
 			return
@@ -442,6 +490,64 @@ func (s *Subscription) setCollection() {
 	s.version = version
 }
 
+// updateModel applies changed values to the model if the values are tracked.
+// The model is replaced rather than modified, as it may be shared with the
+// cache.
+func (s *Subscription) updateModel(changed map[string]codec.Value) {
+	if s.model == nil || s.flags&flagTrackValues == 0 {
+		return
+	}
+	m := make(map[string]codec.Value, len(s.model.Values)+len(changed))
+	for k, v := range s.model.Values {
+		m[k] = v
+	}
+	for k, v := range changed {
+		if v.Type == codec.ValueTypeDelete {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+	}
+	s.model = &rescache.Model{Values: m}
+}
+
+// updateCollection applies an add, remove, or move event to the collection
+// if the values are tracked. The collection is replaced rather than modified,
+// as it may be shared with the cache.
+func (s *Subscription) updateCollection(event *rescache.ResourceEvent) {
+	if s.collection == nil || s.flags&flagTrackValues == 0 {
+		return
+	}
+	old := s.collection.Values
+	vals := make([]codec.Value, 0, len(old)+1)
+	switch event.Event {
+	case "add":
+		if event.Idx < 0 || event.Idx > len(old) {
+			return
+		}
+		vals = append(vals, old[:event.Idx]...)
+		vals = append(vals, event.Value)
+		vals = append(vals, old[event.Idx:]...)
+	case "remove":
+		if event.Idx < 0 || event.Idx >= len(old) {
+			return
+		}
+		vals = append(vals, old[:event.Idx]...)
+		vals = append(vals, old[event.Idx+1:]...)
+	case "move":
+		if event.Idx < 0 || event.Idx >= len(old) || event.To < 0 || event.To >= len(old) {
+			return
+		}
+		v := old[event.Idx]
+		vals = append(vals, old[:event.Idx]...)
+		vals = append(vals, old[event.Idx+1:]...)
+		vals = append(vals[:event.To], append([]codec.Value{v}, vals[event.To:]...)...)
+	default:
+		return
+	}
+	s.collection = &rescache.Collection{Values: vals}
+}
+
 // subscribeRef subscribes to any resource reference value
 // and adds it to s.refs.
 // If an error is encountered, all subscriptions in s.refs will
@@ -581,7 +687,11 @@ func (s *Subscription) processEvent(event *rescache.ResourceEvent) {
 
 	switch s.resourceSub.GetResourceType() {
 	case rescache.TypeCollection:
-		s.processCollectionEvent(event)
+		if s.window != nil {
+			s.processWindowEvent(event)
+		} else {
+			s.processCollectionEvent(event)
+		}
 	case rescache.TypeModel:
 		s.processModelEvent(event)
 	default:
@@ -589,9 +699,35 @@ func (s *Subscription) processEvent(event *rescache.ResourceEvent) {
 	}
 }
 
+// processWindowEvent translates collection add, remove, and move events into
+// events relative to the subscription's window.
+func (s *Subscription) processWindowEvent(event *rescache.ResourceEvent) {
+	switch event.Event {
+	case "add", "remove", "move":
+		s.processWindowEvents(s.window.translate(event))
+	default:
+		s.processCollectionEvent(event)
+	}
+}
+
+// processWindowEvents processes translated window events. If an event causes
+// the subscription to queue events, the remaining events are kept as pending
+// and false is returned.
+func (s *Subscription) processWindowEvents(evs []*rescache.ResourceEvent) bool {
+	for i, ev := range evs {
+		s.processCollectionEvent(ev)
+		if s.queueFlag != 0 {
+			s.window.pending = evs[i+1:]
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 	switch event.Event {
 	case "add":
+		s.updateCollection(event)
 		v := event.Value
 		idx := event.Idx
 
@@ -611,7 +747,7 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 				// when calling sub.GetRPCResources, since we have no new
 				// resources to populate.
 				sub.indirectsent++
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage}))
+				s.sendEvent(event, func() interface{} { return rpc.AddEvent{Idx: idx, Value: v.RawMessage} })
 				return
 			}
 
@@ -635,35 +771,65 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 			fallthrough
 		case codec.ValueTypeSoftReference:
 			if s.c.ProtocolVersion() < versionSoftResourceReferenceAndDataValue {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: rescache.Legacy120Value(v)}))
+				s.sendEvent(event, func() interface{} { return rpc.AddEvent{Idx: idx, Value: rescache.Legacy120Value(v)} })
 				break
 			}
 			fallthrough
 		case codec.ValueTypePrimitive:
-			s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage}))
+			s.sendEvent(event, func() interface{} { return rpc.AddEvent{Idx: idx, Value: v.RawMessage} })
 		}
 
 	case "remove":
+		s.updateCollection(event)
 		// Remove and unsubscribe to model
 		v := event.Value
 
 		if v.Type == codec.ValueTypeReference {
 			s.removeReference(v.RID)
 		}
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.sendEvent(event, func() interface{} { return event.Payload })
+
+	case "move":
+		// Translate into a remove and an add event for clients not
+		// supporting move events.
+		if s.c.ProtocolVersion() < versionCollectionMove {
+			s.processCollectionEvent(&rescache.ResourceEvent{
+				Event:   "remove",
+				Payload: codec.EncodeRemoveEvent(&codec.RemoveEvent{Idx: event.Idx}),
+				Idx:     event.Idx,
+				Value:   event.Value,
+			})
+			s.processCollectionEvent(&rescache.ResourceEvent{
+				Event:   "add",
+				Payload: codec.EncodeAddEvent(&codec.AddEvent{Idx: event.To, Value: event.Value}),
+				Idx:     event.To,
+				Value:   event.Value,
+			})
+			break
+		}
+		s.updateCollection(event)
+		// The moved value remains in the collection, so any reference is
+		// kept as is.
+		s.sendEvent(event, func() interface{} { return event.Payload })
 
 	case "delete":
 		s.state = stateDeleted
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.sendEvent(event, func() interface{} { return event.Payload })
 		s.unsubscribeDirect(reserr.ErrDeleted)
 	default:
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.sendEvent(event, func() interface{} { return event.Payload })
 	}
 }
 
 func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 	switch event.Event {
 	case "change":
+		if s.fields != nil {
+			if event = s.fields.changeEvent(event); event == nil {
+				return
+			}
+		}
+		s.updateModel(event.Changed)
 		ch := event.Changed
 		old := event.OldValues
 		var subs []*Subscription
@@ -701,12 +867,7 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 			for _, sub := range subs {
 				sub.indirectsent++
 			}
-			// Legacy behavior
-			if s.c.ProtocolVersion() < versionSoftResourceReferenceAndDataValue {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed)}))
-			} else {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed}))
-			}
+			s.sendEvent(event, func() interface{} { return rpc.ChangeEvent{Values: s.changedValues(event)} })
 			return
 		}
 
@@ -732,12 +893,12 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 					for _, sub := range subs {
 						sub.populateResourcesLegacy(r, true)
 					}
-					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed), Resources: r}))
+					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: s.changedValues(event), Resources: r}))
 				} else {
 					for _, sub := range subs {
 						sub.populateResources(r, true)
 					}
-					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed, Resources: r}))
+					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: s.changedValues(event), Resources: r}))
 				}
 				for _, sub := range subs {
 					sub.ReleaseRPCResources()
@@ -748,13 +909,46 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 		}
 	case "delete":
 		s.state = stateDeleted
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.sendEvent(event, func() interface{} { return event.Payload })
 		s.unsubscribeDirect(reserr.ErrDeleted)
 	default:
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.sendEvent(event, func() interface{} { return event.Payload })
 	}
 }
 
+// sendEvent sends an event to the client, with the event data returned by the
+// data callback. The encoded event is shared with other subscriptions having
+// the same resource ID and protocol version, so data must depend on nothing
+// but the event and the protocol version.
+func (s *Subscription) sendEvent(event *rescache.ResourceEvent, data func() interface{}) {
+	v := rescache.EventVariant{RID: s.rid, ProtocolVersion: s.c.ProtocolVersion()}
+	s.c.Send(event.Encode(v, func() []byte {
+		return rpc.NewEvent(s.rid, event.Event, data())
+	}))
+}
+
+// changedValues returns the changed values of a model change event, in a
+// format supported by the client's protocol version. Changed data values are
+// sent as patch values to clients supporting it.
+func (s *Subscription) changedValues(event *rescache.ResourceEvent) interface{} {
+	ver := s.c.ProtocolVersion()
+	// Legacy behavior
+	if ver < versionSoftResourceReferenceAndDataValue {
+		return rescache.Legacy120ValueMap(event.Changed)
+	}
+	if ver < versionDataValuePatch || len(event.Patches) == 0 {
+		return event.Changed
+	}
+	ch := make(map[string]codec.Value, len(event.Changed))
+	for k, v := range event.Changed {
+		ch[k] = v
+	}
+	for k, v := range event.Patches {
+		ch[k] = v
+	}
+	return ch
+}
+
 func (s *Subscription) handleReaccess(t *rescache.Throttle) {
 	s.access = nil
 	s.flags &= ^flagReaccess
@@ -805,6 +999,9 @@ func (s *Subscription) Dispose() {
 	s.readyCallbacks = nil
 	s.eventQueue = nil
 	s.throttle = nil
+	if s.window != nil {
+		s.window.pending = nil
+	}
 
 	if s.resourceSub != nil {
 		s.unsubscribeRefs()
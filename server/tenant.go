@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// tenant holds the messaging client and cache for clients mapped to a subject
+// prefix by host or path, and the paths of the endpoints the clients connect
+// to. Clients not mapped to a tenant in the tenants setting use the default
+// tenant, with the subjectPrefix setting.
+type tenant struct {
+	host  string // Host name to match, or empty to match any host.
+	path  string // Path that the endpoints are served under, or empty.
+	mq    mq.Client
+	cache *rescache.Cache
+	enc   APIEncoder // Encoder with resource paths under the tenant path
+
+	// Endpoint paths, prefixed with the tenant path
+	wsPath      string
+	apiPath     string
+	graphqlPath string
+	openAPIPath string
+
+	// openapi
+	openAPIMu      sync.Mutex
+	openAPIDoc     []byte        // Encoded document, or nil if not built
+	openAPIExpires time.Time     // Time when openAPIDoc is to be rebuilt
+	openAPIBuild   chan struct{} // Closed when an ongoing build is done
+}
+
+// initTenants creates the default tenant, and a tenant for each entry in the
+// tenants setting, each with its own prefixed messaging client and cache.
+// The base client is the messaging client without any subject prefix.
+func (s *Service) initTenants(base mq.Client) {
+	s.tenant = s.newTenant("", "", s.mq, s.cache, s.enc)
+	s.tenants = make([]*tenant, len(s.cfg.Tenants))
+	for i, tc := range s.cfg.Tenants {
+		cfg := s.cfg
+		cfg.APIPath = tc.Path + s.cfg.APIPath
+		c := mq.WithPrefix(base, tc.SubjectPrefix)
+		snapshot := ""
+		if s.cfg.CacheSnapshot != "" {
+			snapshot = s.cfg.CacheSnapshot + "." + tc.SubjectPrefix
+		}
+		s.tenants[i] = s.newTenant(tc.Host, tc.Path, c, s.newCache(c, snapshot), apiEncoderFactories[strings.ToLower(s.cfg.APIEncoding)](cfg))
+	}
+}
+
+func (s *Service) newTenant(host, path string, c mq.Client, cache *rescache.Cache, enc APIEncoder) *tenant {
+	t := &tenant{
+		host:    host,
+		path:    path,
+		mq:      c,
+		cache:   cache,
+		enc:     enc,
+		wsPath:  path + s.cfg.WSPath,
+		apiPath: path + s.cfg.APIPath,
+	}
+	if s.cfg.graphqlPath != "" {
+		t.graphqlPath = path + s.cfg.graphqlPath
+	}
+	if s.cfg.openAPIPath != "" {
+		t.openAPIPath = path + s.cfg.openAPIPath
+	}
+	return t
+}
+
+// tenantFor returns the first tenant matching the host and path of the
+// request, or the default tenant if none matches.
+func (s *Service) tenantFor(r *http.Request) *tenant {
+	if len(s.tenants) == 0 {
+		return s.tenant
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, t := range s.tenants {
+		if t.host != "" && !strings.EqualFold(t.host, host) {
+			continue
+		}
+		if t.path != "" && r.URL.Path != t.path && !strings.HasPrefix(r.URL.Path, t.path+"/") {
+			continue
+		}
+		return t
+	}
+	return s.tenant
+}
+
+// startTenantCaches starts the caches of the tenants in the tenants setting.
+// Service.mu is held when called
+func (s *Service) startTenantCaches() error {
+	for _, t := range s.tenants {
+		if err := t.cache.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopTenantCaches stops the caches of the tenants in the tenants setting.
+func (s *Service) stopTenantCaches() {
+	for _, t := range s.tenants {
+		t.cache.Stop()
+	}
+}
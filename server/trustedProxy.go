@@ -0,0 +1,197 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// forwardedHop is an address in a chain of forwarding proxies, together with
+// the scheme and host of the request sent from that address.
+type forwardedHop struct {
+	addr  string
+	proto string
+	host  string
+}
+
+// parseTrustedProxy parses an IP address, or an IP address and prefix length
+// in CIDR notation, into an IP network.
+func parseTrustedProxy(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		return ipnet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("invalid IP address")
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	bits := len(ip) * 8
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// isTrustedProxy reports if the IP address belongs to a trusted proxy.
+func (s *Service) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range s.cfg.trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveForwarded returns the request with RemoteAddr, Host, and URL.Scheme
+// set to the values of the originating client, as reported by the Forwarded,
+// or X-Forwarded-For, X-Forwarded-Proto, and X-Forwarded-Host headers.
+//
+// The headers are only used if the request is sent from a trusted proxy. The
+// client is the rightmost address in the chain that is not a trusted proxy.
+// If the chain contains an address that is not an IP address, the headers
+// are ignored.
+//
+// RemoteAddr is set on the same IP:port format as for direct connections. If
+// the headers contain no port, as is common for X-Forwarded-For, the port is
+// set to 0.
+func (s *Service) resolveForwarded(r *http.Request) *http.Request {
+	if len(s.cfg.trustedProxies) == 0 || !s.isTrustedProxy(addrIP(r.RemoteAddr)) {
+		return r
+	}
+
+	hops := forwardedHops(r.Header)
+	if len(hops) == 0 {
+		return r
+	}
+
+	var hop forwardedHop
+	var ip net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop = hops[i]
+		ip = addrIP(hop.addr)
+		if ip == nil {
+			return r
+		}
+		if !s.isTrustedProxy(ip) {
+			break
+		}
+	}
+
+	r = r.WithContext(r.Context())
+	r.RemoteAddr = net.JoinHostPort(ip.String(), addrPort(hop.addr))
+	if hop.host != "" {
+		r.Host = hop.host
+	}
+	if hop.proto != "" && r.URL != nil {
+		u := *r.URL
+		u.Scheme = strings.ToLower(hop.proto)
+		r.URL = &u
+	}
+	return r
+}
+
+// forwardedHops returns the chain of forwarded addresses, with the client
+// first, from the Forwarded header. If no Forwarded header is set, the chain
+// is taken from the X-Forwarded-For header, with the scheme and host taken
+// from the X-Forwarded-Proto and X-Forwarded-Host headers.
+func forwardedHops(h http.Header) []forwardedHop {
+	if fwd := h.Values("Forwarded"); len(fwd) > 0 {
+		var hops []forwardedHop
+		for _, elem := range splitHeaderList(fwd, ',') {
+			var hop forwardedHop
+			for _, pair := range splitHeaderList([]string{elem}, ';') {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "for":
+					hop.addr = value
+				case "proto":
+					hop.proto = value
+				case "host":
+					hop.host = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	addrs := splitHeaderList(h.Values("X-Forwarded-For"), ',')
+	protos := splitHeaderList(h.Values("X-Forwarded-Proto"), ',')
+	hosts := splitHeaderList(h.Values("X-Forwarded-Host"), ',')
+	hops := make([]forwardedHop, len(addrs))
+	for i, addr := range addrs {
+		hops[i] = forwardedHop{
+			addr:  addr,
+			proto: forwardedValue(protos, i, len(addrs)),
+			host:  forwardedValue(hosts, i, len(addrs)),
+		}
+	}
+	return hops
+}
+
+// forwardedValue returns the value for the address at index i, out of n
+// addresses. If there is not one value per address, the last value, set by
+// the nearest proxy, is returned.
+func forwardedValue(values []string, i, n int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if len(values) == n {
+		return values[i]
+	}
+	return values[len(values)-1]
+}
+
+// splitHeaderList splits the header values by the separator, ignoring
+// separators within quoted strings. Empty elements are omitted.
+func splitHeaderList(values []string, sep byte) []string {
+	var l []string
+	for _, v := range values {
+		quoted := false
+		start := 0
+		for i := 0; i <= len(v); i++ {
+			if i < len(v) {
+				if v[i] == '"' {
+					quoted = !quoted
+				}
+				if v[i] != sep || quoted {
+					continue
+				}
+			}
+			if elem := strings.TrimSpace(v[start:i]); elem != "" {
+				l = append(l, elem)
+			}
+			start = i + 1
+		}
+	}
+	return l
+}
+
+// addrIP returns the IP address of a network address, with or without port.
+// Returns nil if the address does not contain an IP address.
+func addrIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// addrPort returns the port of a network address, or "0" if the address has
+// no numeric port.
+func addrPort(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			return port
+		}
+	}
+	return "0"
+}
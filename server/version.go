@@ -1,12 +1,22 @@
 package server
 
+import "strconv"
+
 // Protocol versions
 const (
-	versionLatest = 1002003 // MAJOR * 1000000 + MINOR * 1000 + PATCH
+	versionLatest = 1002004 // MAJOR * 1000000 + MINOR * 1000 + PATCH
 	versionLegacy = 1001001
 )
 
 const (
 	versionCallResourceResponse              = 1002000
 	versionSoftResourceReferenceAndDataValue = 1002001
+	versionCollectionMove                    = 1002004
+	versionDataValuePatch                    = 1002004
+	versionConnMessage                       = 1002004
 )
+
+// versionString returns the protocol version as a MAJOR.MINOR.PATCH string.
+func versionString(v int) string {
+	return strconv.Itoa(v/1000000) + "." + strconv.Itoa(v/1000%1000) + "." + strconv.Itoa(v%1000)
+}
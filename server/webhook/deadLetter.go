@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter stores events that could not be delivered, appending them as
+// JSON lines to a file.
+type DeadLetter struct {
+	mu     sync.Mutex
+	path   string
+	logger Logger
+}
+
+// DeadLetterEntry is a line in the dead letter log.
+type DeadLetterEntry struct {
+	URL     string          `json:"url"`
+	Error   string          `json:"error"`
+	Time    string          `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewDeadLetter creates a dead letter log writing to the file at path.
+func NewDeadLetter(path string, l Logger) *DeadLetter {
+	return &DeadLetter{path: path, logger: l}
+}
+
+// Add appends an undelivered event payload to the log.
+func (dl *DeadLetter) Add(url string, payload []byte, err error) {
+	line, _ := json.Marshal(DeadLetterEntry{
+		URL:     url,
+		Error:   err.Error(),
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Payload: payload,
+	})
+	line = append(line, '\n')
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	f, err := os.OpenFile(dl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		dl.logger.Errorf("Error opening webhook dead letter log: %s", err)
+		return
+	}
+	if _, err = f.Write(line); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		dl.logger.Errorf("Error writing webhook dead letter log: %s", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package webhook forwards resource events to HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/rs/xid"
+)
+
+// Default settings
+const (
+	DefaultMaxRetries = 5
+	DefaultRetryDelay = time.Second
+	DefaultTimeout    = 10 * time.Second
+	DefaultQueueSize  = 1000
+)
+
+// MaxRetryDelay is the upper limit of the exponential retry backoff.
+const MaxRetryDelay = time.Minute
+
+// HTTP headers set on each webhook request.
+const (
+	HeaderEvent     = "X-Resgate-Event"
+	HeaderResource  = "X-Resgate-Resource"
+	HeaderDelivery  = "X-Resgate-Delivery"
+	HeaderTimestamp = "X-Resgate-Timestamp"
+	HeaderSignature = "X-Resgate-Signature"
+)
+
+// Events lists the resource events that may be forwarded.
+var Events = []string{"change", "add", "remove", "move", "delete"}
+
+var (
+	errQueueFull = errors.New("delivery queue is full")
+	errStopped   = errors.New("webhook stopped")
+)
+
+// Logger is used to write log messages.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// Config holds the configuration of a Webhook.
+type Config struct {
+	URL        string
+	Resources  []rescache.ResourcePattern
+	Events     []string // Events to forward. Empty means all events.
+	Secret     string   // HMAC-SHA256 key used to sign requests. Empty means unsigned.
+	MaxRetries int
+	RetryDelay time.Duration // Initial delay, doubled for each retry.
+	Timeout    time.Duration
+	QueueSize  int
+}
+
+// Payload is the JSON body posted for each forwarded event.
+type Payload struct {
+	ID        string          `json:"id"`
+	Resource  string          `json:"resource"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp int64           `json:"timestamp"` // Unix time in milliseconds
+}
+
+// Webhook forwards resource events to an HTTP endpoint. Events are delivered
+// one at a time, in the order they are enqueued.
+type Webhook struct {
+	cfg        Config
+	events     map[string]bool
+	client     *http.Client
+	logger     Logger
+	deadLetter *DeadLetter
+
+	queue chan *delivery
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+type delivery struct {
+	id    string
+	rid   string
+	event string
+	body  []byte
+}
+
+// New creates a new Webhook. Events failing delivery are added to the dead
+// letter log.
+func New(cfg Config, l Logger, dl *DeadLetter) *Webhook {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	var events map[string]bool
+	if len(cfg.Events) > 0 {
+		events = make(map[string]bool, len(cfg.Events))
+		for _, ev := range cfg.Events {
+			events[ev] = true
+		}
+	}
+	return &Webhook{
+		cfg:        cfg,
+		events:     events,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		logger:     l,
+		deadLetter: dl,
+	}
+}
+
+// URL returns the URL of the webhook endpoint.
+func (w *Webhook) URL() string {
+	return w.cfg.URL
+}
+
+// Start starts the delivery goroutine.
+func (w *Webhook) Start() {
+	w.queue = make(chan *delivery, w.cfg.QueueSize)
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run()
+}
+
+// Stop stops the delivery goroutine. Any undelivered events are added to the
+// dead letter log.
+func (w *Webhook) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+// Matches reports whether an event on the resource should be forwarded. Any
+// query part of the resource ID is ignored when matching the patterns.
+func (w *Webhook) Matches(rid string, event string) bool {
+	if w.events != nil && !w.events[event] {
+		return false
+	}
+	name := rid
+	if idx := strings.IndexByte(rid, '?'); idx >= 0 {
+		name = rid[:idx]
+	}
+	for _, p := range w.cfg.Resources {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enqueue adds an event on a resource to the delivery queue, if it matches
+// the webhook. It never blocks. If the queue is full, the event is added to
+// the dead letter log.
+func (w *Webhook) Enqueue(rid string, event string, data json.RawMessage) {
+	if !w.Matches(rid, event) {
+		return
+	}
+
+	d := &delivery{
+		id:    xid.New().String(),
+		rid:   rid,
+		event: event,
+	}
+	d.body, _ = json.Marshal(Payload{
+		ID:        d.id,
+		Resource:  rid,
+		Event:     event,
+		Data:      data,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+
+	select {
+	case w.queue <- d:
+	default:
+		w.fail(d, errQueueFull)
+	}
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	for {
+		select {
+		case d := <-w.queue:
+			w.deliver(d)
+		case <-w.stop:
+			for {
+				select {
+				case d := <-w.queue:
+					w.fail(d, errStopped)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts the event, retrying with exponential backoff until it
+// succeeds, fails with a non-retryable error, or the retries are exhausted.
+func (w *Webhook) deliver(d *delivery) {
+	delay := w.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(d)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.cfg.MaxRetries {
+			w.fail(d, err)
+			return
+		}
+
+		w.logger.Debugf("Webhook %s: delivery %s failed, retrying in %s: %s", w.cfg.URL, d.id, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-w.stop:
+			w.fail(d, errStopped)
+			return
+		}
+		delay *= 2
+		if delay > MaxRetryDelay {
+			delay = MaxRetryDelay
+		}
+	}
+}
+
+// post sends a single delivery attempt. It returns an error if the attempt
+// failed, and whether it should be retried.
+func (w *Webhook) post(d *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.event)
+	req.Header.Set(HeaderResource, d.rid)
+	req.Header.Set(HeaderDelivery, d.id)
+	req.Header.Set(HeaderTimestamp, ts)
+	if w.cfg.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.cfg.Secret, ts, d.body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("unexpected response status: %s", resp.Status)
+}
+
+func (w *Webhook) fail(d *delivery, err error) {
+	w.logger.Errorf("Webhook %s: failed to deliver %s event on %s: %s", w.cfg.URL, d.event, d.rid, err)
+	if w.deadLetter != nil {
+		w.deadLetter.Add(w.cfg.URL, d.body, err)
+	}
+}
+
+// Sign returns the signature header value for a request body sent at the
+// timestamp. The signature is a hex encoded HMAC-SHA256 of the timestamp and
+// the body, separated by a dot.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
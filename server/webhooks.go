@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/webhook"
+)
+
+// initWebhooks creates the configured webhooks and sets the cache event hook
+// to forward events to them.
+func (s *Service) initWebhooks() {
+	if len(s.cfg.Webhooks) == 0 {
+		return
+	}
+
+	var dl *webhook.DeadLetter
+	if s.cfg.WebhookDeadLetter != "" {
+		dl = webhook.NewDeadLetter(s.cfg.WebhookDeadLetter, s)
+	}
+
+	s.webhooks = make([]*webhook.Webhook, len(s.cfg.Webhooks))
+	for i, wc := range s.cfg.Webhooks {
+		patterns := make([]rescache.ResourcePattern, len(wc.Resources))
+		for j, p := range wc.Resources {
+			patterns[j] = rescache.ParseResourcePattern(p)
+		}
+		maxRetries := webhook.DefaultMaxRetries
+		if wc.MaxRetries != nil {
+			maxRetries = *wc.MaxRetries
+		}
+		s.webhooks[i] = webhook.New(webhook.Config{
+			URL:        wc.URL,
+			Resources:  patterns,
+			Events:     wc.Events,
+			Secret:     wc.Secret,
+			MaxRetries: maxRetries,
+			RetryDelay: time.Duration(wc.RetryDelay) * time.Millisecond,
+			Timeout:    time.Duration(wc.Timeout) * time.Millisecond,
+		}, s, dl)
+	}
+	s.cache.SetEventHook(s.forwardEvent)
+}
+
+// forwardEvent enqueues a resource event on all webhooks. It is called by
+// the cache event hook, with the resource locked, for each event applied to a
+// cached resource.
+func (s *Service) forwardEvent(rid string, ev *rescache.ResourceEvent) {
+	data := webhookEventData(ev)
+	for _, w := range s.webhooks {
+		w.Enqueue(rid, ev.Event, data)
+	}
+}
+
+// webhookEventData returns the JSON encoded data of a resource event, as
+// applied to the cached resource. Delete events have no data.
+func webhookEventData(ev *rescache.ResourceEvent) json.RawMessage {
+	switch ev.Event {
+	case "change":
+		return codec.EncodeChangeEvent(ev.Changed)
+	case "add":
+		return codec.EncodeAddEvent(&codec.AddEvent{Idx: ev.Idx, Value: ev.Value})
+	case "remove":
+		return codec.EncodeRemoveEvent(&codec.RemoveEvent{Idx: ev.Idx})
+	case "move":
+		return codec.EncodeMoveEvent(&codec.MoveEvent{From: ev.Idx, To: ev.To})
+	}
+	return nil
+}
+
+// startWebhooks starts the delivery of webhook events.
+// Service.mu is held when called
+func (s *Service) startWebhooks() {
+	for _, w := range s.webhooks {
+		w.Start()
+	}
+}
+
+// stopWebhooks stops the delivery of webhook events. Undelivered events are
+// added to the dead letter log.
+func (s *Service) stopWebhooks() {
+	if len(s.webhooks) == 0 {
+		return
+	}
+	s.Debugf("Stopping webhooks...")
+	for _, w := range s.webhooks {
+		w.Stop()
+	}
+	s.Debugf("Webhooks stopped")
+}
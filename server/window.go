@@ -0,0 +1,163 @@
+package server
+
+import (
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+	"github.com/resgateio/resgate/server/rpc"
+)
+
+// window is the range of a collection sent to the client on a windowed
+// subscription.
+type window struct {
+	offset int
+	limit  int
+	// values holds all the values of the collection, as known by the
+	// subscription. The slice is owned by the cache and must not be modified.
+	values []codec.Value
+	// pending holds translated events left to process once the subscription
+	// stops queueing events.
+	pending []*rescache.ResourceEvent
+}
+
+var (
+	errWindowOnModel  = &reserr.Error{Code: reserr.CodeInvalidParams, Message: "Window is only supported on collections"}
+	errWindowMismatch = &reserr.Error{Code: reserr.CodeInvalidParams, Message: "Window does not match existing subscription"}
+)
+
+// matches reports whether the window matches the requested window. A nil
+// window only matches a nil request.
+func (w *window) matches(rw *rpc.Window) bool {
+	if w == nil || rw == nil {
+		return w == nil && rw == nil
+	}
+	return w.offset == rw.Offset && w.limit == rw.Limit
+}
+
+// slice returns the values within the window.
+func (w *window) slice() []codec.Value {
+	l := len(w.values)
+	if w.offset >= l {
+		return []codec.Value{}
+	}
+	end := w.offset + w.limit
+	if end > l {
+		end = l
+	}
+	return w.values[w.offset:end]
+}
+
+// translate updates the window with a collection add, remove, or move event,
+// and returns the resulting events relative to the window.
+func (w *window) translate(ev *rescache.ResourceEvent) []*rescache.ResourceEvent {
+	old := w.values
+	w.values = ev.Values
+	before := valueAt(old)
+	after := valueAt(ev.Values)
+
+	switch ev.Event {
+	case "add":
+		return w.add(nil, ev.Idx, ev.Value, len(old), before, after)
+	case "remove":
+		return w.remove(nil, ev.Idx, len(old), before, after)
+	case "move":
+		from, to := ev.Idx, ev.To
+		end := w.offset + w.limit
+		if from >= w.offset && from < end && to >= w.offset && to < end {
+			return []*rescache.ResourceEvent{windowMoveEvent(from-w.offset, to-w.offset, ev.Value)}
+		}
+		// Values in between the remove and the add of the moved value
+		between := func(i int) codec.Value {
+			if i < from {
+				return old[i]
+			}
+			return old[i+1]
+		}
+		evs := w.remove(nil, from, len(old), before, between)
+		n := len(evs)
+		evs = w.add(evs, to, ev.Value, len(old)-1, between, after)
+		// Drop any value pulled into the window by the remove, only to be
+		// pushed out again by the add.
+		if n > 0 && len(evs) > n && evs[n-1].Event == "add" && evs[n].Event == "remove" && evs[n-1].Idx == evs[n].Idx {
+			evs = append(evs[:n-1], evs[n+1:]...)
+		}
+		return evs
+	}
+	return nil
+}
+
+// add appends the window events for a value v added at idx to a collection
+// of length l. The before and after functions return the collection values
+// prior to, and after, the add.
+func (w *window) add(evs []*rescache.ResourceEvent, idx int, v codec.Value, l int, before, after func(int) codec.Value) []*rescache.ResourceEvent {
+	end := w.offset + w.limit
+	// Quick exit if the value is added after the window, or if the window
+	// remains empty.
+	if idx >= end || w.offset > l {
+		return evs
+	}
+	// Remove the last value pushed out of the window
+	if l >= end {
+		evs = append(evs, windowRemoveEvent(w.limit-1, before(end-1)))
+	}
+	// A value added prior to the window pushes a value into the window
+	if idx < w.offset {
+		return append(evs, windowAddEvent(0, after(w.offset)))
+	}
+	return append(evs, windowAddEvent(idx-w.offset, v))
+}
+
+// remove appends the window events for a value removed at idx from a
+// collection of length l. The before and after functions return the
+// collection values prior to, and after, the remove.
+func (w *window) remove(evs []*rescache.ResourceEvent, idx int, l int, before, after func(int) codec.Value) []*rescache.ResourceEvent {
+	end := w.offset + w.limit
+	// Quick exit if the value is removed after the window, or if the window
+	// is empty.
+	if idx >= end || w.offset >= l {
+		return evs
+	}
+	// A value removed prior to the window pulls the first value out of the
+	// window.
+	if idx < w.offset {
+		evs = append(evs, windowRemoveEvent(0, before(w.offset)))
+	} else {
+		evs = append(evs, windowRemoveEvent(idx-w.offset, before(idx)))
+	}
+	// Add the value pulled into the window
+	if end < l {
+		evs = append(evs, windowAddEvent(w.limit-1, after(end-1)))
+	}
+	return evs
+}
+
+func valueAt(vals []codec.Value) func(int) codec.Value {
+	return func(i int) codec.Value { return vals[i] }
+}
+
+func windowAddEvent(idx int, v codec.Value) *rescache.ResourceEvent {
+	return &rescache.ResourceEvent{
+		Event: "add",
+		Idx:   idx,
+		Value: v,
+	}
+}
+
+func windowRemoveEvent(idx int, v codec.Value) *rescache.ResourceEvent {
+	return &rescache.ResourceEvent{
+		Event:   "remove",
+		Payload: codec.EncodeRemoveEvent(&codec.RemoveEvent{Idx: idx}),
+		Idx:     idx,
+		Value:   v,
+	}
+}
+
+func windowMoveEvent(from, to int, v codec.Value) *rescache.ResourceEvent {
+	return &rescache.ResourceEvent{
+		Event:   "move",
+		Payload: codec.EncodeMoveEvent(&codec.MoveEvent{From: from, To: to}),
+		Idx:     from,
+		To:      to,
+		Value:   v,
+	}
+}
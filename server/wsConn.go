@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"github.com/resgateio/resgate/server/codec"
@@ -25,11 +27,16 @@ type wsConn struct {
 	token       json.RawMessage
 	tid         string
 	serv        *Service
+	tenant      *tenant
 	subs        map[string]*Subscription
 	disposing   bool
 	mqSub       mq.Unsubscriber
 	connStr     string
 	protocolVer int
+	connected   time.Time // Time the websocket was established.
+	// onEvent, if set, is called with events instead of sending them over
+	// the websocket. Used by GraphQL connections.
+	onEvent func(data []byte)
 
 	queue []func()
 	work  chan struct{}
@@ -37,11 +44,24 @@ type wsConn struct {
 	mu sync.Mutex
 }
 
+const (
+	// connEventPrefix is the resource ID part of the event name for
+	// connection events sent to the client. It is reserved, and may not be
+	// used as a resource name.
+	connEventPrefix = codec.ConnEventRID
+
+	// wsControlWriteTimeout is the time allowed to write a control message.
+	wsControlWriteTimeout = 5 * time.Second
+
+	// wsMaxCloseReasonLen is the maximum length of a close message reason.
+	wsMaxCloseReasonLen = 123
+)
+
 var (
 	errInvalidNewResourceResponse = reserr.InternalError(errors.New("non-resource response on new request"))
 )
 
-func (s *Service) newWSConn(request *http.Request, protocol int) *wsConn {
+func (s *Service) newWSConn(request *http.Request, t *tenant, protocol int) *wsConn {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -54,6 +74,7 @@ func (s *Service) newWSConn(request *http.Request, protocol int) *wsConn {
 		cid:         xid.New().String(),
 		request:     request,
 		serv:        s,
+		tenant:      t,
 		subs:        make(map[string]*Subscription),
 		queue:       make([]func(), 0, WSConnWorkerQueueSize),
 		work:        make(chan struct{}, 1),
@@ -69,7 +90,7 @@ func (s *Service) newWSConn(request *http.Request, protocol int) *wsConn {
 
 	// Subscribe to conn events on the mq
 	conn.subscribeConn()
-	s.cache.AddConn(conn)
+	t.cache.AddConn(conn)
 
 	return conn
 }
@@ -97,12 +118,15 @@ func (c *wsConn) listen(ws *websocket.Conn) {
 	var err error
 
 	c.ws = ws
+	c.serv.setReadLimit(ws)
+	ka := c.startKeepAlive(ws)
 
 	// Loop until an error is returned when reading
 	for {
 		if _, in, err = c.ws.ReadMessage(); err != nil {
 			break
 		}
+		ka.received()
 
 		c.Tracef("--> %s", in)
 		in := in
@@ -111,6 +135,8 @@ func (c *wsConn) listen(ws *websocket.Conn) {
 		})
 	}
 
+	ka.stop(err)
+	c.serv.handleReadLimitError(ws, err)
 	c.Dispose()
 	c.Tracef("Disconnected: %s", err)
 }
@@ -127,8 +153,16 @@ func (c *wsConn) dispose() {
 	close(c.work)
 	c.mu.Unlock()
 
-	c.serv.cache.RemoveConn(c)
+	c.tenant.cache.RemoveConn(c)
 	c.unsubscribeConn()
+	if !c.connected.IsZero() {
+		c.publishConnEvent("disconnected", codec.EncodeConnDisconnectedEvent(&codec.ConnDisconnectedEvent{
+			RemoteAddr: c.request.RemoteAddr,
+			Protocol:   versionString(c.protocolVer),
+			TID:        c.tid,
+			Duration:   time.Since(c.connected).Milliseconds(),
+		}))
+	}
 
 	subs := c.subs
 	c.subs = nil
@@ -189,6 +223,30 @@ func (c *wsConn) Disconnect(reason string) {
 	}
 }
 
+// close sends a normal closure close message with the reason, and closes the
+// websocket connection. Must be called from the worker goroutine.
+func (c *wsConn) close(reason string) {
+	if c.ws == nil {
+		return
+	}
+	c.Tracef("Disconnecting - %s", reason)
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, truncateCloseReason(reason)), time.Now().Add(wsControlWriteTimeout))
+	c.ws.Close()
+}
+
+// truncateCloseReason truncates the reason to fit in a close message, without
+// splitting a multi-byte character.
+func truncateCloseReason(reason string) string {
+	if len(reason) <= wsMaxCloseReasonLen {
+		return reason
+	}
+	i := wsMaxCloseReasonLen
+	for i > 0 && !utf8.RuneStart(reason[i]) {
+		i--
+	}
+	return reason[:i]
+}
+
 // Enqueue puts the callback function in queue to be called
 // by the wsConn worker goroutine.
 // It returns false if the function was not queued due to
@@ -214,6 +272,10 @@ func (c *wsConn) enqueue(f func()) {
 }
 
 func (c *wsConn) Send(data []byte) {
+	if c.onEvent != nil {
+		c.onEvent(data)
+		return
+	}
 	if c.ws != nil {
 		c.Tracef("<<- %s", data)
 		c.ws.WriteMessage(websocket.TextMessage, data)
@@ -300,7 +362,7 @@ func (c *wsConn) GetHTTPSubscription(rid string, cb func(sub *Subscription, meta
 		return
 	}
 
-	c.serv.cache.Access(sub, c.token, true, func(access *rescache.Access, meta *codec.Meta) {
+	c.tenant.cache.Access(sub, c.token, true, func(access *rescache.Access, meta *codec.Meta) {
 		c.Enqueue(func() {
 			// If the status value in the meta should lead to a response without
 			// any subsequent requests, make a quick exit.
@@ -335,17 +397,38 @@ func (c *wsConn) GetHTTPSubscription(rid string, cb func(sub *Subscription, meta
 	})
 }
 
-func (c *wsConn) SubscribeResource(rid string, cb func(data *rpc.Resources, err error)) {
+func (c *wsConn) SubscribeResource(rid string, window *rpc.Window, fields []string, cb func(data *rpc.Resources, err error)) {
 	// Metrics
 	if c.serv.metrics != nil {
 		c.serv.metrics.WSRequestsSubscribe.Add(1)
 	}
 
+	// A window or fields can only be set on a new subscription
+	existing, ok := c.subs[rid]
+	if ok {
+		if !existing.window.matches(window) {
+			cb(nil, errWindowMismatch)
+			return
+		}
+		if !existing.fields.matches(fields) {
+			cb(nil, errFieldsMismatch)
+			return
+		}
+	}
+
 	sub, err := c.Subscribe(rid, true, nil)
 	if err != nil {
 		cb(nil, err)
 		return
 	}
+	if !ok {
+		if window != nil {
+			sub.SetWindow(window)
+		}
+		if fields != nil {
+			sub.SetFields(fields)
+		}
+	}
 
 	sub.CanGet(func(err error) {
 		if err != nil {
@@ -386,7 +469,7 @@ func (c *wsConn) CallResource(rid, action string, params interface{}, cb func(re
 func (c *wsConn) CallHTTPResource(rid, action string, params interface{}, cb func(result json.RawMessage, href string, err error, meta *codec.Meta)) {
 	sub := NewSubscription(c, rid, nil)
 
-	c.serv.cache.Access(sub, c.token, true, func(access *rescache.Access, accessMeta *codec.Meta) {
+	c.tenant.cache.Access(sub, c.token, true, func(access *rescache.Access, accessMeta *codec.Meta) {
 		c.Enqueue(func() {
 			// If the status value in the meta should lead to a response without
 			// any subsequent requests, make a quick exit.
@@ -403,7 +486,7 @@ func (c *wsConn) CallHTTPResource(rid, action string, params interface{}, cb fun
 				cb(nil, "", err, accessMeta)
 				return
 			}
-			c.serv.cache.Call(c, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, true, func(result json.RawMessage, refRID string, callMeta *codec.Meta, err error) {
+			c.tenant.cache.Call(c, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, true, func(result json.RawMessage, refRID string, callMeta *codec.Meta, err error) {
 				c.Enqueue(func() {
 					meta := accessMeta.Merge(callMeta)
 					if err != nil {
@@ -420,6 +503,15 @@ func (c *wsConn) CallHTTPResource(rid, action string, params interface{}, cb fun
 }
 
 func (c *wsConn) call(rid, action string, params interface{}, cb func(result json.RawMessage, refRID string, err error)) {
+	if err := c.serv.checkParamsSize(params); err != nil {
+		cb(nil, "", err)
+		return
+	}
+	if err := c.serv.validateCallParams(c.ExpandCID(rid), action, params); err != nil {
+		cb(nil, "", err)
+		return
+	}
+
 	sub, ok := c.subs[rid]
 	if !ok {
 		sub = NewSubscription(c, rid, nil)
@@ -430,7 +522,7 @@ func (c *wsConn) call(rid, action string, params interface{}, cb func(result jso
 			cb(nil, "", err)
 			return
 		}
-		c.serv.cache.Call(c, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, false, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
+		c.tenant.cache.Call(c, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, false, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
 			c.Enqueue(func() {
 				cb(result, refRID, err)
 			})
@@ -442,7 +534,7 @@ func (c *wsConn) call(rid, action string, params interface{}, cb func(result jso
 // set, while still establishing the HTTP/WebSocket connection.
 func (c *wsConn) AuthResourceNoResult(rid, action string, params interface{}, cb func(refRID string, err error, meta *codec.Meta)) {
 	rname, query := parseRID(c.ExpandCID(rid))
-	c.serv.cache.Auth(c, rname, query, action, c.token, params, true, func(result json.RawMessage, refRID string, meta *codec.Meta, err error) {
+	c.tenant.cache.Auth(c, rname, query, action, c.token, params, true, func(result json.RawMessage, refRID string, meta *codec.Meta, err error) {
 		c.Enqueue(func() {
 			cb(refRID, err, meta)
 		})
@@ -455,8 +547,13 @@ func (c *wsConn) AuthResource(rid, action string, params interface{}, cb func(re
 		c.serv.metrics.WSRequestsAuth.Add(1)
 	}
 
+	if err := c.serv.checkParamsSize(params); err != nil {
+		cb(nil, err)
+		return
+	}
+
 	rname, query := parseRID(c.ExpandCID(rid))
-	c.serv.cache.Auth(c, rname, query, action, c.token, params, false, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
+	c.tenant.cache.Auth(c, rname, query, action, c.token, params, false, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
 		c.Enqueue(func() {
 			c.handleCallAuthResponse(result, refRID, err, cb)
 		})
@@ -574,8 +671,12 @@ func (c *wsConn) subscribe(rid string, direct bool, t *rescache.Throttle) (*Subs
 	}
 
 	sub = NewSubscription(c, rid, t)
+	// GraphQL subscriptions are resolved against the values of each event
+	if c.onEvent != nil {
+		sub.TrackValues()
+	}
 	_ = c.addCount(sub, direct)
-	c.serv.cache.Subscribe(sub, t)
+	c.tenant.cache.Subscribe(sub, t)
 
 	c.subs[rid] = sub
 	return sub, nil
@@ -670,7 +771,7 @@ func (c *wsConn) setToken(token json.RawMessage, tid string) {
 }
 
 func (c *wsConn) Access(s *Subscription, cb func(*rescache.Access)) {
-	c.serv.cache.Access(s, c.token, false, func(access *rescache.Access, _ *codec.Meta) {
+	c.tenant.cache.Access(s, c.token, false, func(access *rescache.Access, _ *codec.Meta) {
 		cb(access)
 	})
 }
@@ -700,7 +801,7 @@ func (c *wsConn) outputWorker() {
 }
 
 func (c *wsConn) subscribeConn() {
-	mqSub, err := c.serv.mq.Subscribe("conn."+c.cid, func(subj string, payload []byte, _ error) {
+	mqSub, err := c.tenant.mq.Subscribe("conn."+c.cid, func(subj string, payload []byte, _ error) {
 		c.Enqueue(func() {
 			idx := len(c.cid) + 6 // Length of "conn." + "."
 			if idx >= len(subj) {
@@ -713,6 +814,10 @@ func (c *wsConn) subscribeConn() {
 			switch event {
 			case "token":
 				c.handleConnToken(payload)
+			case "disconnect":
+				c.handleConnDisconnect(payload)
+			case "message":
+				c.handleConnMessage(payload)
 			}
 		})
 	})
@@ -724,6 +829,31 @@ func (c *wsConn) subscribeConn() {
 	c.mqSub = mqSub
 }
 
+// setConnected marks the connection as an established websocket connection,
+// and publishes a connected event if enabled. A disconnected event will be
+// published once the connection is disposed.
+func (c *wsConn) setConnected() {
+	c.Enqueue(func() {
+		c.connected = time.Now()
+		c.publishConnEvent("connected", codec.EncodeConnConnectedEvent(&codec.ConnConnectedEvent{
+			RemoteAddr: c.request.RemoteAddr,
+			Protocol:   versionString(c.protocolVer),
+			TID:        c.tid,
+		}))
+	})
+}
+
+// publishConnEvent publishes a connection lifecycle event on
+// "conn."+cid+"."+event, if connEvents is enabled.
+func (c *wsConn) publishConnEvent(event string, payload []byte) {
+	if !c.serv.cfg.ConnEvents {
+		return
+	}
+	if err := c.tenant.mq.Publish("conn."+c.cid+"."+event, payload); err != nil {
+		c.Errorf("Error publishing conn %s event: %s", event, err)
+	}
+}
+
 func (c *wsConn) unsubscribeConn() {
 	if c.mqSub != nil {
 		c.mqSub.Unsubscribe()
@@ -740,6 +870,30 @@ func (c *wsConn) handleConnToken(payload []byte) {
 	c.setToken(te.Token, te.TID)
 }
 
+func (c *wsConn) handleConnDisconnect(payload []byte) {
+	de, err := codec.DecodeConnDisconnectEvent(payload)
+	if err != nil {
+		c.Errorf("Error processing disconnect event: malformed event payload: %s", err)
+		return
+	}
+
+	c.close(de.Reason)
+}
+
+func (c *wsConn) handleConnMessage(payload []byte) {
+	// Clients with a lower protocol version do not know of the event, and
+	// might mistake it for a custom event on a resource.
+	if c.protocolVer < versionConnMessage {
+		return
+	}
+	if !json.Valid(payload) {
+		c.Errorf("Error processing message event: malformed event payload: %s", payload)
+		return
+	}
+
+	c.Send(rpc.NewEvent(connEventPrefix, "message", json.RawMessage(payload)))
+}
+
 func (c *wsConn) ExpandCID(rid string) string {
 	return strings.Replace(rid, CIDPlaceholder, c.cid, -1)
 }
@@ -750,7 +904,7 @@ func (c *wsConn) TokenReset(tids map[string]bool, subject string) {
 		if c.tid == "" || !tids[c.tid] {
 			return
 		}
-		c.serv.cache.CustomAuth(c, subject, "", c.token, nil, func(_ json.RawMessage, _ string, _ *codec.Meta, err error) {
+		c.tenant.cache.CustomAuth(c, subject, "", c.token, nil, func(_ json.RawMessage, _ string, _ *codec.Meta, err error) {
 			// Discard response, but log an error if auth request timed out.
 			if err == mq.ErrRequestTimeout {
 				c.Errorf("Token reset auth request timeout on subject: %s", subject)
@@ -38,11 +38,14 @@ func (s *Service) initWSHandler() {
 // GetWSHandlerFunc returns the websocket http.Handler
 // Used for testing purposes
 func (s *Service) GetWSHandlerFunc() http.Handler {
-	return http.HandlerFunc(s.wsHandler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = s.resolveForwarded(r)
+		s.wsHandler(w, r, s.tenantFor(r))
+	})
 }
 
-func (s *Service) wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn := s.newWSConn(r, versionLegacy)
+func (s *Service) wsHandler(w http.ResponseWriter, r *http.Request, t *tenant) {
+	conn := s.newWSConn(r, t, versionLegacy)
 	if conn == nil {
 		return
 	}
@@ -59,7 +62,7 @@ func (s *Service) wsHandler(w http.ResponseWriter, r *http.Request) {
 			if meta != nil {
 				if meta.IsDirectResponseStatus() {
 					conn.Dispose()
-					httpStatusResponse(w, s.enc, *meta.Status, meta.Header, RIDToPath(refRID, s.cfg.APIPath), err)
+					httpStatusResponse(w, s.enc, *meta.Status, meta.Header, RIDToPath(refRID, t.apiPath), err)
 					return
 				}
 				if meta.Header != nil {
@@ -78,7 +81,8 @@ func (s *Service) wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn.Tracef("Connected: %s", ws.RemoteAddr())
+	conn.Tracef("Connected: %s", r.RemoteAddr)
+	conn.setConnected()
 
 	// Metrics
 	if s.metrics != nil {
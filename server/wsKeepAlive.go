@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsKeepAlive pings a websocket connection and closes it if no pong, or other
+// message, is received within the pong timeout. It also closes the connection
+// if no client message is received within the idle timeout.
+type wsKeepAlive struct {
+	c           *wsConn
+	ws          *websocket.Conn
+	readTimeout time.Duration
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	idle        int32
+	stopped     chan struct{}
+}
+
+// startKeepAlive starts pinging the websocket and tracking idle time, if
+// configured. Returns nil if neither ping interval nor idle timeout is set.
+func (c *wsConn) startKeepAlive(ws *websocket.Conn) *wsKeepAlive {
+	cfg := c.serv.cfg
+	if cfg.WSPingInterval == 0 && cfg.WSIdleTimeout == 0 {
+		return nil
+	}
+
+	ka := &wsKeepAlive{
+		c:       c,
+		ws:      ws,
+		stopped: make(chan struct{}),
+	}
+
+	if cfg.WSPingInterval > 0 {
+		pingInterval := time.Duration(cfg.WSPingInterval) * time.Millisecond
+		pongTimeout := pingInterval
+		if cfg.WSPongTimeout > 0 {
+			pongTimeout = time.Duration(cfg.WSPongTimeout) * time.Millisecond
+		}
+		ka.readTimeout = pingInterval + pongTimeout
+		ws.SetReadDeadline(time.Now().Add(ka.readTimeout))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(ka.readTimeout))
+		})
+		go ka.pinger(pingInterval)
+	}
+
+	if cfg.WSIdleTimeout > 0 {
+		ka.idleTimeout = time.Duration(cfg.WSIdleTimeout) * time.Millisecond
+		ka.idleTimer = time.AfterFunc(ka.idleTimeout, ka.onIdle)
+	}
+
+	return ka
+}
+
+// pinger sends a ping on each interval until stopped.
+func (ka *wsKeepAlive) pinger(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ka.stopped:
+			return
+		case <-ticker.C:
+			if err := ka.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsControlWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// onIdle closes the connection once the idle timeout is reached.
+func (ka *wsKeepAlive) onIdle() {
+	atomic.StoreInt32(&ka.idle, 1)
+	ka.c.Disconnect("idle timeout")
+}
+
+// received extends the read deadline and resets the idle timeout on a
+// received client message.
+func (ka *wsKeepAlive) received() {
+	if ka == nil {
+		return
+	}
+	if ka.readTimeout > 0 {
+		ka.ws.SetReadDeadline(time.Now().Add(ka.readTimeout))
+	}
+	if ka.idleTimer != nil {
+		ka.idleTimer.Reset(ka.idleTimeout)
+	}
+}
+
+// stop stops pinging and tracking idle time. If the connection was closed due
+// to a timeout, it is counted in the metrics.
+func (ka *wsKeepAlive) stop(err error) {
+	if ka == nil {
+		return
+	}
+	close(ka.stopped)
+	if ka.idleTimer != nil {
+		ka.idleTimer.Stop()
+	}
+
+	m := ka.c.serv.metrics
+	if atomic.LoadInt32(&ka.idle) == 1 {
+		if m != nil {
+			m.WSTimeoutsIdle.Add(1)
+		}
+		return
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		ka.c.Tracef("Pong timeout")
+		ka.ws.Close()
+		if m != nil {
+			m.WSTimeoutsPong.Add(1)
+		}
+	}
+}
@@ -235,3 +235,32 @@ func TestChangeEvent_WithSoftReferenceReplacedByResourceReference_SubscribesRefe
 		c.GetEvent(t).Equals(t, "test.model.custom", common.CustomEvent())
 	})
 }
+
+// Test change event sent to multiple clients with different protocol versions
+func TestChangeEvent_MultipleClientsWithDifferentVersions_SendsEventPerVersion(t *testing.T) {
+	model := resourceData("test.model")
+
+	runTest(t, func(s *Session) {
+		conns := []*Conn{s.Connect(), s.ConnectWithVersion("1.2.0"), s.Connect(), s.ConnectWithVersion("1.2.0")}
+		for i, c := range conns {
+			creq := c.Request("subscribe.test.model", nil)
+			if i == 0 {
+				mreqs := s.GetParallelRequests(t, 2)
+				mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+				mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+			} else {
+				s.GetRequest(t).AssertSubject(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			}
+			creq.GetResponse(t)
+		}
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"soft":{"rid":"test.model.soft","soft":true}}}`))
+		for i, c := range conns {
+			if i%2 == 0 {
+				c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"soft":{"rid":"test.model.soft","soft":true}}}`))
+			} else {
+				c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"soft":"test.model.soft"}}`))
+			}
+		}
+	})
+}
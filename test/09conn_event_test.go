@@ -2,8 +2,10 @@ package test
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 
+	"github.com/resgateio/resgate/server"
 	"github.com/resgateio/resgate/server/reserr"
 )
 
@@ -191,3 +193,71 @@ func TestTokenEventTriggersUnsubscribeOnDeniedAccessCall(t *testing.T) {
 		c.AssertNoEvent(t, "test.collection")
 	})
 }
+
+// Test disconnect event closes the connection
+func TestDisconnectEventClosesConnection(t *testing.T) {
+	for i, payload := range []json.RawMessage{
+		json.RawMessage(`{"reason":"Logged out"}`),
+		json.RawMessage(`{}`),
+		nil,
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+
+			s.ConnEvent(cid, "disconnect", payload)
+			c.AssertClosed(t)
+		})
+	}
+}
+
+// Test disconnect event with malformed payload is ignored
+func TestDisconnectEventWithMalformedPayload(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+
+		s.ConnEvent(cid, "disconnect", json.RawMessage(`{"reason":42}`))
+		// Assert the connection is still open
+		c.Request("version", versionRequest).
+			GetResponse(t).
+			AssertResult(t, json.RawMessage(`{"protocol":"`+server.ProtocolVersion+`"}`))
+		s.AssertErrorsLogged(t, 1)
+	})
+}
+
+// Test message event is sent to the client
+func TestMessageEventSentToClient(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+
+		s.ConnEvent(cid, "message", json.RawMessage(`{"notification":"Hello"}`))
+		c.GetEvent(t).Equals(t, "conn.message", json.RawMessage(`{"notification":"Hello"}`))
+	})
+}
+
+// Test message events are sent before disconnecting
+func TestMessageEventSentBeforeDisconnectEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+
+		s.ConnEvent(cid, "message", json.RawMessage(`"Logging out"`))
+		s.ConnEvent(cid, "disconnect", json.RawMessage(`{"reason":"Logged out"}`))
+		c.GetEvent(t).Equals(t, "conn.message", json.RawMessage(`"Logging out"`))
+		c.AssertClosed(t)
+	})
+}
+
+// Test message event is not sent to clients with a protocol version below
+// v1.2.4
+func TestMessageEventNotSentToLegacyClient(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithVersion("1.2.3")
+		cid := getCID(t, s, c)
+
+		s.ConnEvent(cid, "message", json.RawMessage(`{"notification":"Hello"}`))
+		c.AssertNoEvent(t, "test")
+	})
+}
@@ -3,6 +3,8 @@ package test
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -796,3 +798,73 @@ func TestSystemTokenReset_WithTimeoutOnAuthRequest_LogsError(t *testing.T) {
 		s.AssertErrorsLogged(t, 1)
 	})
 }
+
+// Test that the events generated by a system.reset on a collection transforms
+// the cached collection into the collection returned by the service.
+func TestSystemReset_ChangedCollection_EventsTransformCollection(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomCollection := func(n, max int) []int {
+		v := make([]int, n)
+		for i := range v {
+			v[i] = rnd.Intn(max)
+		}
+		return v
+	}
+	sequence := func(start, n int) []int {
+		v := make([]int, n)
+		for i := range v {
+			v[i] = start + i
+		}
+		return v
+	}
+
+	tbl := []struct {
+		Collections [][]int
+	}{
+		{[][]int{{}, {1, 2, 3}, {}}},
+		{[][]int{{1, 2, 3}, {3, 2, 1}, {2, 3, 1}, {1, 1, 2, 2}, {2, 1, 2, 1}}},
+		{[][]int{randomCollection(20, 5), randomCollection(30, 5), randomCollection(10, 5), randomCollection(25, 5)}},
+		{[][]int{randomCollection(200, 50), randomCollection(200, 50), randomCollection(150, 50)}},
+		// Exceeds the diff edit distance limit
+		{[][]int{sequence(0, 800), sequence(1000, 800), sequence(0, 800)}},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			data, _ := json.Marshal(l.Collections[0])
+			subscribeToCustomResource(t, s, c, "test.collection", resource{typ: typeCollection, data: string(data)})
+
+			collection := append([]int{}, l.Collections[0]...)
+			for _, next := range l.Collections[1:] {
+				data, _ = json.Marshal(next)
+				s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+				s.GetRequest(t).AssertSubject(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + string(data) + `}`))
+
+				// Apply events until the collection matches
+				for !reflect.DeepEqual(collection, next) {
+					ev := c.GetEvent(t)
+					m := ev.Data.(map[string]interface{})
+					idx := int(m["idx"].(float64))
+					switch ev.Event {
+					case "test.collection.add":
+						if idx < 0 || idx > len(collection) {
+							t.Fatalf("add event index %d out of range for collection of length %d", idx, len(collection))
+						}
+						collection = append(collection, 0)
+						copy(collection[idx+1:], collection[idx:])
+						collection[idx] = int(m["value"].(float64))
+					case "test.collection.remove":
+						if idx < 0 || idx >= len(collection) {
+							t.Fatalf("remove event index %d out of range for collection of length %d", idx, len(collection))
+						}
+						collection = append(collection[:idx], collection[idx+1:]...)
+					default:
+						t.Fatalf("unexpected event %s", ev.Event)
+					}
+				}
+				c.AssertNoEvent(t, "test.collection")
+			}
+		})
+	}
+}
@@ -38,6 +38,9 @@ func TestResponseOnInvalidRequests(t *testing.T) {
 		{"subscribe.test.*.model", nil, reserr.ErrInvalidRequest},
 		{"subscribe.test.>.model", nil, reserr.ErrInvalidRequest},
 		{"subscribe.test.model.>", nil, reserr.ErrInvalidRequest},
+		{"subscribe.conn", nil, reserr.ErrInvalidRequest},
+		{"subscribe.conn?foo=bar", nil, reserr.ErrInvalidRequest},
+		{"call.conn.method", nil, reserr.ErrInvalidRequest},
 	}
 
 	for i, l := range tbl {
@@ -38,6 +38,14 @@ func TestMetrics_DefaultResponse_ContainsExpectedValues(t *testing.T) {
 			`resgate_cache_resources 0`,
 			`# TYPE resgate_cache_subscriptions gauge`,
 			`resgate_cache_subscriptions 0`,
+			`# TYPE resgate_cache_event_gaps counter`,
+			`resgate_cache_event_gaps_total 0`,
+			`# TYPE resgate_cache_resets counter`,
+			`resgate_cache_resets_total 0`,
+			`# TYPE resgate_cache_resets_pending gauge`,
+			`resgate_cache_resets_pending 0`,
+			`# TYPE resgate_cache_audits counter`,
+			`resgate_cache_audits_total 0`,
 			`# EOF`,
 		})
 	}, func(cfg *server.Config) {
@@ -0,0 +1,156 @@
+// Tests for resource event sequence numbers
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// subscribeToSequencedResource makes a successful subscription to a resource
+// where the get response includes a sequence number.
+func subscribeToSequencedResource(t *testing.T, s *Session, c *Conn, rid string, seq int) {
+	rsrc := resources[rid]
+	creq := c.Request("subscribe."+rid, nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(`{"get":true}`))
+	switch rsrc.typ {
+	case typeModel:
+		mreqs.GetRequest(t, "get."+rid).RespondSuccess(map[string]interface{}{"model": json.RawMessage(rsrc.data), "seq": seq})
+	case typeCollection:
+		mreqs.GetRequest(t, "get."+rid).RespondSuccess(map[string]interface{}{"collection": json.RawMessage(rsrc.data), "seq": seq})
+	}
+	creq.GetResponse(t)
+}
+
+func TestEventSequence_SequentialEvents_ForwardsEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 1)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"},"seq":2}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12},"seq":3}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+	})
+}
+
+func TestEventSequence_DuplicateEvent_IsDiscarded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 5)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"},"seq":5}`))
+		c.AssertNoEvent(t, "test.model")
+	})
+}
+
+func TestEventSequence_LowerSequence_ResetsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 5)
+
+		// Sequence restarting, as after a service restart
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"},"seq":1}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null},"seq":1}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+
+		// Sequence continues from the reset get response
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12},"seq":2}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_event_gaps_total 1`,
+		})
+	}, func(cfg *server.Config) {
+		cfg.MetricsPort = 8090
+	})
+}
+
+func TestEventSequence_UnsequencedGetResponse_AcceptsFirstSequencedEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":0,"value":"bar","seq":42}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":0,"value":"bar"}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0,"seq":43}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+	})
+}
+
+func TestEventSequence_GapOnModel_ResetsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 1)
+
+		// Send event skipping sequence number 2
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz"},"seq":3}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+		// Events received while resetting are discarded
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz"},"seq":4}`))
+		req.RespondSuccess(json.RawMessage(`{"model":{"string":"baz","int":42,"bool":true},"seq":4}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"baz","null":{"action":"delete"}}}`))
+
+		// Sequence continues from the reset get response
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12},"seq":5}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_event_gaps_total 1`,
+		})
+	}, func(cfg *server.Config) {
+		cfg.MetricsPort = 8090
+	})
+}
+
+func TestEventSequence_GapOnCollection_ResetsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.collection", 10)
+
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0,"seq":12}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.collection").
+			RespondSuccess(json.RawMessage(`{"collection":[42,true,null],"seq":12}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+		c.AssertNoEvent(t, "test.collection")
+	})
+}
+
+func TestEventSequence_LegacyChangeEventDetection_IgnoresSequence(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 1)
+
+		// A values property together with seq must not be treated as a v1.0
+		// legacy change event, which would cause a deprecation warning.
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"},"seq":2}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	})
+}
+
+func TestEventSequence_LegacyChangeEventWithSequence_OmitsSequenceFromValues(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 1)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"string":"bar","int":12,"seq":2}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar","int":12}}`))
+
+		// Assert the cached model has no seq property
+		c2 := s.Connect()
+		creq := c2.Request("get.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).
+			AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"bar","int":12,"bool":true,"null":null}}}`))
+
+		// Deprecation warning of the legacy change event
+		s.AssertErrorsLogged(t, 1)
+	})
+}
@@ -0,0 +1,119 @@
+// Tests for the periodic cache audit
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// cacheAuditConfig enables the cache audit with a short interval, and the
+// metrics server for inspecting the audit results.
+func cacheAuditConfig(correct bool) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.CacheAuditInterval = 10
+		cfg.CacheAuditCorrect = correct
+		cfg.MetricsPort = 8090
+	}
+}
+
+func TestCacheAudit_MatchingModel_CountsAudit(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		// Await the next audit, leaving it unanswered
+		s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_audits_total 1`,
+		})
+	}, cacheAuditConfig(false))
+}
+
+func TestCacheAudit_DivergingModel_LogsDivergence(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true}}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		s.AssertErrorsLogged(t, 1)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_audits_total 1`,
+			`resgate_cache_audit_divergences_total{service="test"} 1`,
+		})
+		c.AssertNoEvent(t, "test.model")
+	}, cacheAuditConfig(false))
+}
+
+func TestCacheAudit_DivergingModelWithCorrect_SendsChangeEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar","null":{"action":"delete"}}}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		s.AssertErrorsLogged(t, 1)
+	}, cacheAuditConfig(true))
+}
+
+func TestCacheAudit_DivergingCollectionWithCorrect_SendsAddRemoveEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.collection").
+			RespondSuccess(json.RawMessage(`{"collection":["foo",42,"bar",null]}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":2}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":2,"value":"bar"}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.collection")
+
+		s.AssertErrorsLogged(t, 1)
+	}, cacheAuditConfig(true))
+}
+
+func TestCacheAudit_ModifiedWhileAuditing_IsInconclusive(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		req.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_audits_total 0`,
+		})
+	}, cacheAuditConfig(true))
+}
+
+func TestCacheAudit_MismatchingSequence_IsInconclusive(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToSequencedResource(t, s, c, "test.model", 1)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true},"seq":2}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_audits_total 0`,
+		})
+	}, cacheAuditConfig(true))
+}
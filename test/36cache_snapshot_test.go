@@ -0,0 +1,145 @@
+// Tests for the cache snapshot used for warm restarts
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func TestCacheSnapshot_RestartWithSnapshot_ServesStaleResourceAndRevalidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	withSnapshot := func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+	}
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		subscribeToTestCollection(t, s, c)
+	}, withSnapshot)
+
+	// Validate the snapshot written on stop
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected snapshot file, but got error: %s", err)
+	}
+	var snapshot struct {
+		Resources map[string]json.RawMessage `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("error decoding snapshot: %s", err)
+	}
+	AssertEqualJSON(t, "test.model snapshot", snapshot.Resources["test.model"], json.RawMessage(`{"result":{"model":`+resourceData("test.model")+`,"collection":null,"query":"","seq":0},"error":null}`))
+	AssertEqualJSON(t, "test.collection snapshot", snapshot.Resources["test.collection"], json.RawMessage(`{"result":{"model":null,"collection":`+resourceData("test.collection")+`,"query":"","seq":0},"error":null}`))
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		// The stale resource is served without awaiting the get response
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+		// Revalidation
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	}, withSnapshot)
+}
+
+func TestCacheSnapshot_StaleResourceUsedOnce_SendsGetRequestOnResubscribe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	err := os.WriteFile(path, []byte(`{"resources":{"test.model":{"result":{"model":`+resourceData("test.model")+`}}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t)
+		c.AssertNoEvent(t, "test.model")
+
+		// Remove the resource from the cache and subscribe again
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertUnsubscribe("test.model")
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+		cfg.NoUnsubscribeDelay = true
+	})
+}
+
+func TestCacheSnapshot_InvalidSnapshot_LogsErrorAndStartsCold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"resources":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		s.AssertErrorsLogged(t, 1)
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+	})
+}
+
+func TestCacheSnapshot_SnapshotOlderThanMaxAge_IsNotLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"resources":{"test.model":{"result":{"model":`+resourceData("test.model")+`}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-10 * time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+	})
+}
+
+func TestCacheSnapshot_StaleResourceAfterMaxAge_SendsGetRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"resources":{"test.model":{"result":{"model":`+resourceData("test.model")+`}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		// Wait for the snapshot to reach its max age
+		time.Sleep(500 * time.Millisecond)
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+		cfg.CacheSnapshotMaxAge = 200
+	})
+}
+
+func TestCacheSnapshot_StaleResourceNotValidAgainstSchema_SendsGetRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"resources":{"test.model":{"result":{"model":{"string":42,"int":42,"bool":true,"null":null}}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		s.AssertErrorsLogged(t, 1)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_schema_violations_total{service="test"} 1`,
+		})
+	}, func(cfg *server.Config) {
+		cfg.CacheSnapshot = path
+	}, resourceSchemaConfig("test.model", `{"properties":{"string":{"type":"string"}}}`))
+}
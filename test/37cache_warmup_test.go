@@ -0,0 +1,111 @@
+// Tests for cache warm-up and pinning of configured resources
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func TestCacheWarmUp_ResourceID_FetchedOnStart(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		c := s.Connect()
+		subscribeToCachedResource(t, s, c, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+	})
+}
+
+func TestCacheWarmUp_SubscribeWhileFetching_LoadsOnResponse(t *testing.T) {
+	runTest(t, func(s *Session) {
+		req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		req.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+	})
+}
+
+func TestCacheWarmUp_ResourcePattern_PinsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+
+		// Resource is still cached
+		subscribeToCachedResource(t, s, c, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.*"}
+		cfg.NoUnsubscribeDelay = true
+	})
+}
+
+func TestCacheWarmUp_GetError_LogsErrorAndFetchesOnSubscribe(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondError(reserr.ErrInternalError)
+
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		s.AssertErrorsLogged(t, 1)
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+	})
+}
+
+func TestCacheWarmUp_GetError_RetriesGetRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondError(reserr.ErrInternalError)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		c := s.Connect()
+		subscribeToCachedResource(t, s, c, "test.model")
+		s.AssertErrorsLogged(t, 1)
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+	})
+}
+
+func TestCacheWarmUp_StaleSnapshotResource_LoadedAndRevalidated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	err := os.WriteFile(path, []byte(`{"resources":{"test.model":{"result":{"model":`+resourceData("test.model")+`}}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runTest(t, func(s *Session) {
+		// Revalidation of the stale resource
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"bar","int":42,"bool":true,"null":null}}}`))
+	}, func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+		cfg.CacheSnapshot = path
+	})
+}
@@ -0,0 +1,76 @@
+// Tests for per-pattern cache retention rules
+package test
+
+import (
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func TestCacheRetention_ZeroDelay_UnsubscribesDirectly(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertUnsubscribe("test.model")
+	}, func(cfg *server.Config) {
+		cfg.CacheRetention = []server.CacheRetentionRule{
+			{Pattern: "test.model", Delay: 0},
+		}
+	})
+}
+
+func TestCacheRetention_Delay_KeepsResourceUntilDelayExpires(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		// Resource is still cached
+		subscribeToCachedResource(t, s, c, "test.model")
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertUnsubscribe("test.model")
+	}, func(cfg *server.Config) {
+		cfg.NoUnsubscribeDelay = true
+		cfg.CacheRetention = []server.CacheRetentionRule{
+			{Pattern: "test.*", Delay: 200},
+		}
+	})
+}
+
+func TestCacheRetention_Pin_KeepsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		// Resource is still cached
+		subscribeToCachedResource(t, s, c, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.NoUnsubscribeDelay = true
+		cfg.CacheRetention = []server.CacheRetentionRule{
+			{Pattern: "test.>", Pin: true},
+		}
+	})
+}
+
+func TestCacheRetention_MultipleMatchingRules_AppliesFirstRule(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		subscribeToTestCollection(t, s, c)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		c.Request("unsubscribe.test.collection", nil).GetResponse(t)
+		s.AssertUnsubscribe("test.collection")
+		// Pinned resource is still cached
+		subscribeToCachedResource(t, s, c, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.CacheRetention = []server.CacheRetentionRule{
+			{Pattern: "test.model", Pin: true},
+			{Pattern: "test.>", Delay: 0},
+		}
+	})
+}
@@ -0,0 +1,140 @@
+// Tests for prioritized system reset and reset metrics
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func TestResetPriority_WithThrottle_ResetsResourcesWithMostSubscribersFirst(t *testing.T) {
+	// Number of connections subscribing to each resource
+	subscribers := []int{1, 3, 2, 4}
+	runTest(t, func(s *Session) {
+		conns := make([]*Conn, 4)
+		for i := range conns {
+			conns[i] = s.Connect()
+		}
+		for i, n := range subscribers {
+			rid := fmt.Sprintf("test.model.%d", i+1)
+			rsrc := resource{typ: typeModel, data: fmt.Sprintf(`{"id":%d}`, i+1)}
+			subscribeToCustomResource(t, s, conns[0], rid, rsrc)
+			for _, c := range conns[1:n] {
+				subscribeToCustomResourceExt(t, s, c, rid, rsrc, true)
+			}
+		}
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		req := s.GetRequest(t)
+		// Flush out any queued reset requests
+		for i := range subscribers {
+			conns[0].AssertNoNATSRequest(t, fmt.Sprintf("test.model.%d", i+1))
+		}
+		first := req.Subject[strings.LastIndexByte(req.Subject, '.')+1:]
+		req.RespondSuccess(json.RawMessage(`{"model":{"id":` + first + `}}`))
+
+		// Remaining resources are reset in order of subscribers
+		for _, id := range []string{"4", "2", "3", "1"} {
+			if id == first {
+				continue
+			}
+			s.GetRequest(t).
+				AssertSubject(t, "get.test.model."+id).
+				RespondSuccess(json.RawMessage(`{"model":{"id":` + id + `}}`))
+		}
+	}, func(cfg *server.Config) {
+		cfg.ResetThrottle = 1
+		cfg.ResetPriority = true
+	})
+}
+
+func TestResetPriority_WithThrottle_PrioritizesQueryResourcesBySubscribers(t *testing.T) {
+	queries := []string{"q=a", "q=b", "q=c"}
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		c2 := s.Connect()
+		// Three query resources on test.model with a single subscriber each
+		for _, q := range queries {
+			subscribeToTestQueryModel(t, s, c1, q, q)
+		}
+		// A collection with two subscribers
+		subscribeToTestCollection(t, s, c1)
+		subscribeToCachedResource(t, s, c2, "test.collection")
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		req := s.GetRequest(t)
+		// Flush out any queued reset requests
+		c1.AssertNoNATSRequest(t, "test.model")
+		c1.AssertNoNATSRequest(t, "test.collection")
+
+		respond := func(req *Request) {
+			if req.Subject == "get.test.collection" {
+				req.RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+				return
+			}
+			q := req.PathPayload(t, "query").(string)
+			req.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `,"query":"` + q + `"}`))
+		}
+		collectionReset := req.Subject == "get.test.collection"
+		respond(req)
+
+		// The collection is reset before the remaining query resources, as it
+		// has more subscribers than each query resource.
+		if !collectionReset {
+			req = s.GetRequest(t).AssertSubject(t, "get.test.collection")
+			respond(req)
+		}
+		for i := len(queries) - 1; i > 0; i-- {
+			respond(s.GetRequest(t).AssertSubject(t, "get.test.model"))
+		}
+	}, func(cfg *server.Config) {
+		cfg.ResetThrottle = 1
+		cfg.ResetPriority = true
+	})
+}
+
+func TestResetPriority_SubscribeWhileResetting_ServesCachedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+
+		c2 := s.Connect()
+		subscribeToCachedResource(t, s, c2, "test.model")
+
+		req.RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	}, func(cfg *server.Config) {
+		cfg.ResetThrottle = 1
+		cfg.ResetPriority = true
+	})
+}
+
+func TestResetMetrics_SystemReset_ExposesResetProgress(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_resets_pending 1`,
+			`resgate_cache_resets_total 0`,
+		})
+
+		req.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		c.AssertNoEvent(t, "test.model")
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_resets_pending 0`,
+			`resgate_cache_resets_total 1`,
+		})
+	}, func(cfg *server.Config) {
+		cfg.MetricsPort = 8090
+	})
+}
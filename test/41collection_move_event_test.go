@@ -0,0 +1,129 @@
+// Tests for collection move events
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// Test that a move event is forwarded to clients supporting it, and that the
+// cached collection is updated.
+func TestCollectionMoveEvent_LatestClient_ForwardsEvent(t *testing.T) {
+	tbl := []struct {
+		From     int
+		To       int
+		Expected string
+	}{
+		{0, 3, `[42,true,null,"foo"]`},
+		{3, 0, `[null,"foo",42,true]`},
+		{1, 2, `["foo",true,42,null]`},
+		{2, 1, `["foo",true,42,null]`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToTestCollection(t, s, c)
+
+			payload := json.RawMessage(fmt.Sprintf(`{"from":%d,"to":%d}`, l.From, l.To))
+			s.ResourceEvent("test.collection", "move", payload)
+			c.GetEvent(t).Equals(t, "test.collection.move", payload)
+
+			// Validate the cached collection is updated
+			c2 := s.Connect()
+			creq := c2.Request("subscribe.test.collection", nil)
+			s.GetRequest(t).AssertSubject(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+l.Expected+`}}`))
+		})
+	}
+}
+
+// Test that a move event is sent as a remove and add event to clients on
+// protocol versions not supporting move events.
+func TestCollectionMoveEvent_OlderClient_SendsRemoveAndAddEvents(t *testing.T) {
+	for _, version := range []string{"", "1.2.3"} {
+		runNamedTest(t, "version "+version, func(s *Session) {
+			var c *Conn
+			if version == "" {
+				c = s.ConnectWithoutVersion()
+			} else {
+				c = s.ConnectWithVersion(version)
+			}
+			subscribeToTestCollection(t, s, c)
+
+			s.ResourceEvent("test.collection", "move", json.RawMessage(`{"from":0,"to":2}`))
+			c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+			c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":2,"value":"foo"}`))
+		})
+	}
+}
+
+// Test that moving a resource reference keeps the referenced resource
+// subscribed without any new requests.
+func TestCollectionMoveEvent_ResourceReference_KeepsReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollectionParent(t, s, c, false)
+
+		payload := json.RawMessage(`{"from":1,"to":0}`)
+		s.ResourceEvent("test.collection.parent", "move", payload)
+		c.GetEvent(t).Equals(t, "test.collection.parent.move", payload)
+		c.AssertNoNATSRequest(t, "test.collection")
+
+		// Validate the referenced resource is still subscribed
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+	})
+}
+
+// Test that moving a resource reference for an older client sends the
+// referenced resource with the add event, as it is removed by the preceding
+// remove event.
+func TestCollectionMoveEvent_ResourceReferenceOnOlderClient_SendsRemoveAndAddEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithVersion("1.2.3")
+		subscribeToTestCollectionParent(t, s, c, false)
+
+		s.ResourceEvent("test.collection.parent", "move", json.RawMessage(`{"from":1,"to":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.remove", json.RawMessage(`{"idx":1}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.add", json.RawMessage(`{"idx":0,"value":{"rid":"test.collection"},"collections":{"test.collection":["foo",42,true,null]}}`))
+	})
+}
+
+// Test that invalid move events are discarded and logged.
+func TestCollectionMoveEvent_InvalidEvent_LogsError(t *testing.T) {
+	tbl := []struct {
+		RID     string
+		Payload string
+	}{
+		{"test.collection", `{"from":4,"to":0}`},
+		{"test.collection", `{"from":0,"to":4}`},
+		{"test.collection", `{"from":-1,"to":0}`},
+		{"test.collection", `{"from":0,"to":-1}`},
+		{"test.collection", `{"from":"0","to":1}`},
+		{"test.model", `{"from":0,"to":1}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToResource(t, s, c, l.RID)
+
+			s.ResourceEvent(l.RID, "move", json.RawMessage(l.Payload))
+			c.AssertNoEvent(t, l.RID)
+			s.AssertErrorsLogged(t, 1)
+		})
+	}
+}
+
+// Test that a move event to the same index is discarded.
+func TestCollectionMoveEvent_SameIndex_DiscardsEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.collection", "move", json.RawMessage(`{"from":1,"to":1}`))
+		c.AssertNoEvent(t, "test.collection")
+	})
+}
@@ -0,0 +1,89 @@
+// Tests for patch values in model change events
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// Test that a patch value is applied to the cached data value, and forwarded
+// to clients as a patch value or as a data value, depending on protocol
+// version.
+func TestDataValuePatch_ChangeEvent_SendsValueByProtocolVersion(t *testing.T) {
+	tbl := []struct {
+		Version  string
+		Expected string
+	}{
+		{"1.999.999", `{"values":{"object":{"patch":{"foo":null,"bar":true}}}}`},
+		{"1.2.4", `{"values":{"object":{"patch":{"foo":null,"bar":true}}}}`},
+		{"1.2.3", `{"values":{"object":{"data":{"bar":true}}}}`},
+		{"1.2.0", `{"values":{"object":"[Data]"}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.ConnectWithVersion(l.Version)
+			subscribeToResource(t, s, c, "test.model.data")
+
+			s.ResourceEvent("test.model.data", "change", json.RawMessage(`{"values":{"object":{"patch":{"foo":null,"bar":true}}}}`))
+			c.GetEvent(t).Equals(t, "test.model.data.change", json.RawMessage(l.Expected))
+
+			// Validate the cached data value is patched
+			c2 := s.Connect()
+			creq := c2.Request("subscribe.test.model.data", nil)
+			s.GetRequest(t).AssertSubject(t, "access.test.model.data").RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.data":{"name":"data","primitive":12,"object":{"data":{"bar":true}},"array":{"data":[{"foo":"bar"}]}}}}`))
+		})
+	}
+}
+
+// Test that patch values are combined with other changed values.
+func TestDataValuePatch_ChangeEventWithOtherValues_SendsAllValues(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToResource(t, s, c, "test.model.data")
+
+		s.ResourceEvent("test.model.data", "change", json.RawMessage(`{"values":{"name":"patched","array":{"patch":{"foo":"baz"}}}}`))
+		c.GetEvent(t).Equals(t, "test.model.data.change", json.RawMessage(`{"values":{"name":"patched","array":{"patch":{"foo":"baz"}}}}`))
+	})
+}
+
+// Test that a patch value not causing any change is discarded.
+func TestDataValuePatch_NoChange_DiscardsEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToResource(t, s, c, "test.model.data")
+
+		s.ResourceEvent("test.model.data", "change", json.RawMessage(`{"values":{"object":{"patch":{"foo":["bar"],"baz":null}}}}`))
+		c.AssertNoEvent(t, "test.model.data")
+	})
+}
+
+// Test that a patch value on a property not containing a data value is
+// discarded and logged.
+func TestDataValuePatch_OnNonDataValue_LogsError(t *testing.T) {
+	for _, prop := range []string{"name", "primitive", "missing"} {
+		runNamedTest(t, prop, func(s *Session) {
+			c := s.Connect()
+			subscribeToResource(t, s, c, "test.model.data")
+
+			s.ResourceEvent("test.model.data", "change", json.RawMessage(`{"values":{"`+prop+`":{"patch":{"foo":"bar"}}}}`))
+			c.AssertNoEvent(t, "test.model.data")
+			s.AssertErrorsLogged(t, 1)
+		})
+	}
+}
+
+// Test that a patch value in a get response is treated as an invalid
+// response.
+func TestDataValuePatch_InGetResponse_ReturnsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":{"patch":{"bar":true}}}}`))
+		creq.GetResponse(t).AssertIsError(t)
+	})
+}
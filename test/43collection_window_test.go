@@ -0,0 +1,288 @@
+// Tests for windowed collection subscriptions
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// subscribeToWindow makes a successful windowed subscription to a
+// collection, not yet cached, and without resource references.
+func subscribeToWindow(t *testing.T, s *Session, c *Conn, rid string, window string, expected string) {
+	creq := c.Request("subscribe."+rid, json.RawMessage(window))
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get."+rid).RespondSuccess(json.RawMessage(`{"collection":` + resourceData(rid) + `}`))
+	creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"`+rid+`":`+expected+`}}`))
+}
+
+func TestCollectionWindow_Subscribe_ReturnsWindow(t *testing.T) {
+	tbl := []struct {
+		Window   string
+		Expected string
+	}{
+		{`{"limit":2}`, `["foo",42]`},
+		{`{"offset":0,"limit":4}`, `["foo",42,true,null]`},
+		{`{"offset":1,"limit":2}`, `[42,true]`},
+		{`{"offset":2,"limit":10}`, `[true,null]`},
+		{`{"offset":4,"limit":2}`, `[]`},
+		{`{"offset":10,"limit":2}`, `[]`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToWindow(t, s, c, "test.collection", l.Window, l.Expected)
+		})
+	}
+}
+
+func TestCollectionWindow_CollectionEvent_SendsWindowEvents(t *testing.T) {
+	type event struct {
+		Event string
+		Data  string
+	}
+	// Collection: ["foo",42,true,null], Window: [42,true]
+	tbl := []struct {
+		Event    string
+		Payload  string
+		Expected []event
+	}{
+		{"add", `{"idx":0,"value":"a"}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":0,"value":"foo"}`}}},
+		{"add", `{"idx":1,"value":"a"}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":0,"value":"a"}`}}},
+		{"add", `{"idx":2,"value":"a"}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":1,"value":"a"}`}}},
+		{"add", `{"idx":3,"value":"a"}`, nil},
+		{"add", `{"idx":4,"value":"a"}`, nil},
+		{"remove", `{"idx":0}`, []event{{"remove", `{"idx":0}`}, {"add", `{"idx":1,"value":null}`}}},
+		{"remove", `{"idx":1}`, []event{{"remove", `{"idx":0}`}, {"add", `{"idx":1,"value":null}`}}},
+		{"remove", `{"idx":2}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":1,"value":null}`}}},
+		{"remove", `{"idx":3}`, nil},
+		{"move", `{"from":1,"to":2}`, []event{{"move", `{"from":0,"to":1}`}}},
+		{"move", `{"from":0,"to":3}`, []event{{"remove", `{"idx":0}`}, {"add", `{"idx":1,"value":null}`}}},
+		{"move", `{"from":3,"to":0}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":0,"value":"foo"}`}}},
+		{"move", `{"from":0,"to":1}`, []event{{"remove", `{"idx":0}`}, {"add", `{"idx":0,"value":"foo"}`}}},
+		{"move", `{"from":0,"to":2}`, []event{{"remove", `{"idx":0}`}, {"add", `{"idx":1,"value":"foo"}`}}},
+		{"move", `{"from":2,"to":3}`, []event{{"remove", `{"idx":1}`}, {"add", `{"idx":1,"value":null}`}}},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToWindow(t, s, c, "test.collection", `{"offset":1,"limit":2}`, `[42,true]`)
+
+			s.ResourceEvent("test.collection", l.Event, json.RawMessage(l.Payload))
+			for _, ev := range l.Expected {
+				c.GetEvent(t).Equals(t, "test.collection."+ev.Event, json.RawMessage(ev.Data))
+			}
+			c.AssertNoEvent(t, "test.collection")
+		})
+	}
+}
+
+func TestCollectionWindow_RandomEvents_WindowMatchesCollection(t *testing.T) {
+	const offset, limit = 3, 4
+	rnd := rand.New(rand.NewSource(1))
+	runTest(t, func(s *Session) {
+		collection := []int{0, 1, 2, 3, 4, 5, 6, 7}
+		next := len(collection)
+		data, _ := json.Marshal(collection)
+
+		c := s.Connect()
+		creq := c.Request("subscribe.test.collection", json.RawMessage(fmt.Sprintf(`{"offset":%d,"limit":%d}`, offset, limit)))
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + string(data) + `}`))
+		var window []int
+		data, _ = json.Marshal(collection[offset : offset+limit])
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+string(data)+`}}`))
+		window = append(window, collection[offset:offset+limit]...)
+
+		for i := 0; i < 200; i++ {
+			l := len(collection)
+			var ev string
+			var payload interface{}
+			switch r := rnd.Intn(3); {
+			case r == 0 || l < 2:
+				idx := rnd.Intn(l + 1)
+				ev, payload = "add", map[string]int{"idx": idx, "value": next}
+				collection = append(collection[:idx], append([]int{next}, collection[idx:]...)...)
+				next++
+			case r == 1 && l > 4:
+				idx := rnd.Intn(l)
+				ev, payload = "remove", map[string]int{"idx": idx}
+				collection = append(collection[:idx], collection[idx+1:]...)
+			default:
+				from, to := rnd.Intn(l), rnd.Intn(l-1)
+				if to >= from {
+					to++
+				}
+				ev, payload = "move", map[string]int{"from": from, "to": to}
+				v := collection[from]
+				collection = append(collection[:from], collection[from+1:]...)
+				collection = append(collection[:to], append([]int{v}, collection[to:]...)...)
+			}
+			data, _ := json.Marshal(payload)
+			s.ResourceEvent("test.collection", ev, data)
+
+			// Flush out events by sending an auth request, in the same way
+			// as AssertNoEvent.
+			creq := c.Request("auth.test.collection.flush", nil)
+			s.GetRequest(t).AssertSubject(t, "auth.test.collection.flush").RespondSuccess(nil)
+			creq.GetResponse(t)
+
+			// Apply client events to the window
+		Events:
+			for {
+				var cev *ClientEvent
+				select {
+				case cev = <-c.evs:
+				default:
+					break Events
+				}
+				var p struct {
+					Idx   int `json:"idx"`
+					Value int `json:"value"`
+					From  int `json:"from"`
+					To    int `json:"to"`
+				}
+				b, _ := json.Marshal(cev.Data)
+				if err := json.Unmarshal(b, &p); err != nil {
+					t.Fatalf("error unmarshaling event data: %s", err)
+				}
+				switch cev.Event {
+				case "test.collection.add":
+					window = append(window[:p.Idx], append([]int{p.Value}, window[p.Idx:]...)...)
+				case "test.collection.remove":
+					window = append(window[:p.Idx], window[p.Idx+1:]...)
+				case "test.collection.move":
+					v := window[p.From]
+					window = append(window[:p.From], window[p.From+1:]...)
+					window = append(window[:p.To], append([]int{v}, window[p.To:]...)...)
+				default:
+					t.Fatalf("unexpected event %s", cev.Event)
+				}
+			}
+
+			end := offset + limit
+			if end > len(collection) {
+				end = len(collection)
+			}
+			expected := []int{}
+			if offset < end {
+				expected = collection[offset:end]
+			}
+			if !reflect.DeepEqual(append([]int{}, window...), append([]int{}, expected...)) {
+				t.Fatalf("event #%d %s %s: expected window %v, but got %v", i+1, ev, data, expected, window)
+			}
+		}
+	})
+}
+
+func TestCollectionWindow_ResourceReferenceOutsideWindow_NotSubscribed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToWindow(t, s, c, "test.collection.parent", `{"limit":1}`, `["parent"]`)
+		c.AssertNoNATSRequest(t, "test.collection")
+
+		// Removing the first value pulls the reference into the window
+		s.ResourceEvent("test.collection.parent", "remove", json.RawMessage(`{"idx":0}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.collection").
+			RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.add", json.RawMessage(`{"idx":0,"value":{"rid":"test.collection"},"collections":{"test.collection":["foo",42,true,null]}}`))
+
+		// Adding a value prior to the window pushes the reference out
+		s.ResourceEvent("test.collection.parent", "add", json.RawMessage(`{"idx":0,"value":"parent"}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.parent.add", json.RawMessage(`{"idx":0,"value":"parent"}`))
+		c.AssertNoEvent(t, "test.collection")
+	})
+}
+
+func TestCollectionWindow_OlderClient_TranslatesMoveEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithVersion("1.2.3")
+		subscribeToWindow(t, s, c, "test.collection", `{"offset":1,"limit":2}`, `[42,true]`)
+
+		s.ResourceEvent("test.collection", "move", json.RawMessage(`{"from":1,"to":2}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":42}`))
+	})
+}
+
+func TestCollectionWindow_InvalidParams_ReturnsError(t *testing.T) {
+	tbl := []string{
+		`{"limit":0}`,
+		`{"limit":-1}`,
+		`{"offset":-1,"limit":2}`,
+		`{"offset":1}`,
+		`{"limit":"2"}`,
+		`"foo"`,
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			c.Request("subscribe.test.collection", json.RawMessage(l)).
+				GetResponse(t).
+				AssertError(t, reserr.ErrInvalidParams)
+		})
+	}
+}
+
+func TestCollectionWindow_SubscribeWithMatchingWindow_ReturnsCachedWindow(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToWindow(t, s, c, "test.collection", `{"offset":1,"limit":2}`, `[42,true]`)
+
+		c.Request("subscribe.test.collection", json.RawMessage(`{"offset":1,"limit":2}`)).
+			GetResponse(t).
+			AssertResult(t, json.RawMessage(`{}`))
+	})
+}
+
+func TestCollectionWindow_SubscribeWithDifferentWindow_ReturnsError(t *testing.T) {
+	tbl := []struct {
+		First  string
+		Second string
+	}{
+		{`{"offset":1,"limit":2}`, `{"offset":0,"limit":2}`},
+		{`{"offset":1,"limit":2}`, `{"offset":1,"limit":3}`},
+		{`{"offset":1,"limit":2}`, `null`},
+		{`null`, `{"offset":1,"limit":2}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			var expected string
+			if l.First == "null" {
+				expected = resourceData("test.collection")
+			} else {
+				expected = `[42,true]`
+			}
+			subscribeToWindow(t, s, c, "test.collection", l.First, expected)
+
+			c.Request("subscribe.test.collection", json.RawMessage(l.Second)).
+				GetResponse(t).
+				AssertErrorCode(t, reserr.CodeInvalidParams)
+		})
+	}
+}
+
+func TestCollectionWindow_OnModel_ReturnsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", json.RawMessage(`{"limit":2}`))
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertErrorCode(t, reserr.CodeInvalidParams)
+	})
+}
@@ -0,0 +1,153 @@
+// Tests for projected model subscriptions
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// subscribeToProjection makes a successful projected subscription to a
+// model, not yet cached.
+func subscribeToProjection(t *testing.T, s *Session, c *Conn, rid string, fields string) *ClientResponse {
+	creq := c.Request("subscribe."+rid, json.RawMessage(`{"fields":`+fields+`}`))
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get."+rid).RespondSuccess(json.RawMessage(`{"model":` + resourceData(rid) + `}`))
+	return creq.GetResponse(t)
+}
+
+func TestModelProjection_Subscribe_ReturnsSelectedProperties(t *testing.T) {
+	tbl := []struct {
+		Fields   string
+		Expected string
+	}{
+		{`["string"]`, `{"string":"foo"}`},
+		{`["int","bool"]`, `{"int":42,"bool":true}`},
+		{`["null","missing"]`, `{"null":null}`},
+		{`["missing"]`, `{}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToProjection(t, s, c, "test.model", l.Fields).
+				AssertResult(t, json.RawMessage(`{"models":{"test.model":`+l.Expected+`}}`))
+		})
+	}
+}
+
+func TestModelProjection_ChangeEvent_SendsSelectedProperties(t *testing.T) {
+	tbl := []struct {
+		Payload  string
+		Expected string
+	}{
+		{`{"values":{"string":"bar","int":12}}`, `{"values":{"string":"bar"}}`},
+		{`{"values":{"string":"bar","bool":{"action":"delete"}}}`, `{"values":{"string":"bar","bool":{"action":"delete"}}}`},
+		{`{"values":{"int":12}}`, ``},
+		{`{"values":{"new":12}}`, ``},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToProjection(t, s, c, "test.model", `["string","bool"]`).
+				AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"foo","bool":true}}}`))
+
+			s.ResourceEvent("test.model", "change", json.RawMessage(l.Payload))
+			if l.Expected != "" {
+				c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(l.Expected))
+			}
+			c.AssertNoEvent(t, "test.model")
+		})
+	}
+}
+
+func TestModelProjection_ResourceReferenceNotSelected_NotSubscribed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToProjection(t, s, c, "test.model.parent", `["name"]`).
+			AssertResult(t, json.RawMessage(`{"models":{"test.model.parent":{"name":"parent"}}}`))
+		c.AssertNoNATSRequest(t, "test.model")
+
+		// Changing the unselected reference is not followed
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"child":{"rid":"test.model.soft"}}}`))
+		c.AssertNoEvent(t, "test.model.parent")
+		c.AssertNoNATSRequest(t, "test.model.soft")
+	})
+}
+
+func TestModelProjection_ResourceReferenceSelected_Subscribed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", json.RawMessage(`{"fields":["child"]}`))
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`,"test.model.parent":{"child":{"rid":"test.model"}}}}`))
+	})
+}
+
+func TestModelProjection_InvalidParams_ReturnsError(t *testing.T) {
+	tbl := []string{
+		`{"fields":[]}`,
+		`{"fields":"string"}`,
+		`{"fields":[12]}`,
+		`{"fields":["string"],"limit":2}`,
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			c.Request("subscribe.test.model", json.RawMessage(l)).
+				GetResponse(t).
+				AssertError(t, reserr.ErrInvalidParams)
+		})
+	}
+}
+
+func TestModelProjection_SubscribeWithDifferentFields_ReturnsError(t *testing.T) {
+	tbl := []struct {
+		First    string
+		Expected string
+		Second   string
+		Success  bool
+	}{
+		{`["string","int"]`, `{"string":"foo","int":42}`, `["int","string"]`, true},
+		{`["string","int"]`, `{"string":"foo","int":42}`, `["string","int","string"]`, true},
+		{`["string","int"]`, `{"string":"foo","int":42}`, `["string"]`, false},
+		{`["string"]`, `{"string":"foo"}`, `["string","int"]`, false},
+		{`["string"]`, `{"string":"foo"}`, `null`, false},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToProjection(t, s, c, "test.model", l.First).
+				AssertResult(t, json.RawMessage(`{"models":{"test.model":`+l.Expected+`}}`))
+
+			cresp := c.Request("subscribe.test.model", json.RawMessage(`{"fields":`+l.Second+`}`)).GetResponse(t)
+			if l.Success {
+				cresp.AssertResult(t, json.RawMessage(`{}`))
+			} else {
+				cresp.AssertErrorCode(t, reserr.CodeInvalidParams)
+			}
+		})
+	}
+}
+
+func TestModelProjection_OnCollection_ReturnsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.collection", json.RawMessage(`{"fields":["foo"]}`))
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+		creq.GetResponse(t).AssertErrorCode(t, reserr.CodeInvalidParams)
+	})
+}
@@ -0,0 +1,378 @@
+// Tests for forwarding resource events to webhooks
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/webhook"
+)
+
+// webhookRequest is a request received by a webhookReceiver.
+type webhookRequest struct {
+	Header  http.Header
+	Body    []byte
+	Payload webhook.Payload
+}
+
+// webhookReceiver is an HTTP server receiving webhook requests. It responds
+// with the queued status codes, or 200 OK once the queue is empty.
+type webhookReceiver struct {
+	*httptest.Server
+	reqs     chan *webhookRequest
+	statuses chan int
+}
+
+func newWebhookReceiver(statuses ...int) *webhookReceiver {
+	wr := &webhookReceiver{
+		reqs:     make(chan *webhookRequest, 32),
+		statuses: make(chan int, len(statuses)),
+	}
+	for _, st := range statuses {
+		wr.statuses <- st
+	}
+	wr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &webhookRequest{Header: r.Header, Body: body}
+		_ = json.Unmarshal(body, &req.Payload)
+		status := http.StatusOK
+		select {
+		case status = <-wr.statuses:
+		default:
+		}
+		w.WriteHeader(status)
+		wr.reqs <- req
+	}))
+	return wr
+}
+
+func (wr *webhookReceiver) GetRequest(t *testing.T) *webhookRequest {
+	select {
+	case req := <-wr.reqs:
+		return req
+	case <-time.After(timeoutSeconds * time.Second):
+		t.Fatal("expected a webhook request but found none")
+	}
+	return nil
+}
+
+func (wr *webhookReceiver) AssertNoRequest(t *testing.T) {
+	select {
+	case req := <-wr.reqs:
+		t.Fatalf("expected no webhook request, but got %s", req.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (req *webhookRequest) AssertEvent(t *testing.T, rid string, event string, data json.RawMessage) *webhookRequest {
+	if req.Payload.Resource != rid || req.Payload.Event != event {
+		t.Fatalf("expected %s event on %s, but got %s event on %s", event, rid, req.Payload.Event, req.Payload.Resource)
+	}
+	if req.Header.Get(webhook.HeaderEvent) != event || req.Header.Get(webhook.HeaderResource) != rid {
+		t.Fatalf("expected event headers %s and %s, but got %s and %s", event, rid, req.Header.Get(webhook.HeaderEvent), req.Header.Get(webhook.HeaderResource))
+	}
+	if req.Header.Get(webhook.HeaderDelivery) != req.Payload.ID {
+		t.Fatalf("expected delivery header %s, but got %s", req.Payload.ID, req.Header.Get(webhook.HeaderDelivery))
+	}
+	AssertEqualJSON(t, "data", req.Payload.Data, data)
+	return req
+}
+
+func webhookConfig(wr *webhookReceiver, resources []string, cb func(w *server.WebhookConfig)) func(*server.Config) {
+	return func(cfg *server.Config) {
+		w := server.WebhookConfig{
+			URL:        wr.URL,
+			Resources:  resources,
+			RetryDelay: 1,
+		}
+		if cb != nil {
+			cb(&w)
+		}
+		cfg.Webhooks = append(cfg.Webhooks, w)
+	}
+}
+
+func TestWebhook_ModelChangeEvent_IsPostedWithSignature(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar","int":-12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar","int":-12}}`))
+
+		req := wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar","int":-12}}`))
+		ts := req.Header.Get(webhook.HeaderTimestamp)
+		if sig := req.Header.Get(webhook.HeaderSignature); sig != webhook.Sign("secret", ts, req.Body) {
+			t.Fatalf("expected signature %s, but got %s", webhook.Sign("secret", ts, req.Body), sig)
+		}
+		if ct := req.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected content type application/json, but got %s", ct)
+		}
+	}, webhookConfig(wr, []string{"test.>"}, func(w *server.WebhookConfig) {
+		w.Secret = "secret"
+	}))
+}
+
+func TestWebhook_CollectionEvents_ArePostedInOrder(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		s.ResourceEvent("test.collection", "delete", nil)
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.delete", nil)
+
+		wr.GetRequest(t).AssertEvent(t, "test.collection", "add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		wr.GetRequest(t).AssertEvent(t, "test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		wr.GetRequest(t).AssertEvent(t, "test.collection", "delete", nil)
+	}, webhookConfig(wr, []string{"*.collection"}, nil))
+}
+
+func TestWebhook_NonMatchingResourceOrEvent_IsNotPosted(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+
+		wr.GetRequest(t).AssertEvent(t, "test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		wr.AssertNoRequest(t)
+	}, webhookConfig(wr, []string{"*.collection"}, func(w *server.WebhookConfig) {
+		w.Events = []string{"remove"}
+	}))
+}
+
+func TestWebhook_WarmedUpResource_EventIsPosted(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		// Wait for the get response to be handled
+		c := s.Connect()
+		subscribeToCachedResource(t, s, c, "test.model")
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	}, webhookConfig(wr, []string{"test.model"}, nil), func(cfg *server.Config) {
+		cfg.CacheWarmUp = []string{"test.model"}
+	})
+}
+
+func TestWebhook_UnsubscribedResource_IsNotKeptInCache(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertUnsubscribe("test.model")
+		s.NoSubscriptions(t, "test.model")
+	}, webhookConfig(wr, []string{"test.*"}, nil), func(cfg *server.Config) {
+		cfg.NoUnsubscribeDelay = true
+	})
+}
+
+func TestWebhook_OverlappingPatterns_EventIsPostedOnce(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		wr.AssertNoRequest(t)
+	}, webhookConfig(wr, []string{"test.>", "*.model", "test.model"}, nil))
+}
+
+func TestWebhook_LegacyChangeEvent_IsPostedInCurrentFormat(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"string":"bar","int":-12}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar","int":-12}}`))
+		// Deprecation warning
+		s.AssertErrorsLogged(t, 1)
+	}, webhookConfig(wr, []string{"test.model"}, nil))
+}
+
+func TestWebhook_ChangeEvent_IsPostedWithAppliedValues(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Unchanged values are not included, and an event without changes is
+		// not posted.
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"foo","int":42}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar","int":42}}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		wr.AssertNoRequest(t)
+	}, webhookConfig(wr, []string{"test.model"}, nil))
+}
+
+func TestWebhook_QueryResourceEvent_IsPosted(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestQueryModel(t, s, c, "q=foo", "q=foo")
+
+		s.ResourceEvent("test.model", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`))
+		s.GetRequest(t).
+			Equals(t, "_EVENT_01_", json.RawMessage(`{"query":"q=foo"}`)).
+			RespondSuccess(json.RawMessage(`{"events":[{"event":"change","data":{"values":{"string":"bar"}}}]}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model?q=foo", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	}, webhookConfig(wr, []string{"test.model"}, nil))
+}
+
+func TestWebhook_SystemReset_DerivedEventIsPosted(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	}, webhookConfig(wr, []string{"test.model"}, nil))
+}
+
+func TestWebhook_InvalidEvent_IsNotPosted(t *testing.T) {
+	wr := newWebhookReceiver()
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Event discarded by schema validation
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":"foo"}}`))
+		// Duplicate sequenced event
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12},"seq":1}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":13},"seq":1}`))
+		wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		wr.AssertNoRequest(t)
+		s.AssertErrorsLogged(t, 1)
+	}, webhookConfig(wr, []string{"test.model"}, nil), resourceSchemaConfig("test.model", `{"properties":{"int":{"type":"integer"}}}`))
+}
+
+func TestWebhook_ServerError_IsRetried(t *testing.T) {
+	wr := newWebhookReceiver(http.StatusInternalServerError, http.StatusTooManyRequests)
+	defer wr.Close()
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+
+		id := wr.GetRequest(t).AssertEvent(t, "test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`)).Payload.ID
+		for i := 0; i < 2; i++ {
+			if req := wr.GetRequest(t); req.Payload.ID != id {
+				t.Fatalf("expected retry of delivery %s, but got %s", id, req.Payload.ID)
+			}
+		}
+		wr.AssertNoRequest(t)
+	}, webhookConfig(wr, []string{"test.>"}, nil))
+}
+
+func TestWebhook_DeliveryFailure_IsAddedToDeadLetter(t *testing.T) {
+	wr := newWebhookReceiver(http.StatusInternalServerError, http.StatusBadRequest, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer wr.Close()
+	deadLetter := filepath.Join(t.TempDir(), "deadletter.log")
+	maxRetries := 1
+
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// First event fails on a non-retryable status after one retry
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		// Second event fails after max retries
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":-12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":-12}}`))
+
+		for i := 0; i < 4; i++ {
+			wr.GetRequest(t)
+		}
+		wr.AssertNoRequest(t)
+
+		var lines []string
+		for i := 0; i < 100; i++ {
+			b, _ := os.ReadFile(deadLetter)
+			lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+			if len(lines) == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 dead letter entries, but got %d", len(lines))
+		}
+		for i, data := range []string{`{"values":{"string":"bar"}}`, `{"values":{"int":-12}}`} {
+			var entry webhook.DeadLetterEntry
+			var p webhook.Payload
+			if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(entry.Payload, &p); err != nil {
+				t.Fatal(err)
+			}
+			if entry.URL != wr.URL {
+				t.Fatalf("expected dead letter url %s, but got %s", wr.URL, entry.URL)
+			}
+			AssertEqualJSON(t, "dead letter data", p.Data, json.RawMessage(data))
+		}
+		s.AssertErrorsLogged(t, 2)
+	}, webhookConfig(wr, []string{"test.>"}, func(w *server.WebhookConfig) {
+		w.MaxRetries = &maxRetries
+	}), func(cfg *server.Config) {
+		cfg.WebhookDeadLetter = deadLetter
+	})
+}
@@ -0,0 +1,277 @@
+// Tests for the GraphQL endpoint
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/posener/wstest"
+	"github.com/resgateio/resgate/server"
+)
+
+const graphqlPath = "/graphql"
+
+func graphqlConfig(c *server.Config) {
+	p := graphqlPath
+	c.GraphQLPath = &p
+}
+
+func graphqlBody(query string, vars map[string]interface{}) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	return b
+}
+
+// graphqlConn is a GraphQL over WebSocket client connection.
+type graphqlConn struct {
+	ws *websocket.Conn
+}
+
+func (s *Session) connectGraphQL(t *testing.T) *graphqlConn {
+	d := wstest.NewDialer(s.s)
+	d.Subprotocols = []string{"graphql-transport-ws"}
+	ws, _, err := d.Dial("ws://example.org"+graphqlPath, nil)
+	if err != nil {
+		t.Fatalf("error connecting to GraphQL endpoint: %s", err)
+	}
+	gc := &graphqlConn{ws: ws}
+	gc.Send(t, `{"type":"connection_init"}`)
+	gc.AssertMessage(t, `{"type":"connection_ack"}`)
+	return gc
+}
+
+func (gc *graphqlConn) Send(t *testing.T, msg string) {
+	if err := gc.ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatalf("error writing GraphQL message: %s", err)
+	}
+}
+
+func (gc *graphqlConn) AssertMessage(t *testing.T, expected string) {
+	_ = gc.ws.SetReadDeadline(time.Now().Add(timeoutSeconds * time.Second))
+	_, msg, err := gc.ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected GraphQL message %s, but got error: %s", expected, err)
+	}
+	AssertEqualJSON(t, "message", json.RawMessage(msg), json.RawMessage(expected))
+}
+
+func (gc *graphqlConn) Close() {
+	gc.ws.Close()
+}
+
+// Test GraphQL query with variables, aliases, fragments and resource references
+func TestGraphQLQueryModelWithReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		query := `query Parent($rid: String!) {
+			p: resource(rid: $rid) {
+				...Name
+				child { string, number: int, _rid }
+			}
+		}
+		fragment Name on Model { name missing }`
+		hreq := s.HTTPRequest("POST", graphqlPath, graphqlBody(query, map[string]interface{}{"rid": "test.model.parent"}))
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").
+			AssertPathPayload(t, "isHttp", true).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		hreq.GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{"data":{"p":{"name":"parent","missing":null,"child":{"string":"foo","number":42,"_rid":"test.model"}}}}`)).
+			AssertHeaders(t, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	}, graphqlConfig)
+}
+
+// Test GraphQL query on a collection using a GET request
+func TestGraphQLQueryCollectionUsingGET(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", graphqlPath+"?query="+url.QueryEscape(`{ resource(rid: "test.collection") }`), nil)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").
+			RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"data":{"resource":["foo",42,true,null]}}`))
+	}, graphqlConfig)
+}
+
+// Test GraphQL requests failing before execution
+func TestGraphQLRequestErrors(t *testing.T) {
+	tbl := []struct {
+		Method       string
+		Body         string
+		ExpectedCode int
+	}{
+		{"POST", `{"query":"{ resource(rid: \"test.model\") { name "}`, http.StatusBadRequest},
+		{"POST", `{"query":"{ unknown }"}`, http.StatusBadRequest},
+		{"POST", `{"query":"query($rid: String!) { resource(rid: $rid) { name } }"}`, http.StatusBadRequest},
+		{"POST", `{"query":"subscription { resource(rid: \"test.model\") { name } }"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"PUT", `{"query":"{ resource(rid: \"test.model\") { name } }"}`, http.StatusMethodNotAllowed},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, string(rune('1'+i)), func(s *Session) {
+			hresp := s.HTTPRequest(l.Method, graphqlPath, []byte(l.Body)).
+				GetResponse(t).
+				AssertStatusCode(t, l.ExpectedCode)
+
+			var resp struct {
+				Data   json.RawMessage   `json:"data"`
+				Errors []json.RawMessage `json:"errors"`
+			}
+			if err := json.Unmarshal(hresp.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("expected a GraphQL response, but got %s", hresp.Body.String())
+			}
+			if resp.Data != nil || len(resp.Errors) != 1 {
+				t.Fatalf("expected a single error without data, but got %s", hresp.Body.String())
+			}
+		}, graphqlConfig)
+	}
+}
+
+// Test GraphQL query on a resource with access denied
+func TestGraphQLQueryAccessDenied(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", graphqlPath, graphqlBody(`{ resource(rid: "test.model") { string } }`, nil))
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":false}`))
+		mreqs.GetRequest(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{
+			"data":{"resource":null},
+			"errors":[{
+				"message":"Access denied",
+				"locations":[{"line":1,"column":3}],
+				"path":["resource"],
+				"extensions":{"code":"system.accessDenied"}
+			}]
+		}`))
+	}, graphqlConfig)
+}
+
+// Test GraphQL mutation calling a method
+func TestGraphQLMutationCall(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", graphqlPath, graphqlBody(`mutation { result: call(rid: "test.model", method: "method", params: {value: 42}) }`, nil))
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"call":"method"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			AssertPathPayload(t, "params", json.RawMessage(`{"value":42}`)).
+			AssertPathPayload(t, "isHttp", true).
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"data":{"result":{"foo":"bar"}}}`))
+	}, graphqlConfig)
+}
+
+// Test GraphQL subscription over WebSocket receiving updates on change events
+func TestGraphQLSubscriptionOverWebSocket(t *testing.T) {
+	runTest(t, func(s *Session) {
+		gc := s.connectGraphQL(t)
+		defer gc.Close()
+
+		gc.Send(t, `{"id":"1","type":"subscribe","payload":{"query":"subscription { resource(rid: \"test.model\") { string } }"}}`)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").
+			AssertPathMissing(t, "isHttp").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"string":"foo"}}}}`)
+
+		// A change on a property not selected sends no update
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"string":"bar"}}}}`)
+
+		gc.Send(t, `{"type":"ping"}`)
+		gc.AssertMessage(t, `{"type":"pong"}`)
+
+		gc.Send(t, `{"id":"1","type":"complete"}`)
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz"}}`))
+		gc.Send(t, `{"type":"ping"}`)
+		gc.AssertMessage(t, `{"type":"pong"}`)
+	}, graphqlConfig)
+}
+
+// Test GraphQL subscription resolved again on events on a referenced resource
+func TestGraphQLSubscriptionReferencedResourceEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		gc := s.connectGraphQL(t)
+		defer gc.Close()
+
+		gc.Send(t, `{"id":"1","type":"subscribe","payload":{"query":"subscription { resource(rid: \"test.model.parent\") { name child { string } } }"}}`)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"name":"parent","child":{"string":"foo"}}}}}`)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"name":"parent","child":{"string":"bar"}}}}}`)
+
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"name":"changed"}}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"name":"changed","child":{"string":"bar"}}}}}`)
+	}, graphqlConfig)
+}
+
+// Test GraphQL WebSocket connection closing on subscribe before connection_init
+func TestGraphQLSubscribeBeforeInitClosesConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		d := wstest.NewDialer(s.s)
+		d.Subprotocols = []string{"graphql-transport-ws"}
+		ws, _, err := d.Dial("ws://example.org"+graphqlPath, nil)
+		if err != nil {
+			t.Fatalf("error connecting to GraphQL endpoint: %s", err)
+		}
+		defer ws.Close()
+
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"subscribe","payload":{"query":"{ resource(rid: \"test.model\") { string } }"}}`))
+		_ = ws.SetReadDeadline(time.Now().Add(timeoutSeconds * time.Second))
+		_, _, err = ws.ReadMessage()
+		if !websocket.IsCloseError(err, 4401) {
+			t.Fatalf("expected close error 4401, but got %v", err)
+		}
+	}, graphqlConfig)
+}
+
+// Test GraphQL subscription completed on a delete event on the resource
+func TestGraphQLSubscriptionDeleteEventCompletesSubscription(t *testing.T) {
+	runTest(t, func(s *Session) {
+		gc := s.connectGraphQL(t)
+		defer gc.Close()
+
+		gc.Send(t, `{"id":"1","type":"subscribe","payload":{"query":"subscription { resource(rid: \"test.model\") { string } }"}}`)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		gc.AssertMessage(t, `{"id":"1","type":"next","payload":{"data":{"resource":{"string":"foo"}}}}`)
+
+		s.ResourceEvent("test.model", "delete", nil)
+		gc.AssertMessage(t, `{"id":"1","type":"complete"}`)
+		gc.Send(t, `{"type":"ping"}`)
+		gc.AssertMessage(t, `{"type":"pong"}`)
+	}, graphqlConfig)
+}
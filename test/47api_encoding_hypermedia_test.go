@@ -0,0 +1,231 @@
+// Tests for the jsonapi and hal API encodings
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func apiEncodingConfig(enc string) func(c *server.Config) {
+	return func(c *server.Config) {
+		c.APIEncoding = enc
+	}
+}
+
+// getWithReference sends a HTTP GET request for a resource referencing a
+// child resource, and responds to the requests for both.
+func getWithReference(t *testing.T, s *Session, rid string, childRID string, child interface{}) *HTTPRequest {
+	hreq := s.HTTPRequest("GET", "/api/"+ridPath(rid), nil)
+
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get."+rid).RespondSuccess(json.RawMessage(resourceResult(rid)))
+
+	req := s.GetRequest(t).AssertSubject(t, "get."+childRID)
+	if err, ok := child.(*reserr.Error); ok {
+		req.RespondError(err)
+	} else {
+		req.RespondSuccess(child)
+	}
+	return hreq
+}
+
+func ridPath(rid string) string {
+	b := []byte(rid)
+	for i, c := range b {
+		if c == '.' {
+			b[i] = '/'
+		}
+	}
+	return string(b)
+}
+
+func resourceResult(rid string) string {
+	if resources[rid].typ == typeCollection {
+		return `{"collection":` + resourceData(rid) + `}`
+	}
+	return `{"model":` + resourceData(rid) + `}`
+}
+
+// Test jsonapi encoding of a model with a resource reference
+func TestAPIEncodingJSONAPIModelWithReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.model.parent", "test.model", json.RawMessage(resourceResult("test.model"))).
+			GetResponse(t).
+			AssertHeaders(t, map[string]string{"Content-Type": "application/vnd.api+json"}).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"data":{
+					"type":"model",
+					"id":"test.model.parent",
+					"attributes":{"name":"parent"},
+					"relationships":{"child":{"data":{"type":"model","id":"test.model"},"links":{"related":"/api/test/model"}}},
+					"links":{"self":"/api/test/model/parent"}
+				},
+				"included":[{
+					"type":"model",
+					"id":"test.model",
+					"attributes":{"string":"foo","int":42,"bool":true,"null":null},
+					"links":{"self":"/api/test/model"}
+				}],
+				"links":{"self":"/api/test/model/parent"}
+			}`))
+	}, apiEncodingConfig("jsonapi"))
+}
+
+// getModel sends a HTTP GET request for a model, and responds to the requests
+// with the model data.
+func getModel(t *testing.T, s *Session, rid string, model string) *HTTPRequest {
+	hreq := s.HTTPRequest("GET", "/api/"+ridPath(rid), nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get."+rid).RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+	return hreq
+}
+
+// Test jsonapi encoding of a model with properties named id and type
+func TestAPIEncodingJSONAPIModelWithReservedNames(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getModel(t, s, "test.model", `{"id":42,"type":{"data":{"foo":"bar"}},"name":"foo"}`).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"data":{
+					"type":"model",
+					"id":"test.model",
+					"attributes":{"name":"foo"},
+					"links":{"self":"/api/test/model"},
+					"meta":{"id":42,"type":{"foo":"bar"}}
+				},
+				"links":{"self":"/api/test/model"}
+			}`))
+	}, apiEncodingConfig("jsonapi"))
+}
+
+// Test jsonapi encoding of a collection with a resource reference
+func TestAPIEncodingJSONAPICollectionWithReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.collection.parent", "test.collection", json.RawMessage(resourceResult("test.collection"))).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"data":{
+					"type":"collection",
+					"id":"test.collection.parent",
+					"attributes":{"values":["parent",{"rid":"test.collection"}]},
+					"relationships":{"items":{"data":[{"type":"collection","id":"test.collection"}]}},
+					"links":{"self":"/api/test/collection/parent"}
+				},
+				"included":[{
+					"type":"collection",
+					"id":"test.collection",
+					"attributes":{"values":["foo",42,true,null]},
+					"links":{"self":"/api/test/collection"}
+				}],
+				"links":{"self":"/api/test/collection/parent"}
+			}`))
+	}, apiEncodingConfig("jsonapi"))
+}
+
+// Test jsonapi encoding of a model with a broken resource reference
+func TestAPIEncodingJSONAPIBrokenReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.model.brokenchild", "test.err.notFound", reserr.ErrNotFound).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"data":{
+					"type":"model",
+					"id":"test.model.brokenchild",
+					"attributes":{"name":"brokenchild"},
+					"relationships":{"child":{
+						"links":{"related":"/api/test/err/notFound"},
+						"meta":{"error":{"code":"system.notFound","message":"Not found"}}
+					}},
+					"links":{"self":"/api/test/model/brokenchild"}
+				},
+				"links":{"self":"/api/test/model/brokenchild"}
+			}`))
+	}, apiEncodingConfig("jsonapi"))
+}
+
+// Test jsonapi encoding of errors and call results
+func TestAPIEncodingJSONAPIErrorAndCallResult(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("GET", "/api/test.model", nil).
+			GetResponse(t).
+			Equals(t, http.StatusNotFound, json.RawMessage(`{"errors":[{"status":"404","code":"system.notFound","title":"Not found"}]}`))
+
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).AssertSubject(t, "access.test.model").RespondSuccess(json.RawMessage(`{"call":"*"}`))
+		s.GetRequest(t).AssertSubject(t, "call.test.model.method").RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"meta":{"result":{"foo":"bar"}}}`))
+	}, apiEncodingConfig("jsonapi"))
+}
+
+// Test hal encoding of a model with a resource reference
+func TestAPIEncodingHALModelWithReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.model.parent", "test.model", json.RawMessage(resourceResult("test.model"))).
+			GetResponse(t).
+			AssertHeaders(t, map[string]string{"Content-Type": "application/hal+json"}).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"_links":{"self":{"href":"/api/test/model/parent"},"child":{"href":"/api/test/model"}},
+				"_embedded":{"child":{
+					"_links":{"self":{"href":"/api/test/model"}},
+					"string":"foo","int":42,"bool":true,"null":null
+				}},
+				"name":"parent"
+			}`))
+	}, apiEncodingConfig("hal"))
+}
+
+// Test hal encoding of a model with properties named as reserved members or
+// the self link
+func TestAPIEncodingHALModelWithReservedNames(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getModel(t, s, "test.model", `{"_links":1,"_embedded":{"data":{"foo":"bar"}},"self":{"rid":"test.other","soft":true},"name":"foo"}`).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"_links":{"self":{"href":"/api/test/model"}},
+				"name":"foo"
+			}`))
+	}, apiEncodingConfig("hal"))
+}
+
+// Test hal encoding of a collection with a resource reference
+func TestAPIEncodingHALCollectionWithReference(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.collection.parent", "test.collection", json.RawMessage(resourceResult("test.collection"))).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"_links":{"self":{"href":"/api/test/collection/parent"},"items":[{"href":"/api/test/collection"}]},
+				"_embedded":{"items":[{
+					"_links":{"self":{"href":"/api/test/collection"}},
+					"values":["foo",42,true,null]
+				}]},
+				"values":["parent",{"href":"/api/test/collection"}]
+			}`))
+	}, apiEncodingConfig("hal"))
+}
+
+// Test hal encoding of a model with a broken resource reference, and of errors
+func TestAPIEncodingHALErrors(t *testing.T) {
+	runTest(t, func(s *Session) {
+		getWithReference(t, s, "test.model.brokenchild", "test.err.notFound", reserr.ErrNotFound).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{
+				"_links":{"self":{"href":"/api/test/model/brokenchild"},"child":{"href":"/api/test/err/notFound"}},
+				"_embedded":{"child":{
+					"_links":{"self":{"href":"/api/test/err/notFound"}},
+					"message":"Not found",
+					"logref":"system.notFound"
+				}},
+				"name":"brokenchild"
+			}`))
+
+		s.HTTPRequest("GET", "/api/test.model", nil).
+			GetResponse(t).
+			Equals(t, http.StatusNotFound, json.RawMessage(`{"message":"Not found","logref":"system.notFound"}`))
+	}, apiEncodingConfig("hal"))
+}
@@ -0,0 +1,194 @@
+// Tests for the OpenAPI document
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const openAPIPath = "/openapi.json"
+
+func openAPIConfig(rnames ...string) func(c *server.Config) {
+	return func(c *server.Config) {
+		p := openAPIPath
+		c.OpenAPIPath = &p
+		c.OpenAPIResources = rnames
+	}
+}
+
+func getOpenAPIPaths(t *testing.T, hresp *HTTPResponse) map[string]json.RawMessage {
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(hresp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("expected an OpenAPI document, but got %s", hresp.Body.String())
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("expected openapi version 3.0.3, but got %s", doc.OpenAPI)
+	}
+	return doc.Paths
+}
+
+// Test OpenAPI document describing a model with path parameters and methods
+func TestOpenAPIDocumentModel(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", openAPIPath, nil)
+		s.GetRequest(t).
+			AssertSubject(t, "schema.test.model.$id").
+			RespondSuccess(json.RawMessage(`{
+				"type":"model",
+				"title":"Test model",
+				"schema":{"type":"object","properties":{"string":{"type":"string"}}},
+				"methods":{
+					"set":{"params":{"type":"object"}},
+					"method":{"description":"Test method","result":{"type":"string"}}
+				}
+			}`))
+		hresp := hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertHeaders(t, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+
+		paths := getOpenAPIPaths(t, hresp)
+		if len(paths) != 3 {
+			t.Fatalf("expected 3 paths, but got %d", len(paths))
+		}
+		params := `[{"name":"id","in":"path","required":true,"schema":{"type":"string"}}]`
+		errors := `"401":{"$ref":"#/components/responses/Unauthorized"},"403":{"$ref":"#/components/responses/Forbidden"},"404":{"$ref":"#/components/responses/NotFound"},"default":{"$ref":"#/components/responses/InternalError"}`
+		callErrors := `"400":{"$ref":"#/components/responses/BadRequest"},"405":{"$ref":"#/components/responses/MethodNotAllowed"},` + errors
+		AssertEqualJSON(t, "get path", paths["/api/test/model/{id}"], json.RawMessage(`{
+			"get":{
+				"operationId":"get.test.model.$id",
+				"summary":"Test model",
+				"tags":["test"],
+				"parameters":`+params+`,
+				"responses":{
+					"200":{"description":"Resource","content":{"application/json; charset=utf-8":{"schema":{"type":"object","properties":{"string":{"type":"string"}}}}}},
+					`+errors+`
+				}
+			},
+			"put":{
+				"operationId":"put.test.model.$id",
+				"tags":["test"],
+				"parameters":`+params+`,
+				"requestBody":{"content":{"application/json":{"schema":{"type":"object"}}}},
+				"responses":{
+					"200":{"description":"Call result","content":{"application/json; charset=utf-8":{}}},
+					"204":{"description":"No result"},
+					`+callErrors+`
+				}
+			}
+		}`))
+		AssertEqualJSON(t, "call path", paths["/api/test/model/{id}/method"], json.RawMessage(`{
+			"post":{
+				"operationId":"call.test.model.$id.method",
+				"description":"Test method",
+				"tags":["test"],
+				"parameters":`+params+`,
+				"responses":{
+					"200":{"description":"Call result","content":{"application/json; charset=utf-8":{"schema":{"type":"string"}}}},
+					"204":{"description":"No result"},
+					`+callErrors+`
+				}
+			}
+		}`))
+		if paths["/api/test/model/{id}/set"] == nil {
+			t.Fatalf("expected path for set method, but found none")
+		}
+	}, openAPIConfig("test.model.$id"), func(c *server.Config) {
+		method := "set"
+		c.PUTMethod = &method
+	})
+}
+
+// Test OpenAPI document describing a resource without a schema
+func TestOpenAPIDocumentSchemaError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", openAPIPath, nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "schema.test.collection").
+			RespondSuccess(json.RawMessage(`{"type":"collection","schema":{"type":"array"}}`))
+		mreqs.GetRequest(t, "schema.test.model").
+			RespondError(reserr.ErrNotFound)
+
+		paths := getOpenAPIPaths(t, hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK))
+		if len(paths) != 2 {
+			t.Fatalf("expected 2 paths, but got %d", len(paths))
+		}
+		AssertEqualJSON(t, "model path", paths["/api/test/model"], json.RawMessage(`{
+			"get":{
+				"operationId":"get.test.model",
+				"tags":["test"],
+				"responses":{
+					"200":{"description":"Resource","content":{"application/json; charset=utf-8":{}}},
+					"401":{"$ref":"#/components/responses/Unauthorized"},
+					"403":{"$ref":"#/components/responses/Forbidden"},
+					"404":{"$ref":"#/components/responses/NotFound"},
+					"default":{"$ref":"#/components/responses/InternalError"}
+				}
+			}
+		}`))
+	}, openAPIConfig("test.collection", "test.model"))
+}
+
+// Test OpenAPI document requested by multiple clients sending a single schema
+// request, and being served from cache
+func TestOpenAPIDocumentCached(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq1 := s.HTTPRequest("GET", openAPIPath, nil)
+		hreq2 := s.HTTPRequest("GET", openAPIPath, nil)
+		s.GetRequest(t).
+			AssertSubject(t, "schema.test.model").
+			RespondSuccess(json.RawMessage(`{"type":"model","schema":{"type":"object"}}`))
+		body := hreq1.GetResponse(t).AssertStatusCode(t, http.StatusOK).Body.String()
+		hreq2.GetResponse(t).AssertStatusCode(t, http.StatusOK).AssertBody(t, json.RawMessage(body))
+
+		// No schema request is sent, as the response would otherwise time out
+		s.HTTPRequest("GET", openAPIPath, nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertBody(t, json.RawMessage(body))
+	}, openAPIConfig("test.model"))
+}
+
+// Test OpenAPI document error component using the API encoding
+func TestOpenAPIDocumentErrorComponent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hresp := s.HTTPRequest("GET", openAPIPath, nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusOK)
+
+		var doc struct {
+			Components struct {
+				Schemas   map[string]json.RawMessage `json:"schemas"`
+				Responses map[string]json.RawMessage `json:"responses"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(hresp.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("expected an OpenAPI document, but got %s", hresp.Body.String())
+		}
+		AssertEqualJSON(t, "error schema", doc.Components.Schemas["Error"], json.RawMessage(`{
+			"type":"object",
+			"required":["message","logref"],
+			"properties":{"message":{"type":"string"},"logref":{"type":"string"},"data":{}}
+		}`))
+		AssertEqualJSON(t, "not found response", doc.Components.Responses["NotFound"], json.RawMessage(`{
+			"description":"Resource or method not found",
+			"content":{"application/hal+json":{"schema":{"$ref":"#/components/schemas/Error"}}}
+		}`))
+	}, openAPIConfig(), apiEncodingConfig("hal"))
+}
+
+// Test OpenAPI document path with other HTTP methods than GET
+func TestOpenAPIDocumentMethodNotAllowed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", openAPIPath, nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusMethodNotAllowed).
+			AssertHeaders(t, map[string]string{"Allow": "GET, HEAD, OPTIONS"})
+	}, openAPIConfig())
+}
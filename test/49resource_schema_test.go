@@ -0,0 +1,96 @@
+// Tests for resource value schema validation
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// resourceSchemaConfig sets a resource schema rule, and enables the metrics
+// server for inspecting violations.
+func resourceSchemaConfig(pattern string, schema string) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.ResourceSchemas = append(cfg.ResourceSchemas, server.ResourceSchemaRule{
+			Pattern: pattern,
+			Schema:  json.RawMessage(schema),
+		})
+		cfg.MetricsPort = 8090
+	}
+}
+
+func TestResourceSchema_ValidModel_IsLoaded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModelParent(t, s, c, false)
+	}, resourceSchemaConfig("test.model.*", `{
+		"type":"object",
+		"required":["name","child"],
+		"properties":{
+			"name":{"type":"string"},
+			"child":{"type":"object","required":["rid"]}
+		}
+	}`))
+}
+
+func TestResourceSchema_InvalidGetResponse_RespondsInternalError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertErrorCode(t, "system.internalError")
+
+		s.AssertErrorsLogged(t, 1)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_schema_violations_total{service="test"} 1`,
+		})
+	}, resourceSchemaConfig("test.>", `{"properties":{"string":{"type":"integer"}}}`))
+}
+
+func TestResourceSchema_InvalidChangeEvent_IsDiscarded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":"foo"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+
+		s.AssertErrorsLogged(t, 1)
+	}, resourceSchemaConfig("test.model", `{"properties":{"int":{"type":"integer"}}}`))
+}
+
+func TestResourceSchema_InvalidAddEvent_IsDiscarded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"value":"bar","idx":0}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+
+		s.AssertErrorsLogged(t, 1)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_cache_schema_violations_total{service="test"} 1`,
+		})
+	}, resourceSchemaConfig("test.collection", `{"type":"array","maxItems":4}`))
+}
+
+func TestResourceSchema_InvalidResetResponse_IsDiscarded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"foo","int":"bar","bool":true,"null":null}}`))
+		c.AssertNoEvent(t, "test.model")
+
+		// Validation error and reset error
+		s.AssertErrorsLogged(t, 2)
+	}, resourceSchemaConfig("test.model", `{"properties":{"int":{"type":"integer"}}}`))
+}
@@ -0,0 +1,102 @@
+// Tests for call parameter schema validation
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// callSchemaConfig sets a call schema rule.
+func callSchemaConfig(pattern, method, schema string) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.CallSchemas = append(cfg.CallSchemas, server.CallSchemaRule{
+			Pattern: pattern,
+			Method:  method,
+			Schema:  json.RawMessage(schema),
+		})
+	}
+}
+
+const callSchemaTestSchema = `{
+	"type":"object",
+	"required":["name"],
+	"properties":{"name":{"type":"string"}}
+}`
+
+func TestCallSchema_ValidParams_IsForwarded(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", json.RawMessage(`{"name":"foo"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			AssertPathPayload(t, "params", json.RawMessage(`{"name":"foo"}`)).
+			RespondSuccess(json.RawMessage(`"bar"`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":"bar"}`))
+	}, callSchemaConfig("test.>", "method", callSchemaTestSchema))
+}
+
+func TestCallSchema_InvalidParams_RespondsInvalidParams(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		resp := c.Request("call.test.model.method", json.RawMessage(`{"name":42}`)).
+			GetResponse(t).
+			AssertErrorCode(t, reserr.CodeInvalidParams)
+		AssertEqualJSON(t, "error data", resp.Error.Data, json.RawMessage(`[{"path":"/name","message":"must be of type string"}]`))
+		c.AssertNoNATSRequest(t, "test.model")
+	}, callSchemaConfig("test.>", "method", callSchemaTestSchema))
+}
+
+func TestCallSchema_MissingParams_ValidatedAsNull(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		resp := c.Request("call.test.model.method", nil).
+			GetResponse(t).
+			AssertErrorCode(t, reserr.CodeInvalidParams)
+		AssertEqualJSON(t, "error data", resp.Error.Data, json.RawMessage(`[{"path":"","message":"must be of type object"}]`))
+		c.AssertNoNATSRequest(t, "test.model")
+	}, callSchemaConfig("test.>", "method", callSchemaTestSchema))
+}
+
+func TestCallSchema_OtherMethod_IsNotValidated(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.other", json.RawMessage(`{"name":42}`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.other").
+			RespondSuccess(nil)
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+	}, callSchemaConfig("test.>", "method", callSchemaTestSchema))
+}
+
+func TestCallSchema_InvalidNewParams_RespondsInvalidParams(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("new.test.collection", json.RawMessage(`{}`)).
+			GetResponse(t).
+			AssertErrorCode(t, reserr.CodeInvalidParams)
+		c.AssertNoNATSRequest(t, "test.collection")
+	}, callSchemaConfig("test.collection", "new", callSchemaTestSchema))
+}
+
+func TestCallSchema_InvalidHTTPParams_RespondsInvalidParams(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", "/api/test/model/method", []byte(`{"name":42}`)).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusBadRequest).
+			AssertBody(t, json.RawMessage(`{
+				"code":"system.invalidParams",
+				"message":"Invalid parameters",
+				"data":[{"path":"/name","message":"must be of type string"}]
+			}`))
+	}, callSchemaConfig("test.>", "method", callSchemaTestSchema))
+}
@@ -0,0 +1,123 @@
+// Tests for request size limits
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// sizeLimitConfig sets the size limits, and enables the metrics server for
+// inspecting rejected requests.
+func sizeLimitConfig(wsMaxMessageSize, httpMaxBodySize, maxCallParamsSize int) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.WSMaxMessageSize = wsMaxMessageSize
+		cfg.HTTPMaxBodySize = httpMaxBodySize
+		cfg.MaxCallParamsSize = maxCallParamsSize
+		cfg.MetricsPort = 8090
+	}
+}
+
+// largeParams returns a JSON string of at least size bytes.
+func largeParams(size int) json.RawMessage {
+	return json.RawMessage(`"` + strings.Repeat("x", size) + `"`)
+}
+
+func TestSizeLimit_WSMessageWithinLimit_IsHandled(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", largeParams(100))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(nil)
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+	}, sizeLimitConfig(1024, 0, 0))
+}
+
+func TestSizeLimit_WSMessageExceedingLimit_ClosesConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("call.test.model.method", largeParams(512))
+		c.AssertClosed(t)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_oversized_requests_total{limit="ws_message"} 1`,
+		})
+	}, sizeLimitConfig(256, 0, 0))
+}
+
+func TestSizeLimit_CallParamsExceedingLimit_RespondsInvalidRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("call.test.model.method", largeParams(100)).
+			GetResponse(t).
+			AssertError(t, &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Params too large"})
+		c.AssertNoNATSRequest(t, "test.model")
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_oversized_requests_total{limit="call_params"} 1`,
+		})
+	}, sizeLimitConfig(0, 0, 64))
+}
+
+func TestSizeLimit_AuthParamsExceedingLimit_RespondsInvalidRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("auth.test.model.method", largeParams(100)).
+			GetResponse(t).
+			AssertError(t, &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Params too large"})
+		c.AssertNoNATSRequest(t, "test.model")
+	}, sizeLimitConfig(0, 0, 64))
+}
+
+func TestSizeLimit_HTTPBodyExceedingLimit_Responds413(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", "/api/test/model/method", largeParams(2048)).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusRequestEntityTooLarge).
+			AssertError(t, &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Request body too large"})
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_oversized_requests_total{limit="http_body"} 1`,
+		})
+	}, sizeLimitConfig(0, 1024, 0))
+}
+
+func TestSizeLimit_HTTPCallParamsExceedingLimit_Responds413(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", "/api/test/model/method", largeParams(100)).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusRequestEntityTooLarge).
+			AssertError(t, &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Params too large"})
+	}, sizeLimitConfig(0, 1024, 64))
+}
+
+func TestSizeLimit_GraphQLMutationParamsExceedingLimit_RespondsInvalidRequest(t *testing.T) {
+	tbl := []struct {
+		Field string
+	}{
+		{"call"},
+		{"auth"},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, string(rune('1'+i)), func(s *Session) {
+			query := `mutation { result: ` + l.Field + `(rid: "test.model", method: "method", params: {value: "` + strings.Repeat("x", 100) + `"}) }`
+			s.HTTPRequest("POST", graphqlPath, graphqlBody(query, nil)).
+				GetResponse(t).
+				Equals(t, http.StatusOK, json.RawMessage(`{
+					"data":{"result":null},
+					"errors":[{
+						"message":"Params too large",
+						"locations":[{"line":1,"column":12}],
+						"path":["result"],
+						"extensions":{"code":"system.invalidRequest"}
+					}]
+				}`))
+		}, sizeLimitConfig(0, 1024, 64), graphqlConfig)
+	}
+}
@@ -0,0 +1,69 @@
+// Tests for WebSocket keepalive pings and idle timeouts
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// keepAliveConfig sets the keepalive timeouts, and enables the metrics server
+// for inspecting timed out connections.
+func keepAliveConfig(pingInterval, pongTimeout, idleTimeout int) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.WSPingInterval = pingInterval
+		cfg.WSPongTimeout = pongTimeout
+		cfg.WSIdleTimeout = idleTimeout
+		cfg.MetricsPort = 8090
+	}
+}
+
+func TestWSKeepAlive_RespondingWithPong_KeepsConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		time.Sleep(200 * time.Millisecond)
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, keepAliveConfig(20, 20, 0))
+}
+
+func TestWSKeepAlive_NotRespondingWithPong_ClosesConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithoutPong()
+		c.AssertClosed(t)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_ws_timeouts_total{reason="pong"} 1`,
+			`resgate_ws_timeouts_total{reason="idle"} 0`,
+		})
+	}, keepAliveConfig(20, 20, 0))
+}
+
+func TestWSKeepAlive_IdleConnection_ClosesConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.AssertClosed(t)
+		AssertResponseContainsMetrics(t, s.MetricsHTTPRequest(), []string{
+			`resgate_ws_timeouts_total{reason="pong"} 0`,
+			`resgate_ws_timeouts_total{reason="idle"} 1`,
+		})
+	}, keepAliveConfig(0, 0, 50))
+}
+
+func TestWSKeepAlive_ClientRequests_ResetsIdleTimeout(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		for i := 0; i < 4; i++ {
+			time.Sleep(50 * time.Millisecond)
+			c.Request("version", versionRequest).GetResponse(t)
+		}
+		c.AssertClosed(t)
+	}, keepAliveConfig(0, 0, 100))
+}
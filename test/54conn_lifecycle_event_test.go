@@ -0,0 +1,79 @@
+// Tests for connection connected and disconnected events published to services
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func connEventsConfig(cfg *server.Config) {
+	cfg.ConnEvents = true
+}
+
+func TestConnLifecycleEvent_ConnectAndDisconnect_PublishesEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+
+		s.GetPublish(t).
+			AssertSubject(t, "conn."+cid+".connected").
+			AssertPathPayload(t, "protocol", "1.1.1").
+			AssertPathMissing(t, "tid").
+			AssertPathMissing(t, "duration")
+
+		c.Disconnect()
+		s.GetPublish(t).
+			AssertSubject(t, "conn."+cid+".disconnected").
+			AssertPathPayload(t, "protocol", "1.999.999").
+			AssertPathMissing(t, "tid").
+			AssertPathType(t, "duration", float64(0))
+	}, connEventsConfig)
+}
+
+func TestConnLifecycleEvent_WithTokenID_IncludesTokenID(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+		s.GetPublish(t).AssertSubject(t, "conn."+cid+".connected")
+
+		s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"tid":"foo"}`))
+		// Ensure the token event is handled before disconnecting
+		getCID(t, s, c)
+
+		c.Disconnect()
+		s.GetPublish(t).
+			AssertSubject(t, "conn."+cid+".disconnected").
+			AssertPathPayload(t, "tid", "foo")
+	}, connEventsConfig)
+}
+
+func TestConnLifecycleEvent_DisconnectEvent_PublishesDisconnectedEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+		s.GetPublish(t).AssertSubject(t, "conn."+cid+".connected")
+
+		s.ConnEvent(cid, "disconnect", nil)
+		c.AssertClosed(t)
+		s.GetPublish(t).AssertSubject(t, "conn."+cid+".disconnected")
+	}, connEventsConfig)
+}
+
+func TestConnLifecycleEvent_HTTPRequest_PublishesNoEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(nil)
+		hreq.GetResponse(t)
+
+		c := s.Connect()
+		cid := getCID(t, s, c)
+		s.GetPublish(t).AssertSubject(t, "conn."+cid+".connected")
+	}, connEventsConfig)
+}
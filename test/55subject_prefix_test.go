@@ -0,0 +1,219 @@
+// Tests for prefixing NATS subjects
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func subjectPrefixConfig(cfg *server.Config) {
+	cfg.SubjectPrefix = "env.tenant1"
+}
+
+func TestSubjectPrefix_Subscribe_SendsPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.tenant1.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.tenant1.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}}}`))
+	}, subjectPrefixConfig)
+}
+
+func TestSubjectPrefix_ResourceEvent_SentToClient(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.tenant1.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.tenant1.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t)
+
+		s.event("env.tenant1.event.test.model", "change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+	}, subjectPrefixConfig)
+}
+
+func TestSubjectPrefix_CallRequest_SendsPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "env.tenant1.access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "env.tenant1.call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":{"foo":"bar"}}`))
+	}, subjectPrefixConfig)
+}
+
+func TestSubjectPrefix_ConnEvent_HandledByConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("auth.test.method", nil)
+		req := s.GetRequest(t).AssertSubject(t, "env.tenant1.auth.test.method")
+		cid := req.PathPayload(t, "cid").(string)
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		s.event("env.tenant1.conn."+cid, "disconnect", nil)
+		c.AssertClosed(t)
+	}, subjectPrefixConfig)
+}
+
+func TestSubjectPrefix_SystemReset_SendsPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.tenant1.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.tenant1.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t)
+
+		s.event("env.tenant1.system", "reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "env.tenant1.get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"foo":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+	}, subjectPrefixConfig)
+}
+
+func TestSubjectPrefix_ConnLifecycleEvent_PublishesPrefixedEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("auth.test.method", nil)
+		req := s.GetRequest(t).AssertSubject(t, "env.tenant1.auth.test.method")
+		cid := req.PathPayload(t, "cid").(string)
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		s.GetPublish(t).AssertSubject(t, "env.tenant1.conn."+cid+".connected")
+	}, subjectPrefixConfig, connEventsConfig)
+}
+
+func tenantsConfig(cfg *server.Config) {
+	cfg.SubjectPrefix = "env.default"
+	cfg.Tenants = []server.TenantConfig{
+		{Host: "acme.example.org", SubjectPrefix: "env.acme"},
+		{Path: "/globex", SubjectPrefix: "env.globex"},
+	}
+}
+
+func TestTenants_SubscribeOnHost_SendsTenantPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithURL("ws://acme.example.org/")
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.acme.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.acme.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_SubscribeOnPath_SendsTenantPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithURL("ws://example.org/globex/")
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.globex.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.globex.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_SubscribeOnUnmappedHost_SendsDefaultPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithURL("ws://other.example.org/")
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.default.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.default.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_ResourceEvent_SentToTenantClientsOnly(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.ConnectWithURL("ws://acme.example.org/")
+		creq := c1.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.acme.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.acme.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t)
+
+		c2 := s.Connect()
+		creq = c2.Request("subscribe.test.model", nil)
+		mreqs = s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.default.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.default.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t)
+
+		s.event("env.acme.event.test.model", "change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+		c1.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+		s.event("env.default.event.test.model", "change", json.RawMessage(`{"values":{"foo":"qux"}}`))
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"qux"}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_SystemReset_SendsTenantPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithURL("ws://acme.example.org/")
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.acme.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.acme.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		creq.GetResponse(t)
+
+		s.event("env.default.system", "reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.event("env.acme.system", "reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "env.acme.get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"foo":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_ConnEvent_HandledByTenantConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithURL("ws://acme.example.org/")
+		creq := c.Request("auth.test.method", nil)
+		req := s.GetRequest(t).AssertSubject(t, "env.acme.auth.test.method")
+		cid := req.PathPayload(t, "cid").(string)
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		s.event("env.acme.conn."+cid, "disconnect", nil)
+		c.AssertClosed(t)
+	}, tenantsConfig)
+}
+
+func TestTenants_HTTPGetOnPath_SendsTenantPrefixedRequestsWithTenantHrefs(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/globex/api/test/model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "env.globex.access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "env.globex.get.test.model").RespondSuccess(json.RawMessage(`{"model":{"ref":{"rid":"test.other"}}}`))
+		s.GetRequest(t).AssertSubject(t, "env.globex.get.test.other").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"ref":{"href":"/globex/api/test/other","model":{"foo":"bar"}}}`))
+	}, tenantsConfig)
+}
+
+func TestTenants_HTTPCallOnHost_SendsTenantPrefixedRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, func(req *http.Request) {
+			req.Host = "acme.example.org:8080"
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "env.acme.access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "env.acme.call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+	}, tenantsConfig)
+}
@@ -0,0 +1,194 @@
+// Tests for resolving client address, host and scheme behind trusted proxies
+package test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func TestTrustedProxy_HeaderAuth_AuthRequestContainsClientInfo(t *testing.T) {
+	tbl := []struct {
+		TrustedProxies     []string          // Trusted proxies config
+		RemoteAddr         string            // Remote address of the request
+		Header             map[string]string // Request headers
+		ExpectedRemoteAddr string            // Expected remoteAddr in auth request
+		ExpectedHost       string            // Expected host in auth request. Empty means missing.
+		ExpectedScheme     string            // Expected scheme in auth request
+	}{
+		// No trusted proxies
+		{nil, "10.0.0.1:1234", nil, "10.0.0.1:1234", "", "http"},
+		{nil, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "10.0.0.1:1234", "", "http"},
+		{nil, "10.0.0.1:1234", map[string]string{"Forwarded": "for=203.0.113.5;proto=https"}, "10.0.0.1:1234", "", "http"},
+		// Untrusted proxy
+		{[]string{"10.0.0.0/8"}, "192.168.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "192.168.0.1:1234", "", "http"},
+		{[]string{"10.0.0.0/8"}, "192.168.0.1:1234", map[string]string{"Forwarded": "for=203.0.113.5"}, "192.168.0.1:1234", "", "http"},
+		// Trusted proxy without forwarding headers
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", nil, "10.0.0.1:1234", "", "http"},
+		// X-Forwarded headers
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5:0", "", "http"},
+		{[]string{"10.0.0.1"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"}, "203.0.113.5:0", "example.com", "https"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.5, 10.0.0.2"}, "203.0.113.5:0", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.5", "X-Forwarded-Proto": "http, https"}, "203.0.113.5:0", "", "https"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3:0", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "unknown, 10.0.0.2"}, "10.0.0.1:1234", "", "http"},
+		// Forwarded header
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": "for=203.0.113.5;proto=https;host=example.com"}, "203.0.113.5:0", "example.com", "https"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": `for="203.0.113.5:4711";proto=https, for=10.0.0.2;proto=http`}, "203.0.113.5:4711", "", "https"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`}, "[2001:db8::1]:4711", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1]"`}, "[2001:db8::1]:0", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": `for="203.0.113.5:_port"`}, "203.0.113.5:0", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.1:1234", "", "http"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", map[string]string{"Forwarded": "for=203.0.113.5", "X-Forwarded-For": "198.51.100.1"}, "203.0.113.5:0", "", "http"},
+		// IPv6 trusted proxy
+		{[]string{"::1"}, "[::1]:1234", map[string]string{"X-Forwarded-For": "2001:db8::1"}, "[2001:db8::1]:0", "", "http"},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(req *http.Request) {
+				req.RemoteAddr = l.RemoteAddr
+				for k, v := range l.Header {
+					req.Header.Set(k, v)
+				}
+			})
+
+			req := s.GetRequest(t).
+				AssertSubject(t, "auth.vault.method").
+				AssertPathPayload(t, "remoteAddr", l.ExpectedRemoteAddr).
+				AssertPathPayload(t, "scheme", l.ExpectedScheme)
+			if l.ExpectedHost == "" {
+				req.AssertPathMissing(t, "host")
+			} else {
+				req.AssertPathPayload(t, "host", l.ExpectedHost)
+			}
+			req.RespondSuccess(nil)
+
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+		}, func(cfg *server.Config) {
+			headerAuth := "vault.method"
+			cfg.HeaderAuth = &headerAuth
+			cfg.TrustedProxies = l.TrustedProxies
+		})
+	}
+}
+
+// proxyProtocolConfig enables the HTTP server with the PROXY protocol, and
+// header auth.
+func proxyProtocolConfig(trustedProxies ...string) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		headerAuth := "vault.method"
+		cfg.HeaderAuth = &headerAuth
+		cfg.NoHTTP = false
+		cfg.Port = 58081
+		cfg.TrustedProxies = trustedProxies
+		cfg.ProxyProtocol = true
+	}
+}
+
+// dialProxyProtocol connects to the HTTP server, and sends the PROXY
+// protocol header followed by a GET request for test.model.
+func dialProxyProtocol(t *testing.T, header []byte) net.Conn {
+	conn, err := net.Dial("tcp", "127.0.0.1:58081")
+	if err != nil {
+		t.Fatalf("error connecting to HTTP server: %s", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeoutSeconds * time.Second))
+	req := append(header, "GET /api/test/model HTTP/1.1\r\nHost: example.org\r\nConnection: close\r\n\r\n"...)
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("error writing request: %s", err)
+	}
+	return conn
+}
+
+// proxyHeaderV2 returns a binary PROXY protocol v2 header with the command
+// and an IPv4 source address and port.
+func proxyHeaderV2(cmd byte, src net.IP, port uint16) []byte {
+	b := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	b = append(b, 0x20|cmd, 0x11, 0, 12)
+	b = append(b, src.To4()...)
+	b = append(b, 10, 0, 0, 1)
+	b = binary.BigEndian.AppendUint16(b, port)
+	b = binary.BigEndian.AppendUint16(b, 58081)
+	return b
+}
+
+func TestTrustedProxy_ProxyProtocol_AuthRequestContainsClientAddr(t *testing.T) {
+	tbl := []struct {
+		TrustedProxies     []string // Trusted proxies config
+		Header             []byte   // PROXY protocol header
+		ExpectedRemoteAddr string   // Expected remoteAddr in auth request. Empty means the address of the connection.
+	}{
+		{[]string{"127.0.0.1"}, []byte("PROXY TCP4 203.0.113.5 10.0.0.1 4711 58081\r\n"), "203.0.113.5:4711"},
+		{[]string{"127.0.0.0/8"}, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4711 58081\r\n"), "[2001:db8::1]:4711"},
+		{[]string{"127.0.0.1"}, []byte("PROXY UNKNOWN\r\n"), ""},
+		{[]string{"127.0.0.1"}, proxyHeaderV2(0x1, net.ParseIP("203.0.113.5"), 4711), "203.0.113.5:4711"},
+		{[]string{"127.0.0.1"}, proxyHeaderV2(0x0, net.ParseIP("203.0.113.5"), 4711), ""},
+		// Untrusted proxy sends no header
+		{[]string{"10.0.0.0/8"}, nil, ""},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			conn := dialProxyProtocol(t, l.Header)
+			defer conn.Close()
+
+			expectedRemoteAddr := l.ExpectedRemoteAddr
+			if expectedRemoteAddr == "" {
+				expectedRemoteAddr = conn.LocalAddr().String()
+			}
+			s.GetRequest(t).
+				AssertSubject(t, "auth.vault.method").
+				AssertPathPayload(t, "remoteAddr", expectedRemoteAddr).
+				RespondSuccess(nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("error reading response: %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
+			}
+		}, proxyProtocolConfig(l.TrustedProxies...))
+	}
+}
+
+func TestTrustedProxy_ProxyProtocolWithInvalidHeader_ClosesConnection(t *testing.T) {
+	tbl := []struct {
+		Header []byte // PROXY protocol header
+	}{
+		{nil},
+		{[]byte("PROXY TCP4 203.0.113.5\r\n")},
+		{[]byte("PROXY TCP4 2001:db8::1 10.0.0.1 4711 58081\r\n")},
+		{[]byte("PROXY TCP4 203.0.113.5 10.0.0.1 99999 58081\r\n")},
+		{[]byte("\r\n\r\n\x00\r\nQUIT\n\x11\x11\x00\x00")},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			conn := dialProxyProtocol(t, l.Header)
+			defer conn.Close()
+
+			if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+				t.Fatal("expected the connection to be closed, but got a response")
+			}
+		}, proxyProtocolConfig("127.0.0.1"))
+	}
+}
@@ -0,0 +1,200 @@
+// Tests for TLS client certificate information in auth requests
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// createClientCert creates a self-signed client certificate for testing.
+func createClientCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://example.com/device/42")
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: "device42", Organization: []string{"Resgate"}},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:       []string{"device42.example.com"},
+		EmailAddresses: []string{"device42@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.42")},
+		URIs:           []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// clientCertJSON returns the expected cert object of an auth request for a
+// certificate created by createClientCert.
+func clientCertJSON(cert *x509.Certificate) json.RawMessage {
+	fp := sha256.Sum256(cert.Raw)
+	return json.RawMessage(`{
+		"subject": "CN=device42,O=Resgate",
+		"dnsNames": ["device42.example.com"],
+		"emailAddresses": ["device42@example.com"],
+		"ipAddresses": ["192.0.2.42"],
+		"uris": ["spiffe://example.com/device/42"],
+		"fingerprint": "` + hex.EncodeToString(fp[:]) + `"
+	}`)
+}
+
+func headerAuthConfig(cfg *server.Config) {
+	headerAuth := "vault.method"
+	cfg.HeaderAuth = &headerAuth
+}
+
+// getModelWithHeaderAuth responds to the access and get requests following a
+// header auth request, and validates the HTTP response.
+func getModelWithHeaderAuth(t *testing.T, s *Session, hreq *HTTPRequest) {
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+	hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+}
+
+func TestClientCert_VerifiedCertificate_IncludedInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cert := createClientCert(t)
+
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(req *http.Request) {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.method").
+			AssertPathPayload(t, "scheme", "https").
+			AssertPathPayload(t, "cert", clientCertJSON(cert)).
+			RespondSuccess(nil)
+		getModelWithHeaderAuth(t, s, hreq)
+	}, headerAuthConfig)
+}
+
+func TestClientCert_UnverifiedCertificate_NotIncludedInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cert := createClientCert(t)
+
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(req *http.Request) {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+			}
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.method").
+			AssertPathPayload(t, "scheme", "https").
+			AssertPathMissing(t, "cert").
+			RespondSuccess(nil)
+		getModelWithHeaderAuth(t, s, hreq)
+	}, headerAuthConfig)
+}
+
+func TestClientCert_NoTLS_NotIncludedInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.method").
+			AssertPathPayload(t, "scheme", "http").
+			AssertPathMissing(t, "cert").
+			RespondSuccess(nil)
+		getModelWithHeaderAuth(t, s, hreq)
+	}, headerAuthConfig)
+}
+
+func TestClientCert_WSHeaderAuth_CertificateIncludedInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cert := createClientCert(t)
+		authDone := make(chan struct{})
+
+		// Create LogTesting to log errors in goroutine
+		logt := &LogTesting{
+			NoPanic: true,
+		}
+
+		// Handle the auth request sent during connect
+		go func() {
+			defer close(authDone)
+			defer logt.Defer()
+			s.GetRequest(logt).
+				AssertSubject(logt, "auth.vault.method").
+				AssertPathPayload(logt, "isHttp", true).
+				AssertPathPayload(logt, "scheme", "https").
+				AssertPathPayload(logt, "cert", clientCertJSON(cert)).
+				RespondSuccess(nil)
+		}()
+
+		s.ConnectWithTLS(&tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		})
+
+		<-authDone
+		if logt.Err != nil {
+			t.Fatal(logt.Err)
+		}
+	}, func(cfg *server.Config) {
+		headerAuth := "vault.method"
+		cfg.WSHeaderAuth = &headerAuth
+	})
+}
+
+func TestClientCert_AuthRequest_CertificateIncludedIfVerified(t *testing.T) {
+	tbl := []struct {
+		Verified bool // Flag telling if the certificate is verified
+	}{
+		{true},
+		{false},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			cert := createClientCert(t)
+			state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			if l.Verified {
+				state.VerifiedChains = [][]*x509.Certificate{{cert}}
+			}
+
+			c := s.ConnectWithTLS(state)
+			creq := c.Request("auth.test.method", nil)
+			req := s.GetRequest(t).
+				AssertSubject(t, "auth.test.method").
+				AssertPathPayload(t, "scheme", "https")
+			if l.Verified {
+				req.AssertPathPayload(t, "cert", clientCertJSON(cert))
+			} else {
+				req.AssertPathMissing(t, "cert")
+			}
+			req.RespondSuccess(nil)
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+		})
+	}
+}
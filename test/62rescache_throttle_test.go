@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+func TestThrottle_AddPriority_CallsQueuedCallbacksInPriorityOrder(t *testing.T) {
+	th := rescache.NewThrottle(1)
+	ch := make(chan string, 10)
+	add := func(priority int, name string) {
+		th.AddPriority(priority, func() { ch <- name })
+	}
+
+	add(0, "first")
+	add(1, "a")
+	add(3, "b")
+	add(2, "c")
+	th.Add(func() { ch <- "d" })
+	add(3, "e")
+
+	for _, exp := range []string{"first", "b", "e", "c", "a", "d"} {
+		if name := <-ch; name != exp {
+			t.Fatalf("expected callback %#v to be called, but got %#v", exp, name)
+		}
+		th.Done()
+	}
+}
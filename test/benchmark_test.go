@@ -2,6 +2,7 @@ package test
 
 import (
 	"encoding/json"
+	"strconv"
 	"testing"
 )
 
@@ -64,3 +65,87 @@ func BenchmarkCallRequestWithNilParamsOnSubscribedModelParallel(b *testing.B) {
 
 	teardown(s)
 }
+
+// benchmarkCollectionReset benchmarks a system reset of a collection with n
+// items, where the get response has one item removed and one item added.
+func benchmarkCollectionReset(b *testing.B, n int) {
+	s := setup(nil)
+	c := s.Connect()
+
+	a := make([]int, n)
+	for i := range a {
+		a[i] = i
+	}
+	// Remove an item at 1/3 and add an item at 2/3 of the collection.
+	m := append([]int{}, a[:n/3]...)
+	m = append(m, a[n/3+1:2*n/3]...)
+	m = append(m, -1)
+	m = append(m, a[2*n/3:]...)
+	var data [2]string
+	for i, v := range [][]int{a, m} {
+		d, _ := json.Marshal(v)
+		data[i] = string(d)
+	}
+
+	subscribeToCustomResource(nil, s, c, "test.collection", resource{typ: typeCollection, data: data[0]})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.collection"]}`))
+		s.GetRequest(nil).RespondSuccess(json.RawMessage(`{"collection":` + data[(i+1)%2] + `}`))
+		c.GetEvent(nil)
+		c.GetEvent(nil)
+	}
+
+	teardown(s)
+}
+
+func BenchmarkCollectionReset1000(b *testing.B) {
+	benchmarkCollectionReset(b, 1000)
+}
+
+func BenchmarkCollectionReset5000(b *testing.B) {
+	benchmarkCollectionReset(b, 5000)
+}
+
+// benchmarkModelChangeFanOut benchmarks a model change event sent to n
+// connections subscribing to the same model. The time includes reading the
+// events on the test connections, so allocs/op is the better measure of the
+// cost of encoding the events.
+func benchmarkModelChangeFanOut(b *testing.B, n int) {
+	s := setup(nil)
+	conns := make([]*Conn, n)
+	for i := range conns {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		if i == 0 {
+			mreqs := s.GetParallelRequests(nil, 2)
+			mreqs.GetRequest(nil, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(nil, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		} else {
+			s.GetRequest(nil).RespondSuccess(json.RawMessage(`{"get":true}`))
+		}
+		creq.GetResponse(nil)
+		conns[i] = c
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":`+strconv.Itoa(i)+`}}`))
+		for _, c := range conns {
+			c.GetEvent(nil)
+		}
+	}
+
+	b.StopTimer()
+	teardown(s)
+}
+
+func BenchmarkModelChangeFanOut100(b *testing.B) {
+	benchmarkModelChangeFanOut(b, 100)
+}
+
+func BenchmarkModelChangeFanOut1000(b *testing.B) {
+	benchmarkModelChangeFanOut(b, 1000)
+}
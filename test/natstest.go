@@ -37,6 +37,7 @@ type NATSTestClient struct {
 	l         logger.Logger
 	subs      map[string]*Subscription
 	reqs      chan *Request
+	pubs      chan *Request
 	connected bool
 	mu        sync.Mutex
 }
@@ -83,6 +84,7 @@ func (c *NATSTestClient) Connect() error {
 	defer c.mu.Unlock()
 	c.subs = make(map[string]*Subscription)
 	c.reqs = make(chan *Request, 256)
+	c.pubs = make(chan *Request, 256)
 	c.connected = true
 	return nil
 }
@@ -102,6 +104,7 @@ func (c *NATSTestClient) Close() {
 		return
 	}
 	close(c.reqs)
+	close(c.pubs)
 	c.connected = false
 }
 
@@ -141,6 +144,30 @@ func (c *NATSTestClient) SendRequest(subj string, payload []byte, cb mq.Response
 	}
 }
 
+// Publish publishes a message on a subject, to be retrieved with GetPublish.
+func (c *NATSTestClient) Publish(subj string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var p interface{}
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		panic("test: error unmarshaling published payload: " + err.Error())
+	}
+
+	c.Tracef("<=P %s: %s", subj, payload)
+	if !c.connected {
+		return nats.ErrConnectionClosed
+	}
+	c.pubs <- &Request{
+		Subject:    subj,
+		RawPayload: payload,
+		Payload:    p,
+		c:          c,
+	}
+	return nil
+}
+
 // Subscribe to all events on a resource namespace.
 // The namespace has the format "event."+resource
 func (c *NATSTestClient) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
@@ -289,6 +316,20 @@ func (c *NATSTestClient) GetRequest(t Testing) *Request {
 	return nil
 }
 
+// GetPublish gets a message published to NATS. The message is returned as a
+// Request that must not be responded to.
+// If no message is published within a set amount of time,
+// it will log it as a fatal error.
+func (c *NATSTestClient) GetPublish(t Testing) *Request {
+	select {
+	case r := <-c.pubs:
+		return r
+	case <-time.After(timeoutSeconds * time.Second):
+		t.Fatal("expected a published message but found none")
+	}
+	return nil
+}
+
 // GetParallelRequests gets n number of requests where the order is uncertain.
 func (c *NATSTestClient) GetParallelRequests(t Testing, n int) ParallelRequests {
 	pr := make(ParallelRequests, n)
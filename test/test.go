@@ -2,6 +2,7 @@ package test
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -79,12 +80,15 @@ func (s *Session) ConnectWithChannel(evs chan *ClientEvent) *Conn {
 	return assertConnect(s.connect(evs, nil))
 }
 
-func (s *Session) connect(evs chan *ClientEvent, h http.Header) (*Conn, *http.Response, error) {
+func (s *Session) connect(evs chan *ClientEvent, h http.Header, opts ...func(ws *websocket.Conn)) (*Conn, *http.Response, error) {
 	d := wstest.NewDialer(s.s.GetWSHandlerFunc())
 	c, response, err := d.Dial("ws://example.org/", h)
 	if err != nil {
 		return nil, response, err
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
 
 	conn := NewConn(s, d, c, evs)
 	s.conns[conn] = struct{}{}
@@ -113,6 +117,21 @@ func (s *Session) Connect() *Conn {
 	return c
 }
 
+// ConnectWithoutPong makes a new mock client websocket connection that
+// handshakes with version v1.999.999, and that ignores pings without
+// responding with a pong.
+func (s *Session) ConnectWithoutPong() *Conn {
+	c := assertConnect(s.connect(make(chan *ClientEvent, 256), nil, func(ws *websocket.Conn) {
+		ws.SetPingHandler(func(string) error { return nil })
+	}))
+
+	// Send version connect
+	creq := c.Request("version", versionRequest)
+	cresp := creq.GetResponse(s.t)
+	cresp.AssertResult(s.t, versionResult)
+	return c
+}
+
 // ConnectWithVersion makes a new mock client websocket connection
 // that handshakes with the version string provided.
 func (s *Session) ConnectWithVersion(version string) *Conn {
@@ -139,6 +158,48 @@ func (s *Session) ConnectWithHeader(h http.Header) *Conn {
 	return assertConnect(s.connect(make(chan *ClientEvent, 256), h))
 }
 
+// ConnectWithTLS makes a new mock client websocket connection with the TLS
+// connection state set on the upgrade request, as if connecting over TLS. It
+// handshakes with version v1.999.999.
+func (s *Session) ConnectWithTLS(state *tls.ConnectionState) *Conn {
+	h := s.s.GetWSHandlerFunc()
+	d := wstest.NewDialer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.TLS = state
+		h.ServeHTTP(w, r)
+	}))
+	ws, _, err := d.Dial("ws://example.org/", nil)
+	if err != nil {
+		panic(err)
+	}
+	conn := NewConn(s, d, ws, make(chan *ClientEvent, 256))
+	s.conns[conn] = struct{}{}
+
+	// Send version connect
+	creq := conn.Request("version", versionRequest)
+	cresp := creq.GetResponse(s.t)
+	cresp.AssertResult(s.t, versionResult)
+	return conn
+}
+
+// ConnectWithURL makes a new mock client websocket connection to the URL, with
+// the host and path of the URL set on the upgrade request. It handshakes with
+// version v1.999.999.
+func (s *Session) ConnectWithURL(url string) *Conn {
+	d := wstest.NewDialer(s.s.GetWSHandlerFunc())
+	ws, _, err := d.Dial(url, nil)
+	if err != nil {
+		panic(err)
+	}
+	conn := NewConn(s, d, ws, make(chan *ClientEvent, 256))
+	s.conns[conn] = struct{}{}
+
+	// Send version connect
+	creq := conn.Request("version", versionRequest)
+	cresp := creq.GetResponse(s.t)
+	cresp.AssertResult(s.t, versionResult)
+	return conn
+}
+
 // ConnectWithResponse makes a new mock client websocket connection that
 // handshakes with version v1.999.999, if a connection is established. If an
 // error occurs, it returns the error without handshake.
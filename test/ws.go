@@ -226,15 +226,16 @@ Loop:
 			break Loop
 		}
 
-		c.mu.Lock()
 		// Check if it is an event
 		if cr.Event != nil {
+			// Send without holding the lock, as a full channel would
+			// otherwise block GetEvent from checking for errors.
 			c.evs <- &ClientEvent{
 				Event: *cr.Event,
 				Data:  cr.Data,
 			}
-			c.mu.Unlock()
 		} else {
+			c.mu.Lock()
 			req, ok := c.reqs[cr.ID]
 			if !ok {
 				c.mu.Unlock()